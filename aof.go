@@ -30,54 +30,361 @@ package aof
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math"
 	"math/bits"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
 var (
 	ErrUnexpectedReadError = errors.New("aof: Unexpected error reading file")
 	ErrCompletingLastEntry = errors.New("aof: Error completing last Entry")
 	ErrLastEntryIncomplete = errors.New("aof: Last Entry was incomplete")
+	ErrIncompleteEntry     = errors.New("aof: Entry was incomplete")
 	ErrInvalidArguments    = errors.New("aof: Invalid arguments")
 	ErrUnexpectedWriteErr  = errors.New("aof: Unexpected error writing file")
 	ErrEntryExceedsMaxSize = errors.New("aof: Entry exceeds max supported size")
 	ErrAppenderClosed      = errors.New("aof: Appender closed")
+	ErrCorruptedEntry      = errors.New("aof: Corrupted Entry")
+	ErrInvalidHeader       = errors.New("aof: Invalid file header")
+	ErrUnsupportedVersion  = errors.New("aof: Unsupported file format version")
+	ErrEncryptionKey       = errors.New("aof: Missing or unexpected encryption key")
+	ErrTruncatingLastEntry = errors.New("aof: Error truncating last Entry")
+	ErrOffsetPurged        = errors.New("aof: Offset was purged")
+	ErrReadOnly            = errors.New("aof: Appender is read-only")
+	ErrNotEntryBoundary    = errors.New("aof: Offset is not an Entry boundary")
+	ErrQueueFull           = errors.New("aof: Append queue is full")
+	ErrFileLocked          = errors.New("aof: File is locked by another appender")
+	ErrEntryExpired        = errors.New("aof: Entry expired")
+	ErrEntryDeleted        = errors.New("aof: Entry was deleted")
+	ErrRateLimited         = errors.New("aof: Append rate limit exceeded")
+	ErrQuotaExceeded       = errors.New("aof: Size quota exceeded")
+	ErrNoEntries           = errors.New("aof: No entries")
+	ErrUnsupported         = errors.New("aof: Operation not supported")
+	ErrSigningKey          = errors.New("aof: Missing or unexpected signing key")
+	ErrInvalidSignature    = errors.New("aof: Invalid entry signature")
+	ErrBrokenChain         = errors.New("aof: Broken hash chain")
+	ErrQuorumNotReached    = errors.New("aof: Mirror quorum not reached")
 )
 
+// CorruptedEntryError is returned when the checksum of a complete entry does not match its content.
+// It matches ErrCorruptedEntry when used with errors.Is
+type CorruptedEntryError struct {
+	Offset int64
+}
+
+func (err *CorruptedEntryError) Error() string {
+	return fmt.Sprintf("aof: Corrupted Entry at offset %d", err.Offset)
+}
+
+func (err *CorruptedEntryError) Is(target error) bool {
+	return target == ErrCorruptedEntry
+}
+
+// InvalidSignatureError is returned when the signature of a complete entry does not match its content, which
+// means the file was modified by someone not knowing the signing key. It matches ErrInvalidSignature when used with errors.Is
+type InvalidSignatureError struct {
+	Offset int64
+}
+
+func (err *InvalidSignatureError) Error() string {
+	return fmt.Sprintf("aof: Invalid entry signature at offset %d", err.Offset)
+}
+
+func (err *InvalidSignatureError) Is(target error) bool {
+	return target == ErrInvalidSignature
+}
+
+// BrokenChainError is returned by VerifyChain when the entry at Offset does not store the hash of the entry
+// before it, or when the file ends at Offset without reaching the expected chain head. It matches ErrBrokenChain
+// when used with errors.Is
+type BrokenChainError struct {
+	Offset int64
+}
+
+func (err *BrokenChainError) Error() string {
+	return fmt.Sprintf("aof: Broken hash chain at offset %d", err.Offset)
+}
+
+func (err *BrokenChainError) Is(target error) bool {
+	return target == ErrBrokenChain
+}
+
 type Appender struct {
-	f            *os.File
-	r            *bufio.Reader
-	w            *bufio.Writer
-	mux          sync.Mutex
+	filename string
+	cfg      *Config
+	hdr      *header
+	f        file
+	fsys     fs.FS
+	handle   *handle
+	rd       *fileReader
+	w        *bufio.Writer
+	mux      sync.Mutex
+	// rw is held for reading by reads running without mux and for writing by operations that remove entries
+	rw sync.RWMutex
+	// readers are idle file readers used by reads running without mux
+	readers      []*fileReader
 	maxEntrySize int
-	baseOffset   int64
-	size         int64
-	sharedMem    *sharedMem
+	// maxStoredSize is maxEntrySize plus the compression and encryption overhead
+	maxStoredSize int
+	baseOffset    int64
+	dataOffset    int64
+	head          int64
+	size          int64
+	varintSize    bool
+	aead          cipher.AEAD
+	// keyring holds the previous encryption keys, most recent first
+	keyring []cipher.AEAD
+	// compress and decompress are set when entries are compressed with the dictionary of the file
+	compress   HookFn
+	decompress HookFn
+	meta       *metaLayout
+	recovery   RecoveryStrategy
+	index      *sparseIndex
+	nextSeq    uint64
+	keys       map[string]int64
+	deleted    *deletedSet
+	appended   chan struct{}
+	sharedMem  *sharedMem
+	syncPolicy SyncPolicy
+	syncEvery  int
+	unsynced   int
+	syncDone   chan struct{}
+	// pending are the batches left in the buffer when using FlushInterval, pendingBytes their size
+	pending      []pendingBatch
+	pendingBytes int64
+	flushDone    chan struct{}
+	async        *asyncWriter
+	asyncOnce    sync.Once
+	consumers    *Consumers
+	metrics      Metrics
+	logger       *slog.Logger
+	// last is the offset of the last entry, -1 when there are no entries
+	last         int64
+	payloadBytes int64
+	incomplete   []int64
+	repairs      int64
+	report       *RecoveryReport
+	cache        *entryCache
+	idempotency  *idempotencyWindow
+	limiter      *rateLimiter
 	closed       bool
 	err          error
+	// mmap is the current memory mapping of the file, mmaps holds every mapping created until Close
+	mmap  []byte
+	mmaps [][]byte
+	// frames is the buffer in which appended entries are framed
+	frames []byte
+	// chain is the hash of the last entry written to chained files, stored in the next one
+	chain []byte
+	// contents locates the entries referenced by deduplicated appends
+	contents contentSet
+	// checkpoint is the offset of the latest checkpoint, -1 if there is none
+	checkpoint int64
 }
 
+// Config holds the settings used to open an Appender. MaxEntrySize, Checksum, VarintSize, Timestamps,
+// Types, Sequences, Keyed, Transactions, Tombstones, Versions, Chained, Dedup, Checkpoints, Dictionary, DictionaryCompressor and the use of an EncryptionKey or a SigningKey define the file format and are only used when creating
+// a new file, existing files are read using the format recorded in their header
 type Config struct {
+	// MaxEntrySize is the largest entry accepted. Entry sizes are stored in 2, 4 or 8 bytes depending on it,
+	// sizes above 4GiB are recorded in the header as large entries
 	MaxEntrySize int
 	BaseOffset   int64
 	Perm         os.FileMode
 	ReadOnly     bool
+	// NoLock disables the advisory lock taken on Open, exclusive for writing and shared for reading,
+	// which prevents other processes from appending to the same file
+	NoLock bool
+	// EmptyEntries allows appending zero-length entries, such as markers or heartbeats
+	EmptyEntries bool
+	// Checksum enables CRC32C checksums on every entry
+	Checksum bool
+	// Timestamps records the time at which every entry was appended
+	Timestamps bool
+	// Types stores a type tag in every entry, see AppendTyped
+	Types bool
+	// Versions stores a schema version in every entry, see AppendVersioned
+	Versions bool
+	// Chained stores in every entry the hash of the previous one, making the file a tamper-evident log,
+	// see VerifyChain
+	Chained bool
+	// Dedup stores entries with the same content as an earlier one as a reference to it, resolved when read.
+	// The hash of every distinct content is kept in memory. Entries don't reference entries before a checkpoint,
+	// and TruncateHead fails with ErrEntryReferenced when kept entries reference removed ones. Not supported by
+	// Keyed or encrypted files
+	Dedup bool
+	// Checkpoints allows appending snapshots of the state built from the entries, see Checkpoint
+	Checkpoints bool
+	// Dictionary compresses every entry but tombstones with DictionaryCompressor using it as dictionary, which
+	// improves the compression of small entries sharing content, see TrainDictionary. It is stored in the file
+	// header, so existing files are read with their own dictionary whatever the one given
+	Dictionary []byte
+	// DictionaryCompressor compresses entries using Dictionary. Nil uses DeflateDictionary
+	DictionaryCompressor DictionaryCompressor
+	// Sequences stores a monotonically increasing sequence number in every entry, starting at 1
+	Sequences bool
+	// Keyed stores a key in every entry, see AppendKeyed. Entries can only be appended with AppendKeyed
+	Keyed bool
+	// Transactions allows appending entries in transactions, see Begin, and commits every AppendBulk call as one
+	Transactions bool
+	// Tombstones allows deleting entries with Delete. Not supported by Keyed files
+	Tombstones bool
+	// PersistIndex saves the index to a sidecar file on Close and loads it on Open instead of scanning the file,
+	// so only entries appended after the last Close, if it was not clean, are scanned. A missing or stale sidecar
+	// file is ignored and the index is rebuilt. Keyed files and files using tombstones, deduplication or
+	// checkpoints are always scanned
+	PersistIndex bool
+	// VarintSize encodes entry sizes as uvarints instead of fixed 2 or 4 byte fields
+	VarintSize bool
+	// EncryptionKey is an AES-128, AES-192 or AES-256 key used to encrypt and authenticate entries with AES-GCM.
+	// It is required to open encrypted files
+	EncryptionKey []byte
+	// SigningKey is used to sign every entry with HMAC-SHA256, so modifications made to the file without knowing
+	// the key are detected when entries are read. Incomplete entries are returned without payload, as marking an
+	// entry incomplete doesn't require the key. It is required to open signed files
+	SigningKey []byte
+	// PreviousEncryptionKeys are the keys used before EncryptionKey, most recent first. Entries which can't be
+	// decrypted with EncryptionKey are decrypted with them, see RotateKey
+	PreviousEncryptionKeys [][]byte
+	// Recovery determines how an incomplete last entry is handled
+	Recovery RecoveryStrategy
+	// IndexInterval is the number of entries between consecutive entries kept in the in-memory offset index.
+	// Zero uses DefaultIndexInterval
+	IndexInterval int
+	// SyncPolicy determines when written entries are fsynced to stable storage
+	SyncPolicy SyncPolicy
+	// SyncEvery is the number of appended entries between fsyncs when using SyncEveryN
+	SyncEvery int
+	// SyncPeriod is the time between fsyncs when using SyncInterval
+	SyncPeriod time.Duration
+	// FlushInterval leaves appended entries in the write buffer, which is flushed every FlushInterval, when it
+	// fills up, and on Sync and Close. Entries are visible to readers, and synced as required by SyncPolicy, once
+	// flushed. Zero flushes every append before it returns
+	FlushInterval time.Duration
+	// SyncWrites opens the file for synchronous writes. Appends are durable once they return, so SyncPolicy
+	// can be left as SyncNever. Ignored for read-only appenders and files opened by the caller
+	SyncWrites SyncWrites
+	// GroupCommit makes concurrent Append and AppendBulk calls share a single write, flush and fsync
+	GroupCommit bool
+	// GroupCommitWindow is the time the first entry of a group waits for other appends to join it.
+	// Zero only groups appends already waiting
+	GroupCommitWindow time.Duration
+	// AsyncQueueSize bounds the number of appends waiting for the writer used by AppendAsync and GroupCommit.
+	// Zero uses DefaultAsyncQueueSize
+	AsyncQueueSize int
+	// Backpressure determines what happens when appending to a full queue or exceeding the rate limits
+	Backpressure BackpressurePolicy
+	// MaxSize is the maximum size in bytes of the entries stored in the file. Appends exceeding it fail
+	// with ErrQuotaExceeded. Zero means no limit
+	MaxSize int64
+	// RateLimitOps and RateLimitBytes bound the entries and bytes appended per second, allowing bursts of up to
+	// a second worth of appends. Appends wait, or fail with ErrRateLimited using BackpressureFail. Zero means no limit
+	RateLimitOps   int
+	RateLimitBytes int64
+	// Codec encodes the values appended with AppendValue and Typed. Nil uses JSONCodec
+	Codec Codec
+	// Metrics receives events such as appends, flushes, fsyncs, scans and repairs. Nil disables them
+	Metrics Metrics
+	// Tracer creates spans around appends and folds. Nil disables tracing
+	Tracer Tracer
+	// Logger receives recovery events and the failures causing the appender to close itself. Nil disables logging
+	Logger *slog.Logger
+	// Mmap memory-maps the file so ForEach and other folds pass entries pointing into the mapping instead of
+	// copying them, and Read copies entries straight from it. Entries passed to folds are read-only and must not
+	// be retained, see Entry.Clone. The file must not be truncated by other processes. Ignored where unsupported
+	Mmap bool
+	// CacheEntries and CacheBytes enable an in-memory LRU cache of entries returned by Read, bounded by
+	// number of entries and stored bytes respectively. Zero means no limit, the cache is disabled if both are zero.
+	// Cached entries are shared and must not be modified
+	CacheEntries int
+	CacheBytes   int64
+	// DirectIO bypasses the page cache, using O_DIRECT on Linux and F_NOCACHE on macOS. On Linux, data is
+	// written in aligned blocks and Mmap is ignored. Ignored where unsupported
+	DirectIO bool
+	// ReadAhead is the number of bytes read in background ahead of ForEach and other folds, so reading
+	// the file overlaps with handling entries. Zero disables it. Ignored when the file is memory-mapped
+	ReadAhead int
+	// TTL is the time to live of entries, measured from their timestamps. Expired entries are dropped by
+	// Compact and PurgeExpired. Zero disables expiration. Only files with Timestamps expire
+	TTL time.Duration
+	// EntryTTL returns the time to live of each entry, zero meaning it never expires. It takes precedence over TTL
+	EntryTTL func(e *Entry) time.Duration
+	// SkipExpired hides expired entries from folds and iterators, Read returns ErrEntryExpired instead
+	SkipExpired bool
+	// AppendHooks transform, in order, the content of every appended entry before it is written. An error fails the append
+	AppendHooks []HookFn
+	// ReadHooks transform, in order, the content of entries returned by Read, folds and iterators.
+	// An error fails the read
+	ReadHooks []HookFn
+	// SkipDeleted hides deleted entries and tombstones from folds and iterators, Read returns ErrEntryDeleted
+	// for deleted entries
+	SkipDeleted bool
+	// IdempotencyWindow is the time during which appends made with AppendIdempotent are deduplicated by id.
+	// Zero uses DefaultIdempotencyWindow
+	IdempotencyWindow time.Duration
 }
 
 const DefaultMaxEntrySize = 65535
 const DefaultBaseOffset = 0
 const DefaultPerm = 0644
 const DefaultReadOnly = false
+const DefaultNoLock = false
+const DefaultChecksum = false
+const DefaultVarintSize = false
+const DefaultTimestamps = false
+const DefaultTypes = false
+const DefaultVersions = false
+const DefaultChained = false
+const DefaultDedup = false
+const DefaultCheckpoints = false
+const DefaultSequences = false
+const DefaultKeyed = false
+const DefaultTransactions = false
+const DefaultTombstones = false
+const DefaultPersistIndex = false
+const DefaultSyncPolicy = SyncNever
+const DefaultSyncWrites = SyncWritesOff
+const DefaultRecovery = RecoverPad
+const DefaultIndexInterval = 128
+const DefaultGroupCommit = false
+const DefaultGroupCommitWindow = 0
+const DefaultAsyncQueueSize = 128
+const DefaultBackpressure = BackpressureBlock
+const DefaultMmap = false
+const DefaultIdempotencyWindow = time.Minute
 
 type Entry struct {
-	off        int64
-	size       int
-	bytes      []byte
+	off     int64
+	size    int
+	sizeLen int
+	bytes   []byte
+	payload []byte
+	plain   []byte
+	rawMeta []byte
+	entryMeta
 	incomplete bool
+	pending    bool
+	codec      Codec
+	// original is the offset of the entry holding the content of a resolved reference
+	original int64
+	// metaOnly is set on entries read without their content, see ScanMeta
+	metaOnly bool
+	// pooled is set on entries obtained with Clone
+	pooled bool
 }
 
 type FoldHandler interface {
@@ -86,7 +393,7 @@ type FoldHandler interface {
 	Values() []interface{}
 }
 
-// Note: entry may be used as a shared memory and it should not leave its intended scope
+// Note: entry may be used as a shared memory and it should not leave its intended scope, use Entry.Clone to retain it
 type FoldFn func(e *Entry, pred interface{}) (red interface{}, cutoff bool, err error)
 type ForEachFn func(e *Entry) (cutoff bool, err error)
 type MapFn func(e *Entry) (r interface{}, cutoff bool, err error)
@@ -94,37 +401,73 @@ type FilterFn func(e *Entry) (include bool, cutoff bool, err error)
 
 type sharedMem struct {
 	sharedEntry    *Entry
+	bufSeal        []byte
 	bufRWEntrySize []byte
+	bufRWEntryMeta []byte
 	bufRWEntryFlag []byte
 }
 
 const (
 	fIncompleteEntry uint8 = 1 << iota
 	fCompleteEntry
+	// fPendingEntry flags a complete entry of a transaction that is only visible if followed by a complete entry
+	fPendingEntry
 )
 
 var byteOrder = binary.LittleEndian
 
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 func Open(filename string) (app *Appender, err error) {
-	defaultCfg := &Config{
-		MaxEntrySize: DefaultMaxEntrySize,
-		BaseOffset:   DefaultBaseOffset,
-		Perm:         DefaultPerm,
-		ReadOnly:     DefaultReadOnly,
+	return OpenWithConfig(filename, defaultConfig())
+}
+
+// defaultConfig returns the configuration used by Open
+func defaultConfig() *Config {
+	return &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		ReadOnly:      DefaultReadOnly,
+		NoLock:        DefaultNoLock,
+		Checksum:      DefaultChecksum,
+		VarintSize:    DefaultVarintSize,
+		Timestamps:    DefaultTimestamps,
+		Types:         DefaultTypes,
+		Versions:      DefaultVersions,
+		Chained:       DefaultChained,
+		Dedup:         DefaultDedup,
+		Checkpoints:   DefaultCheckpoints,
+		Sequences:     DefaultSequences,
+		Keyed:         DefaultKeyed,
+		Transactions:  DefaultTransactions,
+		Tombstones:    DefaultTombstones,
+		SyncPolicy:    DefaultSyncPolicy,
+		SyncWrites:    DefaultSyncWrites,
+		Recovery:      DefaultRecovery,
+		IndexInterval: DefaultIndexInterval,
+		PersistIndex:  DefaultPersistIndex,
+		Mmap:          DefaultMmap,
 	}
-	return OpenWithConfig(filename, defaultCfg)
 }
 
 func OpenWithConfig(filename string, cfg *Config) (app *Appender, err error) {
-	if cfg.MaxEntrySize < 1 || cfg.BaseOffset < 0 {
-		return nil, ErrInvalidArguments
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
 	}
 
 	var flag int
 	if cfg.ReadOnly {
 		flag = os.O_RDONLY
 	} else {
-		flag = os.O_CREATE | os.O_RDWR | os.O_APPEND
+		flag = os.O_CREATE | os.O_RDWR | os.O_APPEND | cfg.SyncWrites.flag()
+	}
+
+	// The directory entry of a new file is synced along with its header when writes are synced
+	var created bool
+	if !cfg.ReadOnly && cfg.SyncWrites != SyncWritesOff {
+		_, err := os.Stat(filename)
+		created = errors.Is(err, fs.ErrNotExist)
 	}
 
 	f, err := os.OpenFile(filename, flag, cfg.Perm)
@@ -132,51 +475,328 @@ func OpenWithConfig(filename string, cfg *Config) (app *Appender, err error) {
 		return nil, err
 	}
 
+	if !cfg.NoLock {
+		if err := lockFile(f, !cfg.ReadOnly); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	var af file = f
+	if cfg.DirectIO {
+		af, err = directIO(f, !cfg.ReadOnly)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	app, err = openWith(filename, af, nil, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		if err := syncDir(filepath.Dir(filename)); err != nil {
+			app.Close()
+			return nil, err
+		}
+	}
+
+	return app, nil
+}
+
+func validateConfig(cfg *Config) error {
+	if cfg.MaxEntrySize < 1 || cfg.BaseOffset < 0 {
+		return ErrInvalidArguments
+	}
+
+	if cfg.Recovery < RecoverPad || cfg.Recovery > RecoverFail || cfg.IndexInterval < 0 {
+		return ErrInvalidArguments
+	}
+
+	if (cfg.SyncPolicy == SyncEveryN && cfg.SyncEvery < 1) || (cfg.SyncPolicy == SyncInterval && cfg.SyncPeriod <= 0) {
+		return ErrInvalidArguments
+	}
+
+	if cfg.SyncWrites < SyncWritesOff || cfg.SyncWrites > SyncWritesAll || cfg.FlushInterval < 0 {
+		return ErrInvalidArguments
+	}
+
+	if cfg.GroupCommitWindow < 0 || cfg.AsyncQueueSize < 0 || cfg.Backpressure < BackpressureBlock || cfg.Backpressure > BackpressureFail {
+		return ErrInvalidArguments
+	}
+
+	if cfg.CacheEntries < 0 || cfg.CacheBytes < 0 || cfg.ReadAhead < 0 || cfg.TTL < 0 {
+		return ErrInvalidArguments
+	}
+
+	if cfg.RateLimitOps < 0 || cfg.RateLimitBytes < 0 || cfg.MaxSize < 0 || cfg.IdempotencyWindow < 0 {
+		return ErrInvalidArguments
+	}
+
+	if cfg.Dedup && (cfg.Keyed || len(cfg.EncryptionKey) > 0) {
+		return ErrInvalidArguments
+	}
+
+	if len(cfg.Dictionary) > maxHeaderDictionaryLen {
+		return ErrInvalidArguments
+	}
+
+	if c := cfg.DictionaryCompressor; c != nil && lookupDictionaryCompressor(c.ID()) == nil {
+		return ErrUnknownCompressor
+	}
+
+	return nil
+}
+
+// openWith creates an appender over the already opened file f. fsys is set when f was opened from it,
+// h when f is a view of a file managed by the caller
+func openWith(filename string, f file, fsys fs.FS, h *handle, cfg *Config) (app *Appender, err error) {
+	hdr, err := openHeader(f, cfg)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if (hdr.flags&hSigned != 0) != (len(cfg.SigningKey) > 0) {
+		f.Close()
+		return nil, ErrSigningKey
+	}
+
+	meta := newMetaLayout(hdr.flags)
+	meta.signingKey = cfg.SigningKey
+
+	aead, err := newAEAD(hdr, cfg.EncryptionKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	keyring, err := newKeyring(hdr, cfg.PreviousEncryptionKeys)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	compress, decompress, err := hdr.dictionaryHooks()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	maxStoredSize := hdr.maxEntrySize
+	if compress != nil {
+		maxStoredSize = compressedBound(maxStoredSize)
+	}
+	if aead != nil {
+		maxStoredSize += aead.NonceSize() + aead.Overhead()
+	}
+
+	// Without hLargeEntries sizes are limited to 32 bits
+	if uint64(maxStoredSize) > math.MaxUint32 && hdr.flags&hLargeEntries == 0 {
+		f.Close()
+		return nil, ErrInvalidArguments
+	}
+
+	varintSize := hdr.flags&hVarintSize != 0
+
+	sizeLen := entrySizeLen(maxStoredSize)
+	if varintSize {
+		sizeLen = uvarintLen(maxStoredSize)
+	}
+
 	sharedMem := &sharedMem{
-		sharedEntry:    &Entry{size: 0, bytes: make([]byte, cfg.MaxEntrySize)},
-		bufRWEntrySize: make([]byte, entrySizeLen(cfg.MaxEntrySize)),
+		sharedEntry:    &Entry{size: 0, bytes: make([]byte, min(maxStoredSize, maxPreallocatedSize))},
+		bufRWEntrySize: make([]byte, sizeLen),
+		bufRWEntryMeta: make([]byte, meta.len),
 		bufRWEntryFlag: make([]byte, 1),
 	}
 
+	var keys map[string]int64
+	if hdr.flags&hKeyed != 0 {
+		keys = make(map[string]int64)
+	}
+
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = noMetrics{}
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
 	app = &Appender{
-		f:            f,
-		r:            bufio.NewReader(f),
-		w:            bufio.NewWriter(f),
-		maxEntrySize: cfg.MaxEntrySize,
-		baseOffset:   cfg.BaseOffset,
-		size:         0,
-		sharedMem:    sharedMem,
-		closed:       false,
-		err:          nil,
-	}
-
-	handler := &sizeFoldHandler{app: app, size: 0}
-	err = app.FoldWithHandler(handler)
+		filename:      filename,
+		cfg:           hdr.config(cfg),
+		hdr:           hdr,
+		f:             f,
+		fsys:          fsys,
+		handle:        h,
+		rd:            newFileReader(f, sharedMem.bufRWEntrySize, sharedMem.bufRWEntryMeta, sharedMem.bufRWEntryFlag, sharedMem.sharedEntry),
+		w:             bufio.NewWriter(f),
+		maxEntrySize:  hdr.maxEntrySize,
+		maxStoredSize: maxStoredSize,
+		baseOffset:    cfg.BaseOffset,
+		dataOffset:    cfg.BaseOffset + int64(hdr.len()),
+		head:          hdr.head,
+		size:          0,
+		varintSize:    varintSize,
+		aead:          aead,
+		keyring:       keyring,
+		compress:      compress,
+		decompress:    decompress,
+		meta:          meta,
+		recovery:      cfg.Recovery,
+		index:         newSparseIndex(cfg.IndexInterval),
+		nextSeq:       1,
+		last:          -1,
+		checkpoint:    -1,
+		keys:          keys,
+		deleted:       newDeletedSet(hdr.flags),
+		contents:      newContentSet(hdr.flags),
+		appended:      make(chan struct{}),
+		sharedMem:     sharedMem,
+		syncPolicy:    cfg.SyncPolicy,
+		syncEvery:     cfg.SyncEvery,
+		metrics:       metrics,
+		logger:        logger,
+		cache:         newEntryCache(cfg.CacheEntries, cfg.CacheBytes),
+		idempotency:   newIdempotencyWindow(cfg.IdempotencyWindow),
+		limiter:       newRateLimiter(cfg.RateLimitOps, cfg.RateLimitBytes),
+		closed:        false,
+		err:           nil,
+	}
+
+	// A persisted index covers the entries appended until the appender was last closed,
+	// only the entries appended after it need to be scanned
+	size := hdr.head
+	if cfg.PersistIndex && app.loadIndexFile() {
+		size = app.size
+	}
+
+	indexed := app.index.count
+	handler := &sizeFoldHandler{app: app, size: size}
+	start := time.Now()
+
+	err = app.foldFrom(size, handler, false)
 	app.size = handler.size
+	app.metrics.Scanned(app.index.count-indexed, time.Since(start))
+
+	if errors.Is(err, ErrLastEntryIncomplete) && app.recovery == RecoverFail {
+		app.close(nil)
+		return nil, err
+	}
+
+	if err := app.loadChain(); err != nil {
+		app.close(err)
+		return nil, err
+	}
+
+	if cfg.SyncPolicy == SyncInterval && !cfg.ReadOnly {
+		app.syncDone = make(chan struct{})
+		go app.syncLoop(cfg.SyncPeriod, app.syncDone)
+	}
+
+	if cfg.FlushInterval > 0 && !cfg.ReadOnly {
+		app.flushDone = make(chan struct{})
+		go app.flushLoop(cfg.FlushInterval, app.flushDone)
+	}
 
 	return
 }
 
 func (app *Appender) Close() error {
+	app.stopAsync()
+
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
 	app.mux.Lock()
 	defer app.mux.Unlock()
 
-	return app.close(nil)
+	if !app.closed {
+		if err := app.flushPending(); err != nil {
+			return err
+		}
+	}
+
+	if !app.closed && app.syncPolicy != SyncNever && app.unsynced > 0 {
+		if err := app.f.Sync(); err != nil {
+			app.close(err)
+			return ErrUnexpectedWriteErr
+		}
+	}
+
+	if !app.closed && app.cfg.PersistIndex && !app.cfg.ReadOnly {
+		if err := app.writeIndexFile(); err != nil {
+			app.close(err)
+			return err
+		}
+	}
+
+	err := app.close(nil)
+	app.unmapAll()
+
+	return err
 }
 
 func (app *Appender) close(err error) error {
+	if app.syncDone != nil {
+		close(app.syncDone)
+		app.syncDone = nil
+	}
+	if app.flushDone != nil {
+		close(app.flushDone)
+		app.flushDone = nil
+	}
+	if !app.closed {
+		close(app.appended)
+	}
+	if err != nil && !app.closed {
+		app.logger.Error("aof: closing appender after failure", "file", app.filename, "err", err)
+	}
+	app.closeReaders()
 	app.closed = true
 	app.err = err
 	return app.f.Close()
 }
 
 func (app *Appender) seek(off int64) error {
-	_, err := app.f.Seek(app.baseOffset+off, io.SeekStart)
-	if err != nil {
-		return ErrUnexpectedReadError
+	return app.rd.seek(app.dataOffset + off)
+}
+
+// frameLen returns the number of bytes used to store an entry of the given size
+func (app *Appender) frameLen(size int) int64 {
+	sizeLen := len(app.sharedMem.bufRWEntrySize)
+	if app.varintSize {
+		sizeLen = uvarintLen(size)
 	}
-	app.r.Reset(app.f)
-	return nil
+	return int64(sizeLen + len(app.sharedMem.bufRWEntryMeta) + size + len(app.sharedMem.bufRWEntryFlag))
+}
+
+// entryFrameLen returns the number of bytes used to store a read entry
+func (app *Appender) entryFrameLen(e *Entry) int64 {
+	return int64(e.sizeLen + len(app.sharedMem.bufRWEntryMeta) + e.size + len(app.sharedMem.bufRWEntryFlag))
+}
+
+// encodeEntrySize writes size into the size buffer and returns the encoded bytes
+func (app *Appender) encodeEntrySize(size int) []byte {
+	if app.varintSize {
+		n := binary.PutUvarint(app.sharedMem.bufRWEntrySize, uint64(size))
+		return app.sharedMem.bufRWEntrySize[:n]
+	}
+	writeInt(app.sharedMem.bufRWEntrySize, size)
+	return app.sharedMem.bufRWEntrySize
+}
+
+func uvarintLen(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return (bits.Len(uint(n)) + 6) / 7
 }
 
 func entrySizeLen(maxEntrySize int) int {
@@ -187,7 +807,7 @@ func entrySizeLen(maxEntrySize int) int {
 	if len <= 32 {
 		return 4
 	}
-	panic("Unreacheable point")
+	return 8
 }
 
 func readInt(b []byte) int {
@@ -196,6 +816,8 @@ func readInt(b []byte) int {
 		return int(byteOrder.Uint16(b))
 	case 4:
 		return int(byteOrder.Uint32(b))
+	case 8:
+		return int(byteOrder.Uint64(b))
 	}
 	panic("Unreacheable point")
 }
@@ -208,36 +830,84 @@ func writeInt(b []byte, n int) {
 	case 4:
 		byteOrder.PutUint32(b, uint32(n))
 		return
+	case 8:
+		byteOrder.PutUint64(b, uint64(n))
+		return
 	}
 	panic("Unreacheable point")
 }
 
-func (app *Appender) readFully(b []byte) (int, error) {
-	if b == nil {
-		return 0, ErrInvalidArguments
+// readEntrySize reads the size field of the entry. The number of bytes read and missing to complete it are returned
+func (e *Entry) readEntrySize(app *Appender, rd *fileReader) (n int, missing int, err error) {
+	if app.varintSize {
+		return e.readEntryVarintSize(rd)
 	}
 
-	r := 0
-	for r < len(b) {
-		i, err := app.r.Read(b[r:])
-		r += i
+	bufSize := rd.bufSize
+
+	n, err = rd.readFully(bufSize)
+	if err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+
+	for i := n; i < len(bufSize); i++ {
+		bufSize[i] = 0
+	}
+
+	e.size = readInt(bufSize)
+	e.sizeLen = len(bufSize)
+
+	return n, len(bufSize) - n, err
+}
 
+// readEntryVarintSize reads an uvarint encoded size. An incomplete uvarint is completed with a single zero byte
+func (e *Entry) readEntryVarintSize(rd *fileReader) (n int, missing int, err error) {
+	var size uint64
+	var shift uint
+
+	for {
+		b, err := rd.r.ReadByte()
 		if err != nil {
-			if err == io.EOF {
-				return r, err
+			if err != io.EOF {
+				rd.err = err
+				return n, 0, ErrUnexpectedReadError
+			}
+
+			e.size = int(size)
+			e.sizeLen = n
+			if n > 0 {
+				e.sizeLen++
+				missing = 1
 			}
+			return n, missing, err
+		}
+
+		n++
+		size |= uint64(b&0x7f) << shift
+
+		if b < 0x80 {
+			e.size = int(size)
+			e.sizeLen = n
+			return n, 0, nil
+		}
 
-			app.err = err
-			return r, ErrUnexpectedReadError
+		if n == len(rd.bufSize) {
+			return n, 0, &CorruptedEntryError{Offset: e.off}
 		}
+
+		shift += 7
 	}
-	return r, nil
 }
 
-// read fills up entry. Number of bytes missing to complete the entry is returned
-func (e *Entry) read(app *Appender) (int, error) {
+// read fills up entry using rd. Number of bytes missing to complete the entry is returned
+func (e *Entry) read(app *Appender, rd *fileReader) (int, error) {
+	bufMeta := rd.bufMeta
+
+	e.payload = nil
+	e.key = nil
+
 	// Read entry size
-	n, err := app.readFully(app.sharedMem.bufRWEntrySize)
+	n, ms, err := e.readEntrySize(app, rd)
 	if err != nil && err != io.EOF {
 		return 0, err
 	}
@@ -247,44 +917,101 @@ func (e *Entry) read(app *Appender) (int, error) {
 		return 0, err
 	}
 
-	for i := n; i < len(app.sharedMem.bufRWEntrySize); i++ {
-		app.sharedMem.bufRWEntrySize[i] = 0
+	// A corrupted size must not cause a huge allocation, nor be padded on recovery. Partially read sizes
+	// are never larger than the complete ones
+	if e.size < 0 || e.size > app.maxStoredSize {
+		return 0, &CorruptedEntryError{Offset: e.off}
 	}
 
-	e.size = readInt(app.sharedMem.bufRWEntrySize)
+	// Read entry metadata if size could be fully read
+	rm := 0
+	if ms == 0 {
+		rm, err = rd.readFully(bufMeta)
+		if err != nil && err != io.EOF {
+			return 0, ErrUnexpectedReadError
+		}
+	}
+
+	for i := rm; i < len(bufMeta); i++ {
+		bufMeta[i] = 0
+	}
+
+	app.meta.decode(e, bufMeta)
 
-	// Read entry content if size could be fully read
+	// Read entry content if size and metadata could be fully read
 	rc := 0
-	if n == len(app.sharedMem.bufRWEntrySize) {
+	if ms == 0 && rm == len(bufMeta) {
 		if e.bytes == nil || len(e.bytes) < e.size {
 			e.bytes = make([]byte, e.size)
 		}
 
-		rc, err = app.readFully(e.bytes[:e.size])
+		rc, err = rd.readFully(e.bytes[:e.size])
 		if err != nil && err != io.EOF {
 			return 0, ErrUnexpectedReadError
 		}
 	}
 
 	// Read entry flag
-	app.sharedMem.bufRWEntryFlag[0] = 0
+	rd.bufFlag[0] = 0
 	if rc == e.size {
-		_, err = app.readFully(app.sharedMem.bufRWEntryFlag)
+		_, err = rd.readFully(rd.bufFlag)
 		if err != nil && err != io.EOF {
 			return 0, ErrUnexpectedReadError
 		}
 	}
 
-	e.incomplete = app.sharedMem.bufRWEntryFlag[0] != fCompleteEntry
+	e.pending = rd.bufFlag[0] == fPendingEntry
+	e.incomplete = rd.bufFlag[0] != fCompleteEntry && !e.pending
 
-	missingBytes := (len(app.sharedMem.bufRWEntrySize) - n) + (e.size - rc)
-	if app.sharedMem.bufRWEntryFlag[0] == 0 {
+	e.payload = e.bytes[:rc]
+
+	missingBytes := ms + (len(bufMeta) - rm) + (e.size - rc)
+	if rd.bufFlag[0] == 0 {
 		missingBytes++
 	}
 
 	return missingBytes, err
 }
 
+// decode verifies the entry and turns its stored content into the payload returned to callers
+func (e *Entry) decode(app *Appender) error {
+	if err := e.verify(app); err != nil {
+		return err
+	}
+	if err := e.decrypt(app); err != nil {
+		return err
+	}
+	e.codec = app.codec()
+	if err := e.splitKey(app); err != nil {
+		return err
+	}
+	if err := e.resolve(app); err != nil {
+		return err
+	}
+	return e.decompress(app)
+}
+
+// verify checks the entry metadata and content against its stored checksum and signature. Incomplete entries
+// are not verified, signed files return them without payload as it can't be authenticated
+func (e *Entry) verify(app *Appender) error {
+	if e.incomplete {
+		if app.meta.signature >= 0 {
+			e.payload = e.payload[:0]
+		}
+		return nil
+	}
+
+	if app.meta.checksum >= 0 && app.meta.sum(e.rawMeta, e.bytes[:e.size]) != e.checksum {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	if app.meta.signature >= 0 && !app.meta.validSignature(e.rawMeta, e.bytes[:e.size]) {
+		return &InvalidSignatureError{Offset: e.off}
+	}
+
+	return nil
+}
+
 func (app *Appender) Append(bs []byte) (off int64, err error) {
 	offs, err := app.AppendBulk([][]byte{bs})
 	if err != nil {
@@ -293,83 +1020,450 @@ func (app *Appender) Append(bs []byte) (off int64, err error) {
 	return offs[0], nil
 }
 
+// AppendBulk appends every entry of bss, or none of them if any is invalid or writing fails. When the file
+// supports transactions the entries are committed together, so none of them is kept if a crash interrupts the write
 func (app *Appender) AppendBulk(bss [][]byte) (offs []int64, err error) {
+	return app.traceAppend(context.Background(), "aof.AppendBulk", bss, func() ([]int64, error) {
+		if err := app.throttle(context.Background(), bss); err != nil {
+			return nil, err
+		}
+
+		if app.cfg.GroupCommit {
+			return app.appendGrouped(bss)
+		}
+
+		app.mux.Lock()
+		defer app.mux.Unlock()
+
+		return app.appendBulk(bss, &entryMeta{})
+	})
+}
+
+// AppendSeq appends an entry returning its sequence number along with its offset.
+// Sequences must be enabled in the file format
+func (app *Appender) AppendSeq(bs []byte) (off int64, seq uint64, err error) {
+	if err := app.throttle(context.Background(), [][]byte{bs}); err != nil {
+		return 0, 0, err
+	}
+
 	app.mux.Lock()
 	defer app.mux.Unlock()
 
+	if !app.closed && app.meta.seq < 0 {
+		return 0, 0, ErrInvalidArguments
+	}
+
+	offs, err := app.appendBulk([][]byte{bs}, &entryMeta{})
+	if err != nil {
+		return 0, 0, err
+	}
+	return offs[0], app.nextSeq - 1, nil
+}
+
+// AppendTyped appends an entry tagged with the given type. Types must be enabled in the file format
+func (app *Appender) AppendTyped(tag uint8, bs []byte) (off int64, err error) {
+	if err := app.throttle(context.Background(), [][]byte{bs}); err != nil {
+		return 0, err
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if !app.closed && app.meta.tag < 0 {
+		return 0, ErrInvalidArguments
+	}
+
+	offs, err := app.appendBulk([][]byte{bs}, &entryMeta{tag: tag})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// AppendVersioned appends an entry with the given schema version. Versions must be enabled in the file format
+func (app *Appender) AppendVersioned(version uint16, bs []byte) (off int64, err error) {
+	offs, err := app.AppendBulkVersioned(version, [][]byte{bs})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// AppendBulkVersioned appends every entry of bss with the given schema version, see AppendBulk
+func (app *Appender) AppendBulkVersioned(version uint16, bss [][]byte) (offs []int64, err error) {
+	if err := app.throttle(context.Background(), bss); err != nil {
+		return nil, err
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if !app.closed && app.meta.version < 0 {
+		return nil, ErrInvalidArguments
+	}
+
+	return app.appendBulk(bss, &entryMeta{version: version})
+}
+
+// maxPreallocatedSize bounds the buffer allocated on Open for the shared entry, which grows when larger entries are read
+const maxPreallocatedSize = 1 << 20
+
+// maxRetainedFrames is the largest frame buffer kept for later appends
+const maxRetainedFrames = 1 << 20
+
+// appendBulk writes every entry in bss using the metadata values in m
+func (app *Appender) appendBulk(bss [][]byte, m *entryMeta) (offs []int64, err error) {
 	if app.closed {
 		return nil, ErrAppenderClosed
 	}
 
+	if app.cfg.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
 	if bss == nil || len(bss) == 0 {
 		return nil, ErrInvalidArguments
 	}
 
 	offs = make([]int64, len(bss))
 
+	if m.timestamp == 0 {
+		m.timestamp = time.Now().UnixNano()
+	}
+
+	seq := m.seq
+	if seq == 0 {
+		seq = app.nextSeq
+	}
+
 	var writtenBytes int64 = 0
+	var payloadBytes int64 = 0
+
+	// Every frame is built in a single buffer so nothing is written unless all entries are valid,
+	// and the whole call is written with a single write
+	buf := app.frames[:0]
+
+	// When the file supports transactions every call is committed as one, so a crash while writing it
+	// leaves no partial call behind
+	batch := m.batch || (app.hdr.flags&hTransactions != 0 && app.keys == nil)
+
+	chain := app.chain
+
+	// Contents appended by this call, registered once written
+	var contents contentSet
+	if app.contents != nil {
+		contents = make(contentSet)
+	}
 
 	for i, bs := range bss {
-		if bs == nil || len(bs) == 0 {
+		m.seq = seq + uint64(i)
+
+		if len(app.cfg.AppendHooks) > 0 && !m.tombstone {
+			if bs, err = runHooks(app.cfg.AppendHooks, bs); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(bs) == 0 && !app.cfg.EmptyEntries {
 			return nil, ErrInvalidArguments
 		}
-		if len(bs) > app.maxEntrySize {
+
+		// Deduplication compares compressed contents, as they are stored
+		if app.compress != nil && !m.tombstone {
+			if bs, err = app.compressEntry(bs); err != nil {
+				return nil, err
+			}
+		}
+
+		m.reference = false
+
+		if app.contents != nil && !m.tombstone && !m.checkpoint {
+			h := sha256.Sum256(bs)
+			if ref, ok := app.contents[h]; ok {
+				bs = byteOrder.AppendUint64(nil, uint64(ref))
+				m.reference = true
+			} else if _, ok := contents[h]; !ok {
+				contents[h] = app.size + app.pendingBytes + writtenBytes
+			}
+		}
+
+		if app.keys != nil {
+			if len(m.key) == 0 {
+				return nil, ErrInvalidArguments
+			}
+			bs = encodeKeyed(m.key, bs)
+		}
+
+		if len(bs) > app.maxEncodedSize() {
 			return nil, ErrEntryExceedsMaxSize
 		}
 
-		// Write encoded entry size
-		writeInt(app.sharedMem.bufRWEntrySize, len(bs))
-		n, err := app.w.Write(app.sharedMem.bufRWEntrySize)
-		if n != len(app.sharedMem.bufRWEntrySize) || err != nil {
-			app.close(err)
-			return nil, ErrUnexpectedWriteErr
+		bs, err = app.seal(bs)
+		if err != nil {
+			return nil, err
 		}
 
-		// Write entry
-		n, err = app.w.Write(bs)
-		if n != len(bs) || err != nil {
-			app.close(err)
-			return nil, ErrUnexpectedWriteErr
+		// Frame entry size, metadata, content and flag
+		buf = append(buf, app.encodeEntrySize(len(bs))...)
+
+		if len(app.sharedMem.bufRWEntryMeta) > 0 {
+			m.prev = chain
+			app.meta.encode(app.sharedMem.bufRWEntryMeta, bs, m)
+			buf = append(buf, app.sharedMem.bufRWEntryMeta...)
+
+			if app.meta.prev >= 0 {
+				chain = app.meta.chainHash(app.sharedMem.bufRWEntryMeta, bs)
+			}
 		}
 
-		// Flag as valid entry
-		if err = app.w.WriteByte(fCompleteEntry); err != nil {
-			app.close(err)
-			return nil, ErrUnexpectedWriteErr
+		buf = append(buf, bs...)
+
+		flag := fCompleteEntry
+		if batch && i < len(bss)-1 {
+			flag = fPendingEntry
 		}
 
-		offs[i] = app.size + writtenBytes
-		writtenBytes += int64(len(app.sharedMem.bufRWEntrySize) + len(bs) + len(app.sharedMem.bufRWEntryFlag))
+		buf = append(buf, flag)
+
+		offs[i] = app.size + app.pendingBytes + writtenBytes
+		payloadBytes += int64(len(bs))
+		writtenBytes += app.frameLen(len(bs))
+	}
+
+	if cap(buf) <= maxRetainedFrames {
+		app.frames = buf
+	}
+
+	if app.cfg.MaxSize > 0 && app.size+app.pendingBytes+writtenBytes > app.cfg.MaxSize {
+		return nil, ErrQuotaExceeded
+	}
+
+	n, err := app.w.Write(buf)
+	if n != len(buf) || err != nil {
+		return nil, app.rollback(err)
+	}
+
+	app.chain = chain
+
+	if m.checkpoint {
+		app.contents.reset()
+	}
+
+	for h, off := range contents {
+		app.contents[h] = off
+	}
+
+	if app.deferFlush() {
+		app.pending = append(app.pending, pendingBatch{offs: offs, writtenBytes: writtenBytes, payloadBytes: payloadBytes, m: *m})
+		app.pendingBytes += writtenBytes
+
+		if m.seq >= app.nextSeq {
+			app.nextSeq = m.seq + 1
+		}
+
+		return offs, nil
 	}
 
 	if err = app.w.Flush(); err != nil {
-		app.close(err)
-		return nil, ErrUnexpectedWriteErr
+		return nil, app.rollback(err)
 	}
 
-	app.size += writtenBytes
+	if err = app.flushed(offs, writtenBytes, payloadBytes, m); err != nil {
+		return nil, err
+	}
 
 	return offs, nil
 }
 
+// rollback removes the frames written after the last registered entry, so a failed write leaves no partial call
+// behind, and closes the appender. Entries left in the buffer when using FlushInterval are lost. When the file
+// cannot be truncated the frames are removed on recovery if the file supports transactions
+func (app *Appender) rollback(err error) error {
+	app.f.Truncate(app.dataOffset + app.size)
+	app.close(err)
+	return ErrUnexpectedWriteErr
+}
+
+// flushed registers the entries written at offsets offs once they were flushed, wakes up followers
+// and syncs them as required by the sync policy
+func (app *Appender) flushed(offs []int64, writtenBytes int64, payloadBytes int64, m *entryMeta) error {
+	app.metrics.Flushed()
+	app.metrics.Appended(len(offs), payloadBytes)
+
+	app.size += writtenBytes
+	app.payloadBytes += payloadBytes
+
+	for _, off := range offs {
+		app.index.add(off)
+		app.last = off
+
+		if app.keys != nil {
+			app.keys[string(m.key)] = off
+		}
+	}
+
+	if m.seq >= app.nextSeq {
+		app.nextSeq = m.seq + 1
+	}
+
+	if m.checkpoint {
+		app.checkpoint = offs[len(offs)-1]
+	}
+
+	// Wake up followers waiting for new entries
+	close(app.appended)
+	app.appended = make(chan struct{})
+
+	return app.syncAppended(len(offs))
+}
+
+// Read reads the entry located at offset off. Reads don't block appends nor other reads.
+// ErrNotEntryBoundary is returned if off is not the offset of an entry
 func (app *Appender) Read(off int64) (e *Entry, err error) {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
 	app.mux.Lock()
-	defer app.mux.Unlock()
 
 	if app.closed {
+		app.mux.Unlock()
 		return nil, ErrAppenderClosed
 	}
 
 	if off < 0 || off > app.size {
+		app.mux.Unlock()
 		return nil, ErrInvalidArguments
 	}
 
-	if err := app.seek(off); err != nil {
+	if off < app.head {
+		app.mux.Unlock()
+		return nil, ErrOffsetPurged
+	}
+
+	if app.cfg.SkipDeleted && app.deleted.has(off) {
+		app.mux.Unlock()
+		return nil, ErrEntryDeleted
+	}
+
+	if app.cache != nil {
+		if e, ok := app.cache.get(app.hdr.generation, off); ok {
+			app.mux.Unlock()
+			if app.skipExpired(e) {
+				return nil, ErrEntryExpired
+			}
+			return e, nil
+		}
+	}
+
+	start, known := app.knownBoundary(off)
+
+	v := app.view()
+	m := app.mapping(v)
+
+	if m != nil {
+		if !known && !app.mappedBoundary(m, v.dataOffset, start, off) {
+			app.mux.Unlock()
+			return nil, ErrNotEntryBoundary
+		}
+		known = true
+
+		e = &Entry{off: off}
+		if e.readMapped(app, m, v.dataOffset+off) {
+			app.mux.Unlock()
+
+			// Returned entries may outlive a Truncate shrinking the mapped file, so their content is copied
+			e.bytes = bytes.Clone(e.bytes)
+			e.payload = e.bytes
+
+			if err := e.decode(app); err != nil {
+				return e, err
+			}
+			if err := app.readHooks(e); err != nil {
+				return nil, err
+			}
+			app.cacheEntry(v, e)
+			if app.skipExpired(e) {
+				return nil, ErrEntryExpired
+			}
+			return e, nil
+		}
+	}
+
+	rd, err := app.acquireReader()
+	app.mux.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	defer app.releaseReader(rd)
+
+	if !known {
+		boundary, err := app.readBoundary(rd, v.dataOffset, start, off)
+		if err != nil {
+			return nil, err
+		}
+		if !boundary {
+			return nil, ErrNotEntryBoundary
+		}
+	}
+
+	e, err = app.readEntryWith(rd, v.dataOffset, off)
+	if err != nil {
+		return e, err
+	}
+
+	if err := app.readHooks(e); err != nil {
+		return nil, err
+	}
+
+	app.cacheEntry(v, e)
+
+	if app.skipExpired(e) {
+		return nil, ErrEntryExpired
+	}
+
+	return e, nil
+}
+
+// ReadNth reads the i-th entry of the file, counting from zero at the head
+func (app *Appender) ReadNth(i int64) (e *Entry, err error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if i < 0 || i >= app.index.count {
+		return nil, ErrInvalidArguments
+	}
+
+	ordinal, start := app.index.nearestOrdinal(i)
+
+	handler := &nthHandler{n: i - ordinal}
+
+	if err := app.foldFrom(start, handler, false); err != nil {
+		return nil, err
+	}
+
+	return app.readEntry(handler.off)
+}
+
+func (app *Appender) readEntry(off int64) (e *Entry, err error) {
+	return app.readEntryWith(app.rd, app.dataOffset, off)
+}
+
+// readEntryWith reads and decodes the entry located at offset off using rd
+func (app *Appender) readEntryWith(rd *fileReader, dataOffset int64, off int64) (e *Entry, err error) {
+	if err := rd.seek(dataOffset + off); err != nil {
 		return nil, ErrUnexpectedReadError
 	}
 
 	e = &Entry{off: off}
-	_, err = e.read(app)
+	_, err = e.read(app, rd)
+	if err == nil {
+		err = e.decode(app)
+	}
 
 	return e, err
 }
@@ -378,6 +1472,14 @@ func (app *Appender) ForEach(f ForEachFn) error {
 	return app.FoldWithHandler(&forEachHandler{f: f})
 }
 
+// ForEachCloned is like ForEach but f receives clones of the entries, which it may retain.
+// Clones can be returned to the pool they are taken from with Entry.Release
+func (app *Appender) ForEachCloned(f ForEachFn) error {
+	return app.ForEach(func(e *Entry) (bool, error) {
+		return f(e.Clone())
+	})
+}
+
 func (app *Appender) Map(f MapFn) (ls []interface{}, err error) {
 	handler := &mapHandler{f: f, ls: nil}
 	err = app.FoldWithHandler(handler)
@@ -396,40 +1498,116 @@ func (app *Appender) Fold(f FoldFn, v interface{}) (ret interface{}, err error)
 	return handler.Value(), err
 }
 
+// FoldWithHandler runs handler over the entries present when it is called.
+// Folding doesn't block appends nor other reads, handlers may append entries
 func (app *Appender) FoldWithHandler(handler FoldHandler) error {
+	return app.foldWithHandler(context.Background(), handler)
+}
+
+func (app *Appender) foldWithHandler(ctx context.Context, handler FoldHandler) error {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
 	app.mux.Lock()
-	defer app.mux.Unlock()
 
 	if app.closed {
+		app.mux.Unlock()
 		return ErrAppenderClosed
 	}
 
-	sharedEntry := app.sharedMem.sharedEntry
+	v := app.view()
+	m := app.mapping(v)
+
+	rd, err := app.acquireReader()
+	app.mux.Unlock()
 
-	var off int64 = 0
-	err := app.seek(0)
 	if err != nil {
 		return err
 	}
+	defer app.releaseReader(rd)
+
+	span := app.startSpan(ctx, "aof.Fold")
+
+	start := time.Now()
+
+	if app.cfg.SkipExpired || app.cfg.SkipDeleted {
+		handler = &hiddenFilter{FoldHandler: handler, app: app, now: start}
+	}
+
+	if len(app.cfg.ReadHooks) > 0 {
+		handler = &readHooksHandler{FoldHandler: handler, app: app}
+	}
+
+	ch := &countingHandler{FoldHandler: handler}
+
+	frd := rd
+	if app.cfg.ReadAhead > 0 && m == nil {
+		frd = app.prefetchReader(rd, v)
+		defer frd.ahead.close()
+	}
+
+	err = app.foldView(frd, m, v, ch)
+	app.metrics.Scanned(ch.n, time.Since(start))
+
+	span.SetAttribute("aof.entries", ch.n)
+	span.End(err)
+
+	return err
+}
+
+// fold runs handler over every entry. Entries are only verified and decoded when decode is set
+func (app *Appender) fold(handler FoldHandler, decode bool) error {
+	return app.foldFrom(app.head, handler, decode)
+}
+
+// foldFrom runs handler over every entry starting with the one located at offset off
+func (app *Appender) foldFrom(off int64, handler FoldHandler, decode bool) error {
+	sharedEntry := app.rd.entry
+
+	err := app.seek(off)
+	if err != nil {
+		return err
+	}
+
+	inBatch := false
 
 	for {
 		sharedEntry.off = off
-		mb, err := sharedEntry.read(app)
+		mb, err := sharedEntry.read(app, app.rd)
+		if err != nil && err != io.EOF {
+			return err
+		}
 
-		// Complete last entry if less bytes has been read
-		if mb > 0 {
-			bs := make([]byte, mb)
-			bs[mb-1] = fIncompleteEntry
+		// Entries of a transaction are only visible once its commit marker is found
+		if mb == 0 && err == nil && sharedEntry.pending && !inBatch {
+			committed, cerr := app.batchCommitted(off)
+			if cerr != nil {
+				return cerr
+			}
 
-			n, err := app.w.Write(bs)
-			if n != mb || err != nil {
-				app.close(err)
-				return ErrCompletingLastEntry
+			if !committed {
+				return app.recoverBatch(off)
 			}
 
-			if err = app.w.Flush(); err != nil {
-				app.close(err)
-				return ErrCompletingLastEntry
+			if serr := app.seek(off); serr != nil {
+				return serr
+			}
+
+			inBatch = true
+			continue
+		}
+
+		inBatch = inBatch && sharedEntry.pending
+
+		// Recover last entry if less bytes has been read
+		if mb > 0 {
+			truncated, rerr := app.recoverLastEntry(off, mb)
+			if rerr != nil {
+				return rerr
+			}
+
+			if truncated {
+				return nil
 			}
 
 			err = ErrLastEntryIncomplete
@@ -439,6 +1617,12 @@ func (app *Appender) FoldWithHandler(handler FoldHandler) error {
 			return nil
 		}
 
+		if decode {
+			if derr := sharedEntry.decode(app); derr != nil {
+				return derr
+			}
+		}
+
 		cutoff, herr := handler.Fold(sharedEntry)
 		if herr != nil {
 			return herr
@@ -448,6 +1632,6 @@ func (app *Appender) FoldWithHandler(handler FoldHandler) error {
 			return err
 		}
 
-		off += int64(len(app.sharedMem.bufRWEntrySize) + sharedEntry.size + len(app.sharedMem.bufRWEntryFlag))
+		off += app.entryFrameLen(sharedEntry)
 	}
 }
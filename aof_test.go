@@ -1,9 +1,29 @@
 package aof
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
 	"math/rand"
+	"net"
 	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -38,3 +58,6054 @@ func TestEmptyFile(t *testing.T) {
 
 	app.Close()
 }
+
+func TestChecksum(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	b := randomBytes(16)
+	off, err := app.Append(b)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(e.Bytes(), b) {
+		t.Errorf("Expected %v but %v was read", b, e.Bytes())
+	}
+
+	app.Close()
+
+	// Flip a bit in the middle of the payload
+	f, err := os.OpenFile("test_file.aof", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	_, err = f.WriteAt([]byte{^b[8]}, int64(headerLen+2+4+8))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	f.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	_, err = app.Read(off)
+	if !errors.Is(err, ErrCorruptedEntry) {
+		t.Errorf("Expected ErrCorruptedEntry but %v was returned instead", err)
+	}
+
+	err = app.ForEach(func(e *Entry) (bool, error) { return false, nil })
+	if !errors.Is(err, ErrCorruptedEntry) {
+		t.Errorf("Expected ErrCorruptedEntry but %v was returned instead", err)
+	}
+}
+
+func TestSyncPolicy(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		SyncPolicy:   SyncEveryN,
+	}
+
+	_, err := OpenWithConfig("test_file.aof", cfg)
+	if err != ErrInvalidArguments {
+		t.Errorf("Expected ErrInvalidArguments but %v was returned instead", err)
+	}
+
+	cfg.SyncEvery = 2
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	for i := 1; i <= 3; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if app.unsynced != 1 {
+		t.Errorf("Expected 1 unsynced entry but %d were found", app.unsynced)
+	}
+
+	if err := app.Sync(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if app.unsynced != 0 {
+		t.Errorf("Expected no unsynced entries but %d were found", app.unsynced)
+	}
+
+	app.Close()
+
+	if err := app.Sync(); err != ErrAppenderClosed {
+		t.Errorf("Expected ErrAppenderClosed but %v was returned instead", err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	err := os.WriteFile("test_file.aof", []byte("not an append-only file"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	_, err = Open("test_file.aof")
+	if err != ErrInvalidHeader {
+		t.Errorf("Expected ErrInvalidHeader but %v was returned instead", err)
+	}
+
+	os.Remove("test_file.aof")
+
+	cfg := &Config{
+		MaxEntrySize: 1 << 20,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	b := randomBytes(70000)
+	off, err := app.Append(b)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	// Format settings are taken from the header
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.maxEntrySize != cfg.MaxEntrySize {
+		t.Errorf("Expected max entry size %d but %d was found", cfg.MaxEntrySize, app.maxEntrySize)
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(e.Bytes(), b) {
+		t.Errorf("Read entry does not match appended one")
+	}
+}
+
+func TestPartialHeader(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Dictionary = []byte("dictionary")
+	cfg.SyncWrites = SyncWritesData
+
+	b := newHeader(cfg).encode()
+
+	// A crash while the file was created may leave any part of its header
+	for _, n := range []int{1, len(headerMagic), headerV1Len - 1, headerLen - 1, headerLen + 2, len(b) - 1} {
+		if err := os.WriteFile("test_file.aof", b[:n], DefaultPerm); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		app, err := OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v with %d header bytes", err, n)
+		}
+
+		off, err := app.Append([]byte("entry"))
+		if err != nil || off != 0 {
+			t.Errorf("Unexpected offset %d, err: %v", off, err)
+		}
+
+		app.Close()
+
+		app, err = OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		e, err := app.Read(0)
+		if err != nil || string(e.Bytes()) != "entry" {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+
+		app.Close()
+	}
+
+	os.Remove("test_file.aof")
+
+	// Files not starting with a header are still rejected
+	if err := os.WriteFile("test_file.aof", []byte("GAOX"), DefaultPerm); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := OpenWithConfig("test_file.aof", cfg); err == nil {
+		t.Errorf("Expected an error opening a file with no header")
+	}
+}
+
+func TestLegacyFile(t *testing.T) {
+	// baseline.aof was written before files had a header
+	data, err := os.ReadFile("testdata/baseline.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := os.WriteFile("test_file.aof", data, 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if info := app.Info(); info.Version != 0 || info.Size != int64(len(data)) {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	off, err := app.Append([]byte("fourth entry"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if off != int64(len(data)) {
+		t.Errorf("Expected entry to be appended at offset %d but %d was returned", len(data), off)
+	}
+
+	if err := app.TruncateHead(off); err != ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion but %v was returned instead", err)
+	}
+
+	app.Close()
+
+	expected := []string{"first entry", "second entry", "third entry", "fourth entry"}
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var entries []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		entries = append(entries, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil || !slices.Equal(entries, expected) {
+		t.Errorf("Unexpected entries %q, err: %v", entries, err)
+	}
+
+	app.Close()
+
+	offsets, err := Migrate("test_file.aof", "test_file_migrated.aof", defaultConfig(), defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_migrated.aof")
+
+	app, err = Open("test_file_migrated.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.Info().Version != formatVersion || len(offsets) != len(expected) {
+		t.Errorf("Expected %d entries migrated to version %d", len(expected), formatVersion)
+	}
+
+	e, err := app.Read(offsets[off])
+	if err != nil || string(e.Bytes()) != "fourth entry" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+}
+
+func TestVarintSize(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		VarintSize:   true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	sizes := []int{1, 127, 128, 300, 16384}
+	offs := make([]int64, len(sizes))
+
+	for i, size := range sizes {
+		offs[i], err = app.Append(randomBytes(size))
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	// Leave an incomplete entry with a partially written size at the end of the file
+	app.f.Write([]byte{0x85})
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	i := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if i < len(sizes) {
+			if e.Offset() != offs[i] || e.Size() != sizes[i] || e.Incomplete() {
+				t.Errorf("Unexpected entry %d at offset %d with size %d", i, e.Offset(), e.Size())
+			}
+		} else if !e.Incomplete() {
+			t.Errorf("Expected last entry to be incomplete")
+		}
+		i++
+		return false, nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	b := randomBytes(200)
+	off, err := app.Append(b)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(e.Bytes(), b) {
+		t.Errorf("Read entry does not match appended one")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	key := randomBytes(32)
+
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		EncryptionKey: key,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	b := []byte("some secret content")
+	off, err := app.Append(b)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	content, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if bytes.Contains(content, b) {
+		t.Errorf("Expected entry to be encrypted on disk")
+	}
+
+	_, err = Open("test_file.aof")
+	if err != ErrEncryptionKey {
+		t.Errorf("Expected ErrEncryptionKey but %v was returned instead", err)
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(e.Bytes(), b) {
+		t.Errorf("Expected %s but %s was read", b, e.Bytes())
+	}
+
+	app.Close()
+
+	cfg.EncryptionKey = randomBytes(32)
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	_, err = app.Read(off)
+	if !errors.Is(err, ErrCorruptedEntry) {
+		t.Errorf("Expected ErrCorruptedEntry but %v was returned instead", err)
+	}
+}
+
+func TestRecoveryStrategy(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	_, err = app.Append(randomBytes(10))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// Partially written entry
+	app.f.Write([]byte{10, 0, 1, 2})
+	app.Close()
+
+	fi, _ := os.Stat("test_file.aof")
+	size := fi.Size()
+
+	cfg.Recovery = RecoverFail
+
+	_, err = OpenWithConfig("test_file.aof", cfg)
+	if !errors.Is(err, ErrLastEntryIncomplete) {
+		t.Errorf("Expected ErrLastEntryIncomplete but %v was returned instead", err)
+	}
+
+	var rerr *RecoveryError
+	if !errors.As(err, &rerr) || rerr.Report != (RecoveryReport{Offset: 13, Action: RecoveryFailed, Bytes: 4}) {
+		t.Errorf("Unexpected recovery error %v", err)
+	}
+
+	fi, _ = os.Stat("test_file.aof")
+	if fi.Size() != size {
+		t.Errorf("Expected file to remain unmodified")
+	}
+
+	cfg.Recovery = RecoverTruncate
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	fi, _ = os.Stat("test_file.aof")
+	if fi.Size() != size-4 {
+		t.Errorf("Expected file to be truncated to %d bytes but its size is %d", size-4, fi.Size())
+	}
+
+	if r := app.RecoveryReport(); r == nil || *r != (RecoveryReport{Offset: 13, Action: RecoveryTruncated, Bytes: 4}) {
+		t.Errorf("Unexpected recovery report %v", r)
+	}
+
+	off, err := app.Append(randomBytes(5))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if off != 13 {
+		t.Errorf("Expected offset to be 13 but %d was returned instead", off)
+	}
+
+	app.Close()
+}
+
+func TestTimestamps(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		Timestamps:   true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	before := time.Now()
+
+	off, err := app.Append(randomBytes(10))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	after := time.Now()
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if e.Timestamp().Before(before) || e.Timestamp().After(after) {
+		t.Errorf("Unexpected entry timestamp %v", e.Timestamp())
+	}
+
+	// Tampering with the timestamp is detected by the checksum
+	f, err := os.OpenFile("test_file.aof", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	f.WriteAt([]byte{0xff}, headerLen+2+4)
+	f.Close()
+
+	_, err = app.Read(off)
+	if !errors.Is(err, ErrCorruptedEntry) {
+		t.Errorf("Expected ErrCorruptedEntry but %v was returned instead", err)
+	}
+
+	app.Close()
+}
+
+func TestTypes(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	_, err = app.AppendTyped(1, randomBytes(10))
+	if err != ErrInvalidArguments {
+		t.Errorf("Expected ErrInvalidArguments but %v was returned instead", err)
+	}
+
+	app.Close()
+	os.Remove("test_file.aof")
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Types:        true,
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 0; i < 6; i++ {
+		if _, err := app.AppendTyped(uint8(i%3), randomBytes(i+1)); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := app.Append(randomBytes(1)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	counts := make(map[uint8]int)
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		counts[e.Type()]++
+		return false, nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if counts[0] != 3 || counts[1] != 2 || counts[2] != 2 {
+		t.Errorf("Unexpected type counts %v", counts)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+	for i := 1; i <= 10; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	replacement := []byte("replaced")
+
+	offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) {
+		if e.Size() == 2 {
+			return true, replacement, nil
+		}
+		return e.Size()%2 == 0, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(offsets) != 5 {
+		t.Errorf("Expected 5 entries to be kept but %d were", len(offsets))
+	}
+
+	if offsets[offs[1]] != 0 {
+		t.Errorf("Expected first kept entry to be at offset 0 but it is at %d", offsets[offs[1]])
+	}
+
+	e, err := app.Read(offsets[offs[1]])
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(e.Bytes(), replacement) {
+		t.Errorf("Expected replaced content but %v was read", e.Bytes())
+	}
+
+	sizes, err := app.Map(func(e *Entry) (interface{}, bool, error) {
+		return e.Size(), false, nil
+	})
+	if err != nil || len(sizes) != 5 {
+		t.Errorf("Unexpected entries %v after compaction, err: %v", sizes, err)
+	}
+
+	off, err := app.Append(randomBytes(3))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Read(off); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	offs, err := app.AppendBulk([][]byte{randomBytes(5), randomBytes(6), randomBytes(7)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.Truncate(offs[1] + 1); err != ErrNotEntryBoundary {
+		t.Errorf("Expected ErrNotEntryBoundary but %v was returned instead", err)
+	}
+
+	if err := app.Truncate(offs[1]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	off, err := app.Append(randomBytes(8))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if off != offs[1] {
+		t.Errorf("Expected entry to be appended at offset %d but it was at %d", offs[1], off)
+	}
+
+	n := 0
+	app.ForEach(func(e *Entry) (bool, error) {
+		n++
+		return false, nil
+	})
+	if n != 2 {
+		t.Errorf("Expected 2 entries but %d were found", n)
+	}
+}
+
+func TestTruncateHead(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{randomBytes(5), randomBytes(6), randomBytes(7)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.TruncateHead(offs[1] + 1); err != ErrNotEntryBoundary {
+		t.Errorf("Expected ErrNotEntryBoundary but %v was returned instead", err)
+	}
+
+	if err := app.TruncateHead(offs[2]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if _, err := app.Read(offs[0]); err != ErrOffsetPurged {
+		t.Errorf("Expected ErrOffsetPurged but %v was returned instead", err)
+	}
+
+	var found []int64
+	app.ForEach(func(e *Entry) (bool, error) {
+		found = append(found, e.Offset())
+		return false, nil
+	})
+	if len(found) != 1 || found[0] != offs[2] {
+		t.Errorf("Expected only entry at offset %d but found %v", offs[2], found)
+	}
+
+	off, err := app.Append(randomBytes(8))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if off != offs[2]+10 {
+		t.Errorf("Expected entry to be appended at offset %d but it was at %d", offs[2]+10, off)
+	}
+}
+
+func TestSparseIndex(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		IndexInterval: 4,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	var offs []int64
+	for i := 1; i <= 10; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.index.count != 10 || len(app.index.offs) != 3 {
+		t.Errorf("Unexpected index with %d entries and %d offsets", app.index.count, len(app.index.offs))
+	}
+
+	ordinal, off := app.index.nearestOrdinal(6)
+	if ordinal != 4 || off != offs[4] {
+		t.Errorf("Expected entry 4 at offset %d but entry %d at offset %d was found", offs[4], ordinal, off)
+	}
+
+	ordinal, off = app.index.nearestOffset(offs[9] + 1)
+	if ordinal != 8 || off != offs[8] {
+		t.Errorf("Expected entry 8 at offset %d but entry %d at offset %d was found", offs[8], ordinal, off)
+	}
+
+	if err := app.Truncate(offs[8]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if app.index.count != 8 || len(app.index.offs) != 2 {
+		t.Errorf("Unexpected index with %d entries and %d offsets", app.index.count, len(app.index.offs))
+	}
+}
+
+func TestSequences(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Sequences:    true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	_, seq, err := app.AppendSeq(randomBytes(4))
+	if err != nil || seq != 1 {
+		t.Errorf("Expected sequence 1 but %d was returned, err: %v", seq, err)
+	}
+
+	if _, err := app.AppendBulk([][]byte{randomBytes(4), randomBytes(4)}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	off, seq, err := app.AppendSeq(randomBytes(4))
+	if err != nil || seq != 4 {
+		t.Errorf("Expected sequence 4 but %d was returned, err: %v", seq, err)
+	}
+
+	var seqs []uint64
+	app.ForEach(func(e *Entry) (bool, error) {
+		seqs = append(seqs, e.Seq())
+		return false, nil
+	})
+	for i, s := range seqs {
+		if s != uint64(i+1) {
+			t.Errorf("Expected sequence %d but %d was found", i+1, s)
+		}
+	}
+
+	// Sequence numbers are preserved by compaction
+	offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) {
+		return e.Seq()%2 == 0, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(offsets[off])
+	if err != nil || e.Seq() != 4 {
+		t.Errorf("Expected sequence 4 after compaction, err: %v", err)
+	}
+}
+
+func TestReadNth(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		IndexInterval: 4,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 10; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	for i := int64(0); i < 10; i++ {
+		e, err := app.ReadNth(i)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if e.Size() != int(i)+1 {
+			t.Errorf("Expected entry of size %d but size %d was read", i+1, e.Size())
+		}
+	}
+
+	if _, err := app.ReadNth(10); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestPersistIndex(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		IndexInterval: 4,
+		Sequences:     true,
+		PersistIndex:  true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer os.Remove("test_file.aof.idx")
+
+	for i := 1; i <= 10; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	size := app.size
+	app.Close()
+
+	if _, err := os.Stat("test_file.aof.idx"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if app.size != size || app.index.count != 10 || len(app.index.offs) != 3 || app.nextSeq != 11 {
+		t.Errorf("Unexpected index with %d entries and %d offsets", app.index.count, len(app.index.offs))
+	}
+
+	if _, err := os.Stat("test_file.aof.idx"); err != nil {
+		t.Errorf("Expected index file to be kept while the file is open")
+	}
+
+	// Entries appended before a crash are scanned, the rest is loaded from the index
+	app.Append(randomBytes(5))
+	app.f.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if app.index.count != 11 || app.nextSeq != 12 {
+		t.Errorf("Unexpected index with %d entries", app.index.count)
+	}
+
+	if err := app.Truncate(size); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	// Entries appended without the index make it stale
+	noIndexCfg := *cfg
+	noIndexCfg.PersistIndex = false
+
+	app, err = OpenWithConfig("test_file.aof", &noIndexCfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Append(randomBytes(11))
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.index.count != 11 || app.nextSeq != 12 {
+		t.Errorf("Expected index to be rebuilt but %d entries were found", app.index.count)
+	}
+
+	e, err := app.ReadNth(10)
+	if err != nil || e.Size() != 11 {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		Keyed:         true,
+		EncryptionKey: []byte("0123456789abcdef"),
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte("value")); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := []byte{byte('a' + i%3)}
+		if _, err := app.AppendKeyed(key, []byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.Keys() != 3 {
+		t.Errorf("Expected 3 keys but %d were found", app.Keys())
+	}
+
+	value, err := app.Get([]byte("b"))
+	if err != nil || !bytes.Equal(value, []byte{7}) {
+		t.Errorf("Unexpected value %v, err: %v", value, err)
+	}
+
+	if _, err := app.Get([]byte("z")); err != ErrKeyNotFound {
+		t.Errorf("Expected error %v but %v was returned", ErrKeyNotFound, err)
+	}
+
+	if _, err := app.CompactKeys(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if app.index.count != 3 {
+		t.Errorf("Expected 3 entries after compaction but %d were found", app.index.count)
+	}
+
+	for i, b := range []byte{9, 7, 8} {
+		value, err := app.Get([]byte{byte('a' + i)})
+		if err != nil || !bytes.Equal(value, []byte{b}) {
+			t.Errorf("Unexpected value %v, err: %v", value, err)
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+	for i := 1; i <= 5; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	if _, err := app.Iterator(offs[1] + 1); err != ErrNotEntryBoundary {
+		t.Errorf("Expected error %v but %v was returned", ErrNotEntryBoundary, err)
+	}
+
+	it, err := app.Iterator(offs[2])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	for i := 2; ; i++ {
+		e, err := it.Next()
+		if err == io.EOF {
+			if i != 5 {
+				t.Errorf("Expected 3 entries but %d were read", i-2)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if e.Offset() != offs[i] || e.Size() != i+1 {
+			t.Errorf("Unexpected entry %v", e)
+		}
+	}
+
+	it.Close()
+
+	if _, err := it.Next(); err != ErrIteratorClosed {
+		t.Errorf("Expected error %v but %v was returned", ErrIteratorClosed, err)
+	}
+}
+
+func TestIteratorReverse(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		IndexInterval: 4,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 10; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	size := 10
+	err = app.ForEachReverse(func(e *Entry) (bool, error) {
+		if e.Size() != size {
+			t.Errorf("Expected entry of size %d but size %d was read", size, e.Size())
+		}
+		size--
+		return false, nil
+	})
+	if err != nil || size != 0 {
+		t.Errorf("Expected every entry to be read, %d left, err: %v", size, err)
+	}
+
+	it, err := app.IteratorReverse()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	app.Append(randomBytes(11))
+
+	e, err := it.Next()
+	if err != nil || e.Size() != 10 {
+		t.Errorf("Expected last entry before the iterator was created, err: %v", err)
+	}
+}
+
+func TestForEachRange(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+	for i := 1; i <= 5; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	var sizes []int
+	err = app.ForEachRange(offs[1], offs[3]+1, func(e *Entry) (bool, error) {
+		sizes = append(sizes, e.Size())
+		return false, nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 4 {
+		t.Errorf("Unexpected entries of sizes %v", sizes)
+	}
+
+	if err := app.ForEachRange(offs[3], offs[1], nil); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 5; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	entries, errs := app.Stream(context.Background())
+
+	size := 0
+	for e := range entries {
+		size++
+		if e.Size() != size {
+			t.Errorf("Expected entry of size %d but size %d was read", size, e.Size())
+		}
+	}
+
+	if err := <-errs; err != nil || size != 5 {
+		t.Errorf("Expected 5 entries but %d were read, err: %v", size, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	entries, errs = app.Stream(ctx)
+	<-entries
+	cancel()
+
+	for range entries {
+	}
+
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected error %v but %v was returned", context.Canceled, err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 1; i <= 5; i++ {
+		if _, err := app.AppendContext(ctx, randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	n := 0
+	err = app.ForEachContext(ctx, func(e *Entry) (bool, error) {
+		n++
+		if n == 2 {
+			cancel()
+		}
+		return false, nil
+	})
+	if err != context.Canceled || n != 2 {
+		t.Errorf("Expected scan to be canceled after 2 entries but %d were read, err: %v", n, err)
+	}
+
+	if _, err := app.AppendContext(ctx, randomBytes(1)); err != context.Canceled {
+		t.Errorf("Expected error %v but %v was returned", context.Canceled, err)
+	}
+
+	if _, err := app.ReadContext(ctx, 0); err != context.Canceled {
+		t.Errorf("Expected error %v but %v was returned", context.Canceled, err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	app.Append(randomBytes(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it, err := app.Follow(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	if e, err := it.Next(); err != nil || e.Size() != 1 {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		app.Append(randomBytes(2))
+	}()
+
+	if e, err := it.Next(); err != nil || e.Size() != 2 {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := it.Next(); err != context.Canceled {
+		t.Errorf("Expected error %v but %v was returned", context.Canceled, err)
+	}
+}
+
+func TestFollowTruncate(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{randomBytes(10), randomBytes(10)}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	it, err := app.Follow(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if err := app.Truncate(0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append(randomBytes(36)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := it.Next(); err != ErrStaleCursor {
+		t.Errorf("Expected error %v but %v was returned", ErrStaleCursor, err)
+	}
+
+	// Followers waiting for new entries are woken up by Truncate
+	it, err = app.Follow(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	if _, err := it.Next(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		app.Truncate(0)
+	}()
+
+	if _, err := it.Next(); err != ErrStaleCursor {
+		t.Errorf("Expected error %v but %v was returned", ErrStaleCursor, err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Sequences:    true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	for i := 1; i <= 5; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	it, err := app.Iterator(0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	it.Next()
+	it.Next()
+
+	b, _ := it.Cursor().MarshalBinary()
+	it.Close()
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	var c Cursor
+	if err := c.UnmarshalBinary(b); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	it, err = app.Resume(c)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := it.Next()
+	if err != nil || e.Seq() != 3 || e.Size() != 3 {
+		t.Errorf("Expected third entry after resuming, err: %v", err)
+	}
+
+	if err := app.Truncate(c.Offset); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Resume(c); err != ErrStaleCursor {
+		t.Errorf("Expected error %v but %v was returned", ErrStaleCursor, err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+	for i := 1; i <= 10; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		r, err := app.NewReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer r.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				n := 0
+				err := r.ForEach(func(e *Entry) (bool, error) {
+					n++
+					if n <= 10 && e.Size() != n {
+						t.Errorf("Expected entry of size %d but size %d was read", n, e.Size())
+					}
+					return false, nil
+				})
+				if err != nil || n < 10 {
+					t.Errorf("Expected at least 10 entries but %d were read, err: %v", n, err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.Append(randomBytes(1)); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	wg.Wait()
+
+	r, err := app.NewReader()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer r.Close()
+
+	if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return e.Size() > 1, nil, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := r.Read(0)
+	if err != nil || e.Size() != 2 {
+		t.Errorf("Expected entry of size 2 after compaction, err: %v", err)
+	}
+}
+
+func TestAppendWhileFolding(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 5; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	// Entries appended while folding are not seen by the fold
+	n := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		n++
+		_, err := app.Append(e.Bytes())
+		return false, err
+	})
+	if err != nil || n != 5 {
+		t.Errorf("Expected 5 entries but %d were read, err: %v", n, err)
+	}
+
+	ls, err := app.Map(func(e *Entry) (interface{}, bool, error) {
+		return e.Size(), false, nil
+	})
+	if err != nil || len(ls) != 10 {
+		t.Errorf("Expected 10 entries but %d were read, err: %v", len(ls), err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+	for i := 1; i <= 5; i++ {
+		off, err := app.Append(randomBytes(i))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	s, err := app.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer s.Close()
+
+	app.Append(randomBytes(6))
+
+	if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return e.Size() > 3, nil, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ls, err := s.Map(func(e *Entry) (interface{}, bool, error) {
+		return e.Size(), false, nil
+	})
+	if err != nil || len(ls) != 5 {
+		t.Errorf("Expected 5 entries in the snapshot but %d were read, err: %v", len(ls), err)
+	}
+
+	e, err := s.Read(offs[1])
+	if err != nil || e.Size() != 2 {
+		t.Errorf("Expected entry of size 2, err: %v", err)
+	}
+
+	s2, err := app.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer s2.Close()
+
+	if err := app.Truncate(0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := s2.ForEach(func(e *Entry) (bool, error) { return false, nil }); err != ErrSnapshotStale {
+		t.Errorf("Expected error %v but %v was returned", ErrSnapshotStale, err)
+	}
+}
+
+func TestAppendAsync(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		SyncPolicy:   SyncAlways,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	var results []<-chan AppendResult
+	for i := 1; i <= 10; i++ {
+		results = append(results, app.AppendAsync(randomBytes(i)))
+	}
+
+	results = append(results, app.AppendAsync(nil))
+
+	for i, ch := range results[:10] {
+		res := <-ch
+		if res.Err != nil {
+			t.Fatalf("Unexpected error %v", res.Err)
+		}
+
+		e, err := app.Read(res.Offset)
+		if err != nil || e.Size() != i+1 {
+			t.Errorf("Expected entry of size %d at offset %d, err: %v", i+1, res.Offset, err)
+		}
+	}
+
+	if res := <-results[10]; res.Err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, res.Err)
+	}
+
+	app.Close()
+
+	if res := <-app.AppendAsync(randomBytes(1)); res.Err != ErrAppenderClosed {
+		t.Errorf("Expected error %v but %v was returned", ErrAppenderClosed, res.Err)
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:      DefaultMaxEntrySize,
+		BaseOffset:        DefaultBaseOffset,
+		Perm:              DefaultPerm,
+		SyncPolicy:        SyncAlways,
+		GroupCommit:       true,
+		GroupCommitWindow: time.Millisecond,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(size int) {
+			defer wg.Done()
+
+			offs, err := app.AppendBulk([][]byte{randomBytes(size), randomBytes(size)})
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+				return
+			}
+
+			for _, off := range offs {
+				e, err := app.Read(off)
+				if err != nil || e.Size() != size {
+					t.Errorf("Expected entry of size %d at offset %d, err: %v", size, off, err)
+				}
+			}
+		}(i)
+	}
+
+	if _, err := app.Append(nil); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	wg.Wait()
+
+	if app.index.count != 40 {
+		t.Errorf("Expected 40 entries but %d were found", app.index.count)
+	}
+}
+
+func TestGroupCommitRejectedRequest(t *testing.T) {
+	errBad := errors.New("bad entry")
+
+	cfg := &Config{
+		MaxEntrySize: 16,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		GroupCommit:  true,
+		AppendHooks: []HookFn{func(bs []byte) ([]byte, error) {
+			switch string(bs) {
+			case "bad":
+				return nil, errBad
+			case "large":
+				return randomBytes(17), nil
+			}
+			return bs, nil
+		}},
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	// The writer is kept busy while the appender is locked, so the following requests are grouped
+	app.mux.Lock()
+	first := app.AppendAsync([]byte("first"))
+	time.Sleep(10 * time.Millisecond)
+
+	payloads := []string{"entry1", "bad", "entry2", "large", "entry3"}
+	results := make([]<-chan AppendResult, len(payloads))
+	for i, payload := range payloads {
+		results[i] = app.AppendAsync([]byte(payload))
+	}
+
+	app.mux.Unlock()
+
+	if res := <-first; res.Err != nil {
+		t.Errorf("Unexpected error %v", res.Err)
+	}
+
+	for i, payload := range payloads {
+		res := <-results[i]
+
+		switch payload {
+		case "bad":
+			if res.Err != errBad {
+				t.Errorf("Expected error %v but %v was returned", errBad, res.Err)
+			}
+		case "large":
+			if res.Err != ErrEntryExceedsMaxSize {
+				t.Errorf("Expected error %v but %v was returned", ErrEntryExceedsMaxSize, res.Err)
+			}
+		default:
+			if res.Err != nil {
+				t.Errorf("Unexpected error %v", res.Err)
+				continue
+			}
+			e, err := app.Read(res.Offset)
+			if err != nil || string(e.Bytes()) != payload {
+				t.Errorf("Expected entry %q at offset %d, err: %v", payload, res.Offset, err)
+			}
+		}
+	}
+
+	if n := app.Count(); n != 4 {
+		t.Errorf("Expected 4 entries but %d were found", n)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:   DefaultMaxEntrySize,
+		BaseOffset:     DefaultBaseOffset,
+		Perm:           DefaultPerm,
+		AsyncQueueSize: 1,
+		Backpressure:   BackpressureFail,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	// The writer is kept busy while the appender is locked
+	app.mux.Lock()
+
+	first := app.AppendAsync(randomBytes(1))
+	time.Sleep(10 * time.Millisecond)
+	second := app.AppendAsync(randomBytes(1))
+
+	if res := <-app.AppendAsync(randomBytes(1)); res.Err != ErrQueueFull {
+		t.Errorf("Expected error %v but %v was returned", ErrQueueFull, res.Err)
+	}
+
+	app.mux.Unlock()
+
+	for _, ch := range []<-chan AppendResult{first, second} {
+		if res := <-ch; res.Err != nil {
+			t.Errorf("Unexpected error %v", res.Err)
+		}
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := Open("test_file.aof"); err != ErrFileLocked {
+		t.Errorf("Expected error %v but %v was returned", ErrFileLocked, err)
+	}
+
+	app.Close()
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		ReadOnly:     true,
+	}
+
+	r1, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer r1.Close()
+
+	r2, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer r2.Close()
+
+	if _, err := Open("test_file.aof"); err != ErrFileLocked {
+		t.Errorf("Expected error %v but %v was returned", ErrFileLocked, err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		NoLock:       true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 3; i++ {
+		app.Append(randomBytes(i))
+	}
+
+	roCfg := *cfg
+	roCfg.ReadOnly = true
+
+	follower, err := OpenWithConfig("test_file.aof", &roCfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer follower.Close()
+
+	app.Append(randomBytes(4))
+	app.Append(randomBytes(5))
+
+	// An entry still being written is not picked up
+	f, err := os.OpenFile("test_file.aof", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	f.Write([]byte{6})
+	f.Close()
+
+	if err := follower.Refresh(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if follower.index.count != 5 || follower.size != app.size {
+		t.Errorf("Expected 5 entries but %d were found", follower.index.count)
+	}
+
+	// Compaction replaces the file and drops the partial entry
+	if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return e.Size() > 2, nil, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := follower.Refresh(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := follower.ReadNth(0)
+	if follower.index.count != 3 || err != nil || e.Size() != 3 {
+		t.Errorf("Expected 3 entries after compaction but %d were found, err: %v", follower.index.count, err)
+	}
+}
+
+type testRecord struct {
+	ID   int
+	Name string
+}
+
+func TestTyped(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	typed := NewTyped[testRecord](app, nil)
+
+	off, err := typed.Append(testRecord{ID: 1, Name: "first"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := typed.AppendBulk([]testRecord{{ID: 2, Name: "second"}, {ID: 3, Name: "third"}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	r, err := typed.Read(off)
+	if err != nil || r.ID != 1 || r.Name != "first" {
+		t.Errorf("Unexpected record %v, err: %v", r, err)
+	}
+
+	rs, err := typed.Filter(func(r testRecord) (bool, bool, error) {
+		return r.ID > 1, false, nil
+	})
+	if err != nil || len(rs) != 2 || rs[1].Name != "third" {
+		t.Errorf("Unexpected records %v, err: %v", rs, err)
+	}
+
+	ls, err := typed.Map(func(r testRecord) (interface{}, bool, error) {
+		return r.ID, false, nil
+	})
+	if err != nil || len(ls) != 3 || ls[2].(int) != 3 {
+		t.Errorf("Unexpected values %v, err: %v", ls, err)
+	}
+}
+
+type testProto struct {
+	data []byte
+}
+
+func (m *testProto) Marshal() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *testProto) Unmarshal(data []byte) error {
+	m.data = append([]byte(nil), data...)
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}} {
+		cfg := &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+			Codec:        codec,
+		}
+
+		app, err := OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		off, err := app.AppendValue(testRecord{ID: 1, Name: "first"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		var r testRecord
+		if err := app.ReadValue(off, &r); err != nil || r.ID != 1 || r.Name != "first" {
+			t.Errorf("Unexpected record %v, err: %v", r, err)
+		}
+
+		app.Close()
+		os.Remove("test_file.aof")
+	}
+
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	typed := NewTyped[*testProto](app, ProtoCodec{})
+
+	off, err := typed.Append(&testProto{data: []byte("message")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	m, err := typed.Read(off)
+	if err != nil || string(m.data) != "message" {
+		t.Errorf("Unexpected message %v, err: %v", m, err)
+	}
+
+	if _, err := app.AppendValue(testRecord{}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := (ProtoCodec{}).Marshal(testRecord{}); err != ErrUnsupportedValue {
+		t.Errorf("Expected error %v but %v was returned", ErrUnsupportedValue, err)
+	}
+}
+
+func TestGenericFold(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{[]byte("a"), []byte("bb"), []byte("ccc")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	sizes, err := Map(app, func(e *Entry) (int, bool, error) {
+		return e.Size(), false, nil
+	})
+	if err != nil || len(sizes) != 3 || sizes[2] != 3 {
+		t.Errorf("Unexpected sizes %v, err: %v", sizes, err)
+	}
+
+	strs, err := FilteredMap(app, func(e *Entry) (bool, bool, error) {
+		return e.Size() > 1, false, nil
+	}, func(e *Entry) (string, bool, error) {
+		return string(e.Bytes()), false, nil
+	})
+	if err != nil || len(strs) != 2 || strs[0] != "bb" {
+		t.Errorf("Unexpected values %v, err: %v", strs, err)
+	}
+
+	total, err := Fold(app, func(e *Entry, n int) (int, bool, error) {
+		return n + e.Size(), false, nil
+	}, 0)
+	if err != nil || total != 6 {
+		t.Errorf("Unexpected total %d, err: %v", total, err)
+	}
+}
+
+func TestEntryDecode(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Codec:        GobCodec{},
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := app.AppendValue(testRecord{ID: i}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	total, err := Fold(app, func(e *Entry, n int) (int, bool, error) {
+		var r testRecord
+		if err := e.Decode(&r); err != nil {
+			return n, false, err
+		}
+		return n + r.ID, false, nil
+	}, 0)
+	if err != nil || total != 6 {
+		t.Errorf("Unexpected total %d, err: %v", total, err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := io.WriteString(app.Writer(), "entry"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	w := app.SplitWriter(bufio.ScanLines)
+
+	if _, err := io.WriteString(w, "first\nsec"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := io.WriteString(w, "ond\nthird"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ls, err := Map(app, func(e *Entry) (string, bool, error) {
+		return string(e.Bytes()), false, nil
+	})
+	if err != nil || len(ls) != 4 || ls[0] != "entry" || ls[2] != "second" || ls[3] != "third" {
+		t.Errorf("Unexpected entries %v, err: %v", ls, err)
+	}
+}
+
+func TestEntryReader(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendValue(testRecord{ID: 1, Name: "first"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	off, err := app.AppendValue(testRecord{ID: 2, Name: "second"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	r, err := app.EntryReader(off)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer r.Close()
+
+	var rec testRecord
+	if err := json.NewDecoder(r).Decode(&rec); err != nil || rec.ID != 2 || rec.Name != "second" {
+		t.Errorf("Unexpected record %v, err: %v", rec, err)
+	}
+
+	_, err = app.EntryReader(app.size)
+	if err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Keyed:        true,
+	}
+
+	kapp, err := OpenWithConfig("test_file_keyed.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_keyed.aof")
+	defer kapp.Close()
+
+	off, err = kapp.AppendKeyed([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	kr, err := kapp.EntryReader(off)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer kr.Close()
+
+	bs, err := io.ReadAll(kr)
+	if err != nil || string(bs) != "value" {
+		t.Errorf("Unexpected payload %q, err: %v", bs, err)
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	data, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	w.Write(data)
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, fsys := range []fs.FS{fstest.MapFS{"test_file.aof": {Data: data}}, zr} {
+		fapp, err := OpenFS(fsys, "test_file.aof")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		ls, err := Map(fapp, func(e *Entry) (string, bool, error) {
+			return string(e.Bytes()), false, nil
+		})
+		if err != nil || len(ls) != 2 || ls[1] != "second" {
+			t.Errorf("Unexpected entries %v, err: %v", ls, err)
+		}
+
+		if _, err := fapp.Append([]byte("third")); err != ErrReadOnly {
+			t.Errorf("Expected error %v but %v was returned", ErrReadOnly, err)
+		}
+
+		if err := fapp.Close(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func TestMmap(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		Mmap:         true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var offs []int64
+
+	for i := 0; i < 100; i++ {
+		off, err := app.Append([]byte(fmt.Sprintf("entry %d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+
+		// Reads between appends remap the growing file
+		e, err := app.Read(off)
+		if err != nil || string(e.Bytes()) != fmt.Sprintf("entry %d", i) {
+			t.Fatalf("Unexpected entry %v, err: %v", e, err)
+		}
+	}
+
+	i := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if e.Offset() != offs[i] || string(e.Bytes()) != fmt.Sprintf("entry %d", i) {
+			return true, fmt.Errorf("unexpected entry %v", e)
+		}
+		i++
+		return false, nil
+	})
+	if err != nil || i != 100 {
+		t.Errorf("Unexpected error %v after %d entries", err, i)
+	}
+
+	if runtime.GOOS == "linux" && len(app.mmaps) == 0 {
+		t.Errorf("Expected file to be mapped")
+	}
+
+	first, err := app.Read(offs[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	last, err := app.Read(offs[99])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.Truncate(offs[50]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.TruncateHead(offs[10]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Entries returned by Read remain valid once the mapped file shrinks
+	if string(first.Bytes()) != "entry 0" || string(last.Bytes()) != "entry 99" {
+		t.Errorf("Unexpected entries %q and %q", first.Bytes(), last.Bytes())
+	}
+
+	n, err := Fold(app, func(e *Entry, n int) (int, bool, error) {
+		return n + 1, false, nil
+	}, 0)
+	if err != nil || n != 40 {
+		t.Errorf("Unexpected count %d, err: %v", n, err)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Transactions: true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte("first")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	tx, err := app.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tx.Append([]byte("discarded"))
+	tx.Rollback()
+
+	if _, err := tx.Commit(); err != ErrTxDone {
+		t.Errorf("Expected error %v but %v was returned", ErrTxDone, err)
+	}
+
+	tx, _ = app.Begin()
+
+	// Buffers can be reused once appended to the transaction
+	buf := make([]byte, 1)
+	for _, c := range "abc" {
+		buf[0] = byte(c)
+		if err := tx.Append(buf); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	buf[0] = 'z'
+
+	offs, err := tx.Commit()
+	if err != nil || len(offs) != 3 {
+		t.Fatalf("Unexpected offsets %v, err: %v", offs, err)
+	}
+
+	for i, off := range offs {
+		e, err := app.Read(off)
+		if err != nil || string(e.Bytes()) != "abc"[i:i+1] {
+			t.Errorf("Expected entry %q at offset %d, err: %v", "abc"[i:i+1], off, err)
+		}
+	}
+
+	committed := app.size
+
+	tx, _ = app.Begin()
+	tx.Append([]byte("d"))
+	tx.Append([]byte("e"))
+	if _, err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	// Simulate a crash before the commit marker of the last transaction was written
+	fi, _ := os.Stat("test_file.aof")
+	if err := os.Truncate("test_file.aof", fi.Size()-2); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	roCfg := *cfg
+	roCfg.ReadOnly = true
+
+	ro, err := OpenWithConfig("test_file.aof", &roCfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if ro.size != committed {
+		t.Errorf("Expected size %d but %d was found", committed, ro.size)
+	}
+	ro.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	ls, err := Map(app, func(e *Entry) (string, bool, error) {
+		return string(e.Bytes()), e.Incomplete(), nil
+	})
+	if err != nil || len(ls) != 4 || ls[3] != "c" {
+		t.Errorf("Unexpected entries %v, err: %v", ls, err)
+	}
+
+	fi, _ = os.Stat("test_file.aof")
+	if fi.Size() != app.dataOffset+committed {
+		t.Errorf("Expected uncommitted transaction to be removed")
+	}
+
+	plain, err := Open("test_file_plain.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_plain.aof")
+	defer plain.Close()
+
+	if _, err := plain.Begin(); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	src := "*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n" +
+		"#TS:1700000000\r\n" +
+		"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nva\r\nl\r\n"
+
+	n, err := app.ImportRedis(strings.NewReader(src))
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected count %d, err: %v", n, err)
+	}
+
+	e, err := app.Read(0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	args, err := e.RedisCommand()
+	if err != nil || len(args) != 2 || string(args[0]) != "SELECT" {
+		t.Errorf("Unexpected command %q, err: %v", args, err)
+	}
+
+	var buf bytes.Buffer
+	if err := app.ExportRedis(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if buf.String() != strings.Replace(src, "#TS:1700000000\r\n", "", 1) {
+		t.Errorf("Unexpected export %q", buf.String())
+	}
+
+	if _, err := app.ImportRedis(strings.NewReader("*1\r\n$3\r\nGET\r\n*1\r\n$9\r\nGET\r\n")); err != ErrInvalidRESP {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidRESP, err)
+	}
+}
+
+func TestConsumers(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer os.Remove("test_file.aof" + consumersExt)
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.Append([]byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	cs, err := app.Consumers()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	it, err := cs.Resume("first")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if err := cs.Commit("first", it.Cursor()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := cs.Commit("second", Cursor{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	cs, err = app.Consumers()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if names := cs.Names(); len(names) != 2 || names[0] != "first" {
+		t.Errorf("Unexpected consumers %v", names)
+	}
+
+	entries, bytes, err := cs.Lag("first")
+	if err != nil || entries != 6 || bytes != app.size-it.Cursor().Offset {
+		t.Errorf("Unexpected lag %d entries %d bytes, err: %v", entries, bytes, err)
+	}
+
+	it, err = cs.Resume("first")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := it.Next()
+	if err != nil || e.Bytes()[0] != 4 {
+		t.Errorf("Unexpected entry %v, err: %v", e, err)
+	}
+
+	if err := cs.Remove("second"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, ok := cs.Cursor("second"); ok {
+		t.Errorf("Expected consumer to be removed")
+	}
+}
+
+func TestConsumersCommitEntry(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Sequences = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer os.Remove("test_file.aof" + consumersExt)
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cs, err := app.Consumers()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(offs[1])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := cs.CommitEntry("consumer", e); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := os.Stat("test_file.aof" + consumersExt + compactExt); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file to be removed, err: %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	cs, err = app.Consumers()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if cur, ok := cs.Cursor("consumer"); !ok || cur.Offset != offs[2] || cur.Seq != 2 {
+		t.Errorf("Unexpected cursor %+v", cur)
+	}
+
+	it, err := cs.Resume("consumer")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err = it.Next()
+	if err != nil || string(e.Bytes()) != "third" {
+		t.Errorf("Unexpected entry %v, err: %v", e, err)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		Sequences:    true,
+	}
+
+	leader, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer leader.Close()
+
+	follower, err := OpenWithConfig("test_file_follower.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_follower.aof")
+	defer follower.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := leader.Append([]byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if err := leader.TruncateHead(3 * leader.frameLen(1)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	replicate := func(n int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		lc, fc := net.Pipe()
+
+		done := make(chan error, 2)
+		go func() { done <- leader.ServeReplica(ctx, lc) }()
+		go func() { done <- follower.Replicate(ctx, fc) }()
+
+		for i := 0; i < n; i++ {
+			if _, err := leader.Append([]byte{byte(10 + i)}); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			follower.mux.Lock()
+			size := follower.size
+			follower.mux.Unlock()
+
+			leader.mux.Lock()
+			lsize := leader.size
+			leader.mux.Unlock()
+
+			if size == lsize {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Follower did not catch up, size %d instead of %d", size, lsize)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		cancel()
+		lc.Close()
+		<-done
+		<-done
+	}
+
+	replicate(5)
+	replicate(5)
+
+	expected, _ := Map(leader, func(e *Entry) (uint64, bool, error) {
+		return e.Seq(), false, nil
+	})
+
+	replicated, err := Map(follower, func(e *Entry) (uint64, bool, error) {
+		return e.Seq(), false, nil
+	})
+	if err != nil || len(replicated) != 17 || len(replicated) != len(expected) || replicated[16] != expected[16] {
+		t.Errorf("Unexpected entries %v instead of %v, err: %v", replicated, expected, err)
+	}
+
+	e, err := follower.Read(follower.head)
+	if err != nil || e.Bytes()[0] != 3 {
+		t.Errorf("Unexpected entry %v, err: %v", e, err)
+	}
+}
+
+func TestReplicationTruncate(t *testing.T) {
+	leader, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer leader.Close()
+
+	follower, err := Open("test_file_follower.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_follower.aof")
+	defer follower.Close()
+
+	offs, err := leader.AppendBulk([][]byte{randomBytes(10), randomBytes(10)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lc, fc := net.Pipe()
+	defer lc.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- leader.ServeReplica(ctx, lc) }()
+	go follower.Replicate(ctx, fc)
+
+	for follower.Size() != leader.Size() {
+		if ctx.Err() != nil {
+			t.Fatalf("Follower did not catch up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := leader.Truncate(offs[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := leader.Append(randomBytes(36)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := <-served; err != ErrStaleCursor {
+		t.Errorf("Expected error %v but %v was returned", ErrStaleCursor, err)
+	}
+	lc.Close()
+
+	// The follower holds an entry the leader removed, so it is not replicated to anymore
+	lc, fc = net.Pipe()
+	defer lc.Close()
+
+	go leader.ServeReplica(ctx, lc)
+
+	if err := follower.Replicate(ctx, fc); !errors.Is(err, ErrReplicationRejected) {
+		t.Errorf("Expected error %v but %v was returned", ErrReplicationRejected, err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		Checksum:      true,
+		EncryptionKey: []byte("0123456789abcdef"),
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.Append([]byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := app.Backup(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append([]byte("after backup")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := Restore(bytes.NewReader(buf.Bytes()), "test_file_restored.aof", cfg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_restored.aof")
+
+	restored, err := OpenWithConfig("test_file_restored.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	n, err := Fold(restored, func(e *Entry, n int) (int, bool, error) {
+		return n + 1, false, nil
+	}, 0)
+	if err != nil || n != 10 {
+		t.Errorf("Unexpected count %d, err: %v", n, err)
+	}
+	restored.Close()
+
+	if err := Restore(bytes.NewReader(buf.Bytes()), "test_file_restored.aof", cfg); !os.IsExist(err) {
+		t.Errorf("Expected error %v but %v was returned", os.ErrExist, err)
+	}
+
+	corrupted := append([]byte(nil), buf.Bytes()...)
+	corrupted[len(corrupted)-3] ^= 0xff
+
+	if err := Restore(bytes.NewReader(corrupted), "test_file_corrupted.aof", cfg); !errors.Is(err, ErrCorruptedEntry) {
+		t.Errorf("Expected error %v but %v was returned", ErrCorruptedEntry, err)
+	}
+
+	err = Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), "test_file_corrupted.aof", cfg)
+	if !errors.Is(err, ErrLastEntryIncomplete) {
+		t.Errorf("Expected error %v but %v was returned", ErrLastEntryIncomplete, err)
+	}
+
+	if _, err := os.Stat("test_file_corrupted.aof"); !os.IsNotExist(err) {
+		t.Errorf("Expected invalid backups not to be restored")
+		os.Remove("test_file_corrupted.aof")
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Timestamps:   true,
+		Types:        true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := app.AppendTyped(uint8(i), []byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := app.ExportJSONL(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 5 {
+		t.Errorf("Expected 5 lines but %d were written", lines)
+	}
+
+	imported, err := OpenWithConfig("test_file_imported.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_imported.aof")
+	defer imported.Close()
+
+	n, err := imported.ImportJSONL(&buf)
+	if err != nil || n != 5 {
+		t.Fatalf("Unexpected count %d, err: %v", n, err)
+	}
+
+	e, err := app.Read(0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ie, err := imported.Read(0)
+	if err != nil || ie.Type() != e.Type() || !ie.Timestamp().Equal(e.Timestamp()) || !bytes.Equal(ie.Bytes(), e.Bytes()) {
+		t.Errorf("Unexpected entry %v instead of %v, err: %v", ie, e, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	counters := &Counters{}
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		SyncPolicy:   SyncAlways,
+		Metrics:      counters,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.ForEach(func(e *Entry) (bool, error) { return false, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	s := counters.Snapshot()
+
+	if s.Appends != 1 || s.Entries != 2 || s.Bytes != 11 || s.Syncs != 1 || s.Scans != 2 || s.Scanned != 2 {
+		t.Errorf("Unexpected metrics %+v", s)
+	}
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]int64
+	err   error
+}
+
+func (s *testSpan) SetAttribute(key string, value int64) {
+	s.attrs[key] = value
+}
+
+func (s *testSpan) End(err error) {
+	s.err = err
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &testSpan{name: name, attrs: make(map[string]int64)}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &testTracer{}
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Tracer:       tracer,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.AppendContext(context.Background(), nil); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	if err := app.ForEach(func(e *Entry) (bool, error) { return false, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Unexpected spans %v", tracer.spans)
+	}
+
+	s := tracer.spans[0]
+	if s.name != "aof.AppendBulk" || s.attrs["aof.entries"] != 2 || s.attrs["aof.bytes"] != 11 || s.err != nil {
+		t.Errorf("Unexpected span %+v", s)
+	}
+
+	if tracer.spans[1].err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was recorded", ErrInvalidArguments, tracer.spans[1].err)
+	}
+
+	if s := tracer.spans[2]; s.name != "aof.Fold" || s.attrs["aof.entries"] != 2 {
+		t.Errorf("Unexpected span %+v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	stats, err := app.Stats()
+	if err != nil || stats.Entries != 0 || stats.LastOffset != -1 || stats.BufferSize == 0 {
+		t.Errorf("Unexpected stats %+v, err: %v", stats, err)
+	}
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Partially written entry
+	app.f.Write([]byte{10, 0, 1, 2})
+	app.Close()
+
+	if _, err := app.Stats(); err != ErrAppenderClosed {
+		t.Errorf("Expected error %v but %v was returned", ErrAppenderClosed, err)
+	}
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	stats, err = app.Stats()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if stats.Entries != 4 || stats.Bytes != app.size || stats.Incomplete != 1 || stats.Repairs != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if r := app.RecoveryReport(); r == nil || r.Offset != stats.LastOffset || r.Action != RecoveryPadded || r.Transaction {
+		t.Errorf("Unexpected recovery report %v", r)
+	}
+
+	if stats.LastOffset <= offs[2] {
+		t.Errorf("Expected last offset after %d but %d was returned", offs[2], stats.LastOffset)
+	}
+
+	app.PublishExpvar("aof_test_stats")
+
+	if v := expvar.Get("aof_test_stats"); v == nil || !strings.Contains(v.String(), `"Entries":4`) {
+		t.Errorf("Unexpected expvar %v", v)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Logger:       slog.New(slog.NewTextHandler(&buf, nil)),
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte("first")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Partially written entry
+	app.f.Write([]byte{10, 0, 1, 2})
+	app.Close()
+
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected log %q", buf.String())
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "incomplete last entry padded") {
+		t.Errorf("Expected recovery to be logged but %q was logged", buf.String())
+	}
+
+	// Writes fail once the file is closed underneath the appender
+	app.f.Close()
+
+	if _, err := app.Append([]byte("second")); err != ErrUnexpectedWriteErr {
+		t.Errorf("Expected error %v but %v was returned", ErrUnexpectedWriteErr, err)
+	}
+
+	if !strings.Contains(buf.String(), "closing appender after failure") {
+		t.Errorf("Expected failure to be logged but %q was logged", buf.String())
+	}
+}
+
+func TestEmptyEntries(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte{}); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	app.Close()
+
+	cfg.EmptyEntries = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), nil, []byte("third"), {}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	e, err := app.Read(offs[1])
+	if err != nil || e.Size() != 0 || e.Incomplete() {
+		t.Errorf("Unexpected empty entry, err: %v", err)
+	}
+
+	var values []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		values = append(values, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if strings.Join(values, ",") != "first,,third," {
+		t.Errorf("Unexpected entries %q", values)
+	}
+}
+
+func TestReadEntryBoundary(t *testing.T) {
+	for _, cfg := range []*Config{
+		{IndexInterval: 2},
+		{IndexInterval: 2, VarintSize: true},
+		{IndexInterval: 2, Mmap: true},
+	} {
+		cfg.MaxEntrySize = DefaultMaxEntrySize
+		cfg.BaseOffset = DefaultBaseOffset
+		cfg.Perm = DefaultPerm
+
+		app, err := OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third"), []byte("fourth")})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		for _, off := range offs {
+			if e, err := app.Read(off); err != nil || e.Offset() != off {
+				t.Errorf("Unexpected error %v reading offset %d", err, off)
+			}
+		}
+
+		for _, off := range []int64{offs[0] + 1, offs[1] + 3, offs[3] - 1} {
+			if _, err := app.Read(off); err != ErrNotEntryBoundary {
+				t.Errorf("Expected error %v but %v was returned", ErrNotEntryBoundary, err)
+			}
+
+			if _, err := app.EntryReader(off); err != ErrNotEntryBoundary {
+				t.Errorf("Expected error %v but %v was returned", ErrNotEntryBoundary, err)
+			}
+		}
+
+		r, err := app.NewReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, err := r.Read(offs[3]); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if _, err := r.Read(offs[2] + 2); err != ErrNotEntryBoundary {
+			t.Errorf("Expected error %v but %v was returned", ErrNotEntryBoundary, err)
+		}
+
+		r.Close()
+		app.Close()
+		os.Remove("test_file.aof")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	damaged, err := app.Verify()
+	if err != nil || len(damaged) != 0 {
+		t.Errorf("Unexpected damaged entries %v, err: %v", damaged, err)
+	}
+
+	// Leave a partially written entry and corrupt the payload of the second entry
+	app.f.Write([]byte{10, 0, 1, 2})
+	tail := app.size
+	pos := app.dataOffset + offs[2] - 2
+	app.Close()
+
+	f, err := os.OpenFile("test_file.aof", os.O_WRONLY, DefaultPerm)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	f.WriteAt([]byte{'x'}, pos)
+	f.Close()
+
+	fi, _ := os.Stat("test_file.aof")
+
+	cfg.ReadOnly = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	damaged, err = app.Verify()
+	if err != nil || len(damaged) != 2 {
+		t.Fatalf("Unexpected damaged entries %v, err: %v", damaged, err)
+	}
+
+	if damaged[0].Offset != offs[1] || !errors.Is(damaged[0].Err, ErrCorruptedEntry) {
+		t.Errorf("Unexpected damaged entry %+v", damaged[0])
+	}
+
+	if damaged[1].Offset != tail || damaged[1].Err != ErrLastEntryIncomplete {
+		t.Errorf("Unexpected damaged entry %+v", damaged[1])
+	}
+
+	app.Close()
+
+	if fi2, _ := os.Stat("test_file.aof"); fi2.Size() != fi.Size() || fi2.ModTime() != fi.ModTime() {
+		t.Errorf("Expected file to remain unmodified")
+	}
+
+	cfg.ReadOnly = false
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	damaged, err = app.Verify()
+	if err != nil || len(damaged) != 2 || damaged[1].Offset != tail || damaged[1].Err != ErrIncompleteEntry {
+		t.Errorf("Unexpected damaged entries %v, err: %v", damaged, err)
+	}
+}
+
+func TestRecoverFailTransaction(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Transactions: true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	tx, err := app.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tx.Append([]byte("first"))
+	tx.Append([]byte("second"))
+
+	if _, err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	off, err := app.Append([]byte("third"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	// Drop the commit marker so the transaction is left uncommitted
+	fi, _ := os.Stat("test_file.aof")
+	os.Truncate("test_file.aof", fi.Size()-app.frameLen(len("third"))-app.frameLen(len("second")))
+
+	fi, _ = os.Stat("test_file.aof")
+
+	cfg.Recovery = RecoverFail
+
+	_, err = OpenWithConfig("test_file.aof", cfg)
+
+	var rerr *RecoveryError
+	if !errors.As(err, &rerr) || !rerr.Report.Transaction || rerr.Report.Offset != 0 || rerr.Report.Bytes != off-app.frameLen(len("second")) {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "left unmodified") {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	if fi2, _ := os.Stat("test_file.aof"); fi2.Size() != fi.Size() {
+		t.Errorf("Expected file to remain unmodified")
+	}
+}
+
+func TestReadOnlyNeverWrites(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	off, err := app.Append([]byte("first"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Partially written entry
+	app.f.Write([]byte{10, 0, 1, 2})
+	tail := app.size
+	app.Close()
+
+	before, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := os.Chmod("test_file.aof", 0444); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		ReadOnly:     true,
+		SyncPolicy:   SyncAlways,
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if r := app.RecoveryReport(); r == nil || *r != (RecoveryReport{Offset: tail, Action: RecoveryIgnored, Bytes: 4}) {
+		t.Errorf("Unexpected recovery report %v", r)
+	}
+
+	if e, err := app.Read(off); err != nil || string(e.Bytes()) != "first" {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := app.ForEach(func(e *Entry) (bool, error) { return false, nil }); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := app.Sync(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := app.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	after, err := os.ReadFile("test_file.aof")
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("Expected file to remain unmodified, err: %v", err)
+	}
+}
+
+func TestEntryCache(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		CacheEntries: 2,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, off := range offs {
+			if _, err := app.Read(off); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+	}
+
+	if app.cache.ll.Len() != 2 || app.cache.bytes != int64(len("second")+len("third")) {
+		t.Errorf("Unexpected cache with %d entries and %d bytes", app.cache.ll.Len(), app.cache.bytes)
+	}
+
+	if _, ok := app.cache.get(app.hdr.generation, offs[0]); ok {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+
+	// Entries removed by Truncate must not be served from the cache
+	if err := app.Truncate(offs[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append([]byte("fourth")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(offs[1])
+	if err != nil || string(e.Bytes()) != "fourth" {
+		t.Errorf("Unexpected entry, err: %v", err)
+	}
+
+	cfg.CacheEntries = -1
+	if _, err := OpenWithConfig("test_file_invalid.aof", cfg); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestAppendBulkInvalidEntry(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	size := app.size
+
+	_, err = app.AppendBulk([][]byte{[]byte("first"), randomBytes(DefaultMaxEntrySize + 1)})
+	if err != ErrEntryExceedsMaxSize {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryExceedsMaxSize, err)
+	}
+
+	// Entries of a rejected call are never written
+	off, err := app.Append([]byte("second"))
+	if err != nil || off != size {
+		t.Fatalf("Unexpected offset %d, err: %v", off, err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil || string(e.Bytes()) != "second" {
+		t.Errorf("Unexpected entry, err: %v", err)
+	}
+
+	fi, _ := os.Stat("test_file.aof")
+	if fi.Size() != app.dataOffset+app.size {
+		t.Errorf("Expected file size to be %d but it is %d", app.dataOffset+app.size, fi.Size())
+	}
+}
+
+func TestEntryClone(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		Keyed:         true,
+		EncryptionKey: []byte("0123456789abcdef"),
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for _, kv := range []string{"a=first", "b=second", "c=third"} {
+		if _, err := app.AppendKeyed([]byte(kv[:1]), []byte(kv[2:])); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	var cloned []*Entry
+	err = app.ForEachCloned(func(e *Entry) (bool, error) {
+		cloned = append(cloned, e)
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(cloned) != 3 {
+		t.Fatalf("Expected 3 entries but %d were found", len(cloned))
+	}
+
+	for i, kv := range []string{"a=first", "b=second", "c=third"} {
+		if string(cloned[i].Key()) != kv[:1] || string(cloned[i].Bytes()) != kv[2:] {
+			t.Errorf("Unexpected entry %s=%s", cloned[i].Key(), cloned[i].Bytes())
+		}
+	}
+
+	for _, e := range cloned {
+		e.Release()
+	}
+
+	e, err := app.Read(0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	c := e.Clone()
+	if string(c.Bytes()) != "first" || c.Offset() != 0 {
+		t.Errorf("Unexpected clone %v", c)
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		ReadAhead:    1,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var sizes []int
+	for i := 0; i < 500; i++ {
+		size := 1 + (i*997)%2000
+		if _, err := app.Append(randomBytes(size)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		sizes = append(sizes, size)
+	}
+
+	i := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if e.Size() != sizes[i] {
+			t.Errorf("Expected entry %d to have size %d but it has %d", i, sizes[i], e.Size())
+		}
+		i++
+		return false, nil
+	})
+	if err != nil || i != len(sizes) {
+		t.Errorf("Expected %d entries but %d were found, err: %v", len(sizes), i, err)
+	}
+
+	// Folds stopping early stop reading ahead
+	i = 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		i++
+		return i == 3, nil
+	})
+	if err != nil || i != 3 {
+		t.Errorf("Expected 3 entries but %d were found, err: %v", i, err)
+	}
+}
+
+func TestDirectIO(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		DirectIO:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Skipf("Direct I/O is not supported: %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	var offs []int64
+	var entries [][]byte
+
+	for i := 0; i < 100; i++ {
+		bs := randomBytes(1 + (i*1499)%9000)
+
+		off, err := app.Append(bs)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		offs = append(offs, off)
+		entries = append(entries, bs)
+	}
+
+	for i, off := range offs {
+		e, err := app.Read(off)
+		if err != nil || !bytes.Equal(e.Bytes(), entries[i]) {
+			t.Fatalf("Unexpected entry at offset %d, err: %v", off, err)
+		}
+	}
+
+	if err := app.Truncate(offs[50]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append(entries[50]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	fi, _ := os.Stat("test_file.aof")
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.dataOffset+app.size != fi.Size() {
+		t.Errorf("Expected size %d but %d was found", fi.Size(), app.dataOffset+app.size)
+	}
+
+	i := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if !bytes.Equal(e.Bytes(), entries[i]) {
+			t.Errorf("Unexpected entry %d", i)
+		}
+		i++
+		return false, nil
+	})
+	if err != nil || i != 51 {
+		t.Errorf("Expected 51 entries but %d were found, err: %v", i, err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Timestamps:   true,
+		EntryTTL: func(e *Entry) time.Duration {
+			if e.Bytes()[0] == 'x' {
+				return time.Nanosecond
+			}
+			return 0
+		},
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("x1"), []byte("kept"), []byte("x2")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	e, err := app.Read(offs[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !app.Expired(e) {
+		t.Errorf("Expected entry to be expired")
+	}
+
+	app.Close()
+
+	cfg.SkipExpired = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if _, err := app.Read(offs[2]); err != ErrEntryExpired {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryExpired, err)
+	}
+
+	var seen []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		seen = append(seen, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(seen) != 1 || seen[0] != "kept" {
+		t.Errorf("Expected only the unexpired entry but %v was read", seen)
+	}
+
+	it, err := app.Iterator(0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err = it.Next()
+	if err != nil || string(e.Bytes()) != "kept" {
+		t.Errorf("Expected the unexpired entry but %v was returned", err)
+	}
+	it.Close()
+
+	offsets, err := app.PurgeExpired()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(offsets) != 1 {
+		t.Errorf("Expected 1 entry to be kept but %d were kept", len(offsets))
+	}
+
+	e, err = app.Read(offsets[offs[1]])
+	if err != nil || string(e.Bytes()) != "kept" {
+		t.Errorf("Expected the unexpired entry but %v was returned", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+		Tombstones:   true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	tomb, err := app.Delete(offs[1])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Delete(offs[1]); err != ErrEntryDeleted {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryDeleted, err)
+	}
+
+	if _, err := app.Delete(tomb); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	e, err := app.Read(tomb)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if off, ok := e.Tombstone(); !ok || off != offs[1] {
+		t.Errorf("Expected tombstone of %d but %d was returned", offs[1], off)
+	}
+
+	app.Close()
+
+	cfg.SkipDeleted = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if !app.Deleted(offs[1]) {
+		t.Errorf("Expected entry to be deleted after reopening")
+	}
+
+	if _, err := app.Read(offs[1]); err != ErrEntryDeleted {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryDeleted, err)
+	}
+
+	var seen []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		seen = append(seen, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(seen) != 2 || seen[0] != "first" || seen[1] != "third" {
+		t.Errorf("Expected deleted entries to be skipped but %v was read", seen)
+	}
+
+	offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) {
+		return true, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(offsets) != 2 {
+		t.Errorf("Expected 2 entries to be kept but %d were kept", len(offsets))
+	}
+
+	if app.Deleted(offs[1]) {
+		t.Errorf("Expected no deleted entries after compaction")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.Append([]byte("before")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	received := make(chan string, 3)
+
+	s, err := app.Subscribe(func(e *Entry) {
+		received <- string(e.Bytes())
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append([]byte("third")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, expected := range []string{"first", "second", "third"} {
+		select {
+		case got := <-received:
+			if got != expected {
+				t.Errorf("Expected %s but %s was received", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s to be received", expected)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	select {
+	case <-s.Done():
+	default:
+		t.Errorf("Expected subscription to be done")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	errRejected := errors.New("rejected")
+
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		AppendHooks: []HookFn{
+			func(bs []byte) ([]byte, error) {
+				if bytes.Equal(bs, []byte("invalid")) {
+					return nil, errRejected
+				}
+				return bs, nil
+			},
+			func(bs []byte) ([]byte, error) {
+				return append([]byte("<"), bs...), nil
+			},
+		},
+		ReadHooks: []HookFn{
+			func(bs []byte) ([]byte, error) {
+				return bytes.TrimPrefix(bs, []byte("<")), nil
+			},
+		},
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{[]byte("valid"), []byte("invalid")}); err != errRejected {
+		t.Errorf("Expected error %v but %v was returned", errRejected, err)
+	}
+
+	off, err := app.Append([]byte("entry"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if off != 0 {
+		t.Errorf("Expected rejected entries not to be written")
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if string(e.Bytes()) != "entry" {
+		t.Errorf("Expected entry but %s was read", e.Bytes())
+	}
+
+	if e.Size() != len("entry") {
+		t.Errorf("Expected size %d but %d was returned", len("entry"), e.Size())
+	}
+
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if string(e.Bytes()) != "entry" {
+			t.Errorf("Expected entry but %s was read", e.Bytes())
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) {
+		return true, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err = app.Read(offsets[off])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if string(e.Bytes()) != "entry" {
+		t.Errorf("Expected compaction to keep stored content but %s was read", e.Bytes())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		RateLimitOps: 10,
+		Backpressure: BackpressureFail,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.Append([]byte("entry")); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := app.Append([]byte("entry")); err != ErrRateLimited {
+		t.Errorf("Expected error %v but %v was returned", ErrRateLimited, err)
+	}
+
+	app.Close()
+
+	cfg.RateLimitOps = 0
+	cfg.RateLimitBytes = 1000
+	cfg.Backpressure = BackpressureBlock
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, err := app.Append(make([]byte, 500)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected appends to be throttled but they took %v", elapsed)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		MaxSize:      50,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendBulk([][]byte{make([]byte, 20), make([]byte, 20)}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append(make([]byte, 20)); err != ErrQuotaExceeded {
+		t.Errorf("Expected error %v but %v was returned", ErrQuotaExceeded, err)
+	}
+
+	if _, err := app.Append(make([]byte, 1)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestStatsPayload(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize: DefaultMaxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		PersistIndex: true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer os.Remove(indexFilename("test_file.aof"))
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Partially written entry, padded on Open
+	app.f.Write([]byte{10, 0, 1, 2})
+	app.Close()
+
+	for i := 0; i < 2; i++ {
+		app, err = OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		stats, err := app.Stats()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if stats.PayloadBytes != 5+6+10 || stats.FramingBytes != stats.Bytes-stats.PayloadBytes {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+
+		if len(stats.IncompleteOffsets) != 1 || stats.IncompleteOffsets[0] != stats.LastOffset {
+			t.Errorf("Expected incomplete entry at %d but %v was returned", stats.LastOffset, stats.IncompleteOffsets)
+		}
+
+		app.Close()
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if _, err := app.Append([]byte("third")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	stats, err := app.Stats()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if stats.PayloadBytes != 5+6+10+5 {
+		t.Errorf("Expected %d payload bytes but %d were returned", 5+6+10+5, stats.PayloadBytes)
+	}
+}
+
+func TestCount(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if n := app.Count(); n != 0 {
+		t.Errorf("Expected 0 entries but %d were counted", n)
+	}
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if n := app.Count(); n != 3 {
+		t.Errorf("Expected 3 entries but %d were counted", n)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if n := app.Count(); n != 3 {
+		t.Errorf("Expected 3 entries but %d were counted", n)
+	}
+
+	if err := app.TruncateHead(offs[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if n := app.Count(); n != 2 {
+		t.Errorf("Expected 2 entries but %d were counted", n)
+	}
+}
+
+func TestExtent(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if app.Size() != 0 || app.FirstOffset() != -1 || app.LastOffset() != -1 {
+		t.Errorf("Unexpected extent of empty appender")
+	}
+
+	if _, err := app.LastEntry(); err != ErrNoEntries {
+		t.Errorf("Expected error %v but %v was returned", ErrNoEntries, err)
+	}
+
+	offs, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.FirstOffset() != offs[0] || app.LastOffset() != offs[2] || app.Size() != app.size {
+		t.Errorf("Unexpected extent %d %d %d", app.FirstOffset(), app.LastOffset(), app.Size())
+	}
+
+	e, err := app.LastEntry()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if string(e.Bytes()) != "third" {
+		t.Errorf("Expected third but %s was read", e.Bytes())
+	}
+
+	if err := app.TruncateHead(offs[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if app.FirstOffset() != offs[1] {
+		t.Errorf("Expected first offset %d but %d was returned", offs[1], app.FirstOffset())
+	}
+
+	if err := app.Truncate(offs[2]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if app.LastOffset() != offs[1] {
+		t.Errorf("Expected last offset %d but %d was returned", offs[1], app.LastOffset())
+	}
+}
+
+func TestReadLastN(t *testing.T) {
+	cfg := &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		Perm:          DefaultPerm,
+		IndexInterval: 4,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.ReadLast(); err != ErrNoEntries {
+		t.Errorf("Expected error %v but %v was returned", ErrNoEntries, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.Append([]byte{byte(i)}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	e, err := app.ReadLast()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if e.Bytes()[0] != 9 {
+		t.Errorf("Expected last entry but %v was read", e.Bytes())
+	}
+
+	es, err := app.ReadLastN(6)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(es) != 6 {
+		t.Fatalf("Expected 6 entries but %d were read", len(es))
+	}
+
+	for i, e := range es {
+		if e.Bytes()[0] != byte(4+i) {
+			t.Errorf("Expected entry %d but %v was read", 4+i, e.Bytes())
+		}
+	}
+
+	es, err = app.ReadLastN(20)
+	if err != nil || len(es) != 10 {
+		t.Errorf("Expected every entry to be read but %d were read, err: %v", len(es), err)
+	}
+
+	if _, err := app.ReadLastN(0); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestAppendFrom(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		cfg := &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+			Checksum:     checksum,
+			Timestamps:   true,
+		}
+
+		app, err := OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		bs := randomBytes(1000)
+
+		off, err := app.AppendFrom(bytes.NewReader(bs), len(bs))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		e, err := app.Read(off)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if !bytes.Equal(e.Bytes(), bs) || e.Timestamp().IsZero() {
+			t.Errorf("Unexpected entry %v", e)
+		}
+
+		_, err = app.AppendFrom(bytes.NewReader(bs[:10]), 100)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected error %v but %v was returned", io.ErrUnexpectedEOF, err)
+		}
+
+		next, err := app.Append([]byte("next"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		app.Close()
+
+		app, err = OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		e, err = app.Read(next)
+		if err != nil || string(e.Bytes()) != "next" {
+			t.Errorf("Expected next entry but %v was returned", err)
+		}
+
+		if n := app.Count(); !checksum && n != 3 || checksum && n != 2 {
+			t.Errorf("Unexpected number of entries %d", n)
+		}
+
+		app.Close()
+		os.Remove("test_file.aof")
+	}
+}
+
+func TestLargeEntries(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("Entries above 4GiB need 64-bit ints")
+	}
+
+	shift := 33
+	maxEntrySize := 1 << shift
+
+	cfg := &Config{
+		MaxEntrySize: maxEntrySize,
+		BaseOffset:   DefaultBaseOffset,
+		Perm:         DefaultPerm,
+		Checksum:     true,
+	}
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	bs := randomBytes(200 << 10)
+
+	off, err := app.Append(bs)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", &Config{MaxEntrySize: DefaultMaxEntrySize, Perm: DefaultPerm})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.Config().MaxEntrySize != maxEntrySize || len(app.sharedMem.bufRWEntrySize) != 8 {
+		t.Errorf("Expected 8 byte sizes and max entry size %d but %d was read", maxEntrySize, app.Config().MaxEntrySize)
+	}
+
+	e, err := app.Read(off)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !bytes.Equal(e.Bytes(), bs) {
+		t.Errorf("Expected large entry to be read back")
+	}
+
+	n := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		n++
+		if !bytes.Equal(e.Bytes(), bs) {
+			t.Errorf("Expected large entry to be read back")
+		}
+		return false, nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 entry but %d were read, err: %v", n, err)
+	}
+}
+
+func TestCorruptedSize(t *testing.T) {
+	shift := 33
+
+	cfgs := []*Config{
+		{MaxEntrySize: 1000, Perm: DefaultPerm},
+		{MaxEntrySize: 1 << shift, Perm: DefaultPerm},
+	}
+
+	// Entries above 4GiB need 64-bit ints
+	if strconv.IntSize < 64 {
+		cfgs = cfgs[:1]
+	}
+
+	for _, cfg := range cfgs {
+		app, err := OpenWithConfig("test_file.aof", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		sizeLen := len(app.sharedMem.bufRWEntrySize)
+		pos := app.dataOffset + app.frameLen(len("first"))
+		end := pos + app.frameLen(len("second"))
+		app.Close()
+
+		// Flip the top byte of the size of the second entry
+		f, err := os.OpenFile("test_file.aof", os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		f.WriteAt([]byte{0xff}, pos+int64(sizeLen)-1)
+		f.Close()
+
+		app, err = OpenWithConfig("test_file.aof", cfg)
+		if !errors.Is(err, ErrCorruptedEntry) {
+			t.Errorf("Expected ErrCorruptedEntry but %v was returned instead", err)
+		}
+		if app != nil {
+			app.Close()
+		}
+
+		fi, _ := os.Stat("test_file.aof")
+		if fi.Size() != end {
+			t.Errorf("Expected file not to be padded, size is %d", fi.Size())
+		}
+
+		os.Remove("test_file.aof")
+	}
+}
+
+func TestOpenWithOptions(t *testing.T) {
+	app, err := OpenWithOptions("test_file.aof", WithMaxEntrySize(10), WithChecksum(), WithPerm(0600))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append(make([]byte, 11)); err != ErrEntryExceedsMaxSize {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryExceedsMaxSize, err)
+	}
+
+	off, err := app.Append([]byte("entry"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	fi, err := os.Stat("test_file.aof")
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600 but %v was found, err: %v", fi.Mode().Perm(), err)
+	}
+
+	app, err = OpenWithOptions("test_file.aof", WithReadOnly(), WithConfig(func(cfg *Config) {
+		cfg.NoLock = true
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if cfg := app.Config(); !cfg.Checksum || !cfg.ReadOnly || !cfg.NoLock {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	if _, err := app.Append([]byte("entry")); err != ErrReadOnly {
+		t.Errorf("Expected error %v but %v was returned", ErrReadOnly, err)
+	}
+
+	if _, err := app.Read(off); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	f, err := os.OpenFile("test_file.aof", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer f.Close()
+
+	app, err := OpenFile(f, defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var offs []int64
+	for i := 0; i < 3; i++ {
+		off, err := app.Append([]byte(fmt.Sprintf("entry%d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	if err := app.Truncate(offs[2]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return true, nil, nil }); err != ErrUnsupported {
+		t.Errorf("Expected error %v but %v was returned", ErrUnsupported, err)
+	}
+
+	if err := app.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// The file is still open after the appender is closed
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if n := app.Count(); n != 2 {
+		t.Errorf("Expected 2 entries but %d were found", n)
+	}
+
+	e, err := app.Read(offs[1])
+	if err != nil || string(e.Bytes()) != "entry1" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+}
+
+func TestOpenRW(t *testing.T) {
+	rw := &memFile{}
+
+	app, err := OpenRW(rw, defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var offs []int64
+	for i := 0; i < 3; i++ {
+		off, err := app.Append([]byte(fmt.Sprintf("entry%d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	if err := app.TruncateHead(offs[1]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	it, err := app.Iterator(offs[1])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := 1; i < 3; i++ {
+		e, err := it.Next()
+		if err != nil || string(e.Bytes()) != fmt.Sprintf("entry%d", i) {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+	}
+	it.Close()
+
+	if _, err := app.Consumers(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenRW(rw, defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if app.FirstOffset() != offs[1] {
+		t.Errorf("Expected first offset %d but %d was returned", offs[1], app.FirstOffset())
+	}
+
+	e, err := app.Read(offs[2])
+	if err != nil || string(e.Bytes()) != "entry2" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+}
+
+func TestOpenMemory(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxEntrySize = 16
+
+	app, err := OpenMemory(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if _, err := app.Append(make([]byte, 17)); err != ErrEntryExceedsMaxSize {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryExceedsMaxSize, err)
+	}
+
+	off, err := app.Append([]byte("entry"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil || string(e.Bytes()) != "entry" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	if _, err := app.AppendFrom(bytes.NewReader([]byte("part")), 8); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected error %v but %v was returned", io.ErrUnexpectedEOF, err)
+	}
+
+	e, err = app.Read(app.LastOffset())
+	if err != nil || !e.Incomplete() {
+		t.Errorf("Expected an incomplete entry, err: %v", err)
+	}
+}
+
+func TestSyncWrites(t *testing.T) {
+	if _, err := OpenWithOptions("test_file.aof", WithSyncWrites(SyncWritesAll+1)); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	for _, s := range []SyncWrites{SyncWritesData, SyncWritesAll} {
+		app, err := OpenWithOptions("test_file.aof", WithSyncWrites(s))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		off, err := app.Append([]byte("entry"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, err := app.Append([]byte("dropped")); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) {
+			return string(e.Bytes()) == "entry", nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, err := app.Append([]byte("next")); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		e, err := app.Read(offsets[off])
+		if err != nil || string(e.Bytes()) != "entry" {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+
+		app.Close()
+		os.Remove("test_file.aof")
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.FlushInterval = 50 * time.Millisecond
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("entry0"), []byte("entry1")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if n := app.Count(); n != 0 {
+		t.Errorf("Expected buffered entries not to be visible but %d were found", n)
+	}
+
+	if err := app.Sync(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if n := app.Count(); n != 2 {
+		t.Errorf("Expected 2 entries but %d were found", n)
+	}
+
+	off, err := app.Append([]byte("entry2"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if off <= offs[1] {
+		t.Errorf("Unexpected offset %d", off)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for app.LastOffset() != off && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	e, err := app.Read(off)
+	if err != nil || string(e.Bytes()) != "entry2" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	off, err = app.Append([]byte("entry3"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	e, err = app.Read(off)
+	if err != nil || string(e.Bytes()) != "entry3" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.IndexInterval = 3
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.ReadSince(time.Now()); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	app.Close()
+	os.Remove("test_file.aof")
+
+	cfg.Timestamps = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	var ts []time.Time
+	for i := 0; i < 10; i++ {
+		off, err := app.Append([]byte(fmt.Sprintf("entry%d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		e, err := app.Read(off)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		ts = append(ts, e.Timestamp())
+
+		time.Sleep(time.Millisecond)
+	}
+
+	var read []string
+	err = app.ForEachBetween(ts[4], ts[8], func(e *Entry) (bool, error) {
+		read = append(read, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if strings.Join(read, ",") != "entry4,entry5,entry6,entry7" {
+		t.Errorf("Unexpected entries %v", read)
+	}
+
+	it, err := app.ReadSince(ts[7].Add(-time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	for i := 7; i < 10; i++ {
+		e, err := it.Next()
+		if err != nil || string(e.Bytes()) != fmt.Sprintf("entry%d", i) {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+	}
+
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Expected error %v but %v was returned", io.EOF, err)
+	}
+
+	it, err = app.ReadSince(time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer it.Close()
+
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Expected error %v but %v was returned", io.EOF, err)
+	}
+}
+
+// failingRW fails writes once limit bytes were written, after writing as much as allowed
+type failingRW struct {
+	f     *memFile
+	limit int
+}
+
+func (rw *failingRW) Read(b []byte) (int, error) {
+	return rw.f.Read(b)
+}
+
+func (rw *failingRW) Seek(off int64, whence int) (int64, error) {
+	return rw.f.Seek(off, whence)
+}
+
+func (rw *failingRW) Write(b []byte) (int, error) {
+	if len(b) <= rw.limit {
+		rw.limit -= len(b)
+		return rw.f.Write(b)
+	}
+
+	n, _ := rw.f.Write(b[:rw.limit])
+	rw.limit = 0
+
+	return n, errors.New("write failed")
+}
+
+// truncatingRW is a failingRW supporting Truncate
+type truncatingRW struct {
+	*failingRW
+}
+
+func (rw *truncatingRW) Truncate(size int64) error {
+	return rw.f.Truncate(size)
+}
+
+func TestAppendBulkAtomic(t *testing.T) {
+	bss := [][]byte{[]byte("entry0"), []byte("entry1"), []byte("entry2")}
+
+	for _, transactions := range []bool{false, true} {
+		f := &memFile{}
+		frw := &failingRW{f: f, limit: 1 << 20}
+
+		// Without transactions the failed call is rolled back by truncating the file
+		var rw io.ReadWriteSeeker = frw
+		if !transactions {
+			rw = &truncatingRW{failingRW: frw}
+		}
+
+		cfg := defaultConfig()
+		cfg.Transactions = transactions
+
+		app, err := OpenRW(rw, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if _, err := app.AppendBulk(bss); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		size := len(f.b)
+		frw.limit = 20
+
+		if _, err := app.AppendBulk(bss); err != ErrUnexpectedWriteErr {
+			t.Errorf("Expected error %v but %v was returned", ErrUnexpectedWriteErr, err)
+		}
+
+		if !transactions && len(f.b) != size {
+			t.Errorf("Expected the failed call to be rolled back but %d bytes were left", len(f.b)-size)
+		}
+
+		if transactions && len(f.b) != size+20 {
+			t.Errorf("Expected the failed call to be left for recovery but %d bytes were left", len(f.b)-size)
+		}
+
+		app, err = OpenRW(f, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if n := app.Count(); n != int64(len(bss)) {
+			t.Errorf("Expected %d entries but %d were found", len(bss), n)
+		}
+
+		app.Close()
+	}
+}
+
+func TestAppendIdempotent(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.IdempotencyWindow = 50 * time.Millisecond
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	if _, err := app.AppendIdempotent(nil, []byte("entry")); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	off, err := app.AppendIdempotent([]byte("id1"), []byte("entry1"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	retried, err := app.AppendIdempotent([]byte("id1"), []byte("entry1"))
+	if err != nil || retried != off {
+		t.Errorf("Expected offset %d but %d was returned, err: %v", off, retried, err)
+	}
+
+	other, err := app.AppendIdempotent([]byte("id2"), []byte("entry2"))
+	if err != nil || other == off {
+		t.Errorf("Unexpected offset %d, err: %v", other, err)
+	}
+
+	if n := app.Count(); n != 2 {
+		t.Errorf("Expected 2 entries but %d were found", n)
+	}
+
+	time.Sleep(cfg.IdempotencyWindow)
+
+	late, err := app.AppendIdempotent([]byte("id1"), []byte("entry1"))
+	if err != nil || late == off {
+		t.Errorf("Unexpected offset %d, err: %v", late, err)
+	}
+
+	if n := app.Count(); n != 3 {
+		t.Errorf("Expected 3 entries but %d were found", n)
+	}
+}
+
+func TestAppendVersioned(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.AppendVersioned(1, []byte("entry")); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	app.Close()
+	os.Remove("test_file.aof")
+
+	cfg := defaultConfig()
+	cfg.Versions = true
+	cfg.Checksum = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	off, err := app.AppendVersioned(1, []byte("v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.AppendBulkVersioned(2, [][]byte{[]byte("v2"), []byte("v2")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append([]byte("v0")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if !app.Config().Versions {
+		t.Errorf("Expected versions to be enabled")
+	}
+
+	e, err := app.Read(off)
+	if err != nil || e.Version() != 1 {
+		t.Errorf("Unexpected entry version %d, err: %v", e.Version(), err)
+	}
+
+	var versions []uint16
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if string(e.Bytes()) != fmt.Sprintf("v%d", e.Version()) {
+			t.Errorf("Unexpected entry %q with version %d", e.Bytes(), e.Version())
+		}
+		versions = append(versions, e.Version())
+		return false, nil
+	})
+	if err != nil || !slices.Equal(versions, []uint16{1, 2, 2, 0}) {
+		t.Errorf("Unexpected versions %v, err: %v", versions, err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Timestamps = true
+	cfg.Tombstones = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("entry0"), []byte("entry1"), []byte("entry2")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Delete(offs[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(offs[2])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	ts := e.Timestamp()
+
+	app.Close()
+
+	dstCfg := defaultConfig()
+	dstCfg.MaxEntrySize = 1 << 20
+	dstCfg.Checksum = true
+	dstCfg.VarintSize = true
+	dstCfg.Timestamps = true
+
+	offsets, err := Migrate("test_file.aof", "test_file_migrated.aof", defaultConfig(), dstCfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_migrated.aof")
+
+	if len(offsets) != 2 {
+		t.Errorf("Expected 2 migrated entries but %d were migrated", len(offsets))
+	}
+
+	if _, err := Migrate("test_file.aof", "test_file_migrated.aof", defaultConfig(), dstCfg); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected error %v but %v was returned", os.ErrExist, err)
+	}
+
+	app, err = Open("test_file_migrated.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if cfg := app.Config(); cfg.MaxEntrySize != 1<<20 || !cfg.Checksum || !cfg.VarintSize || cfg.Tombstones {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	e, err = app.Read(offsets[offs[2]])
+	if err != nil || string(e.Bytes()) != "entry2" || !e.Timestamp().Equal(ts) {
+		t.Errorf("Unexpected entry %q at %v, err: %v", e.Bytes(), e.Timestamp(), err)
+	}
+
+	if _, ok := offsets[offs[1]]; ok {
+		t.Errorf("Expected deleted entry not to be migrated")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+
+	cfg := defaultConfig()
+	cfg.EncryptionKey = key1
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	off1, err := app.Append([]byte("entry1"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.RotateKey(key2); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	off2, err := app.Append([]byte("entry2"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for off, payload := range map[int64]string{off1: "entry1", off2: "entry2"} {
+		e, err := app.Read(off)
+		if err != nil || string(e.Bytes()) != payload {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+	}
+
+	app.Close()
+
+	cfg.EncryptionKey = key2
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var cerr *CorruptedEntryError
+	if _, err := app.Read(off1); !errors.As(err, &cerr) {
+		t.Errorf("Expected a corrupted entry error but %v was returned", err)
+	}
+
+	app.Close()
+
+	cfg.PreviousEncryptionKeys = [][]byte{key1}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	offsets, err := app.Compact(func(e *Entry) (bool, []byte, error) { return true, nil, nil })
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	cfg.PreviousEncryptionKeys = nil
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	for off, payload := range map[int64]string{offsets[off1]: "entry1", offsets[off2]: "entry2"} {
+		e, err := app.Read(off)
+		if err != nil || string(e.Bytes()) != payload {
+			t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+		}
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	key := []byte("signing key")
+
+	cfg := defaultConfig()
+	cfg.SigningKey = key
+	cfg.Checksum = true
+	cfg.Timestamps = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	off, err := app.Append([]byte("entry"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil || string(e.Bytes()) != "entry" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	app.Close()
+
+	if _, err := Open("test_file.aof"); err != ErrSigningKey {
+		t.Errorf("Expected error %v but %v was returned", ErrSigningKey, err)
+	}
+
+	cfg.SigningKey = []byte("another key")
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Read(off); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidSignature, err)
+	}
+
+	app.Close()
+
+	// Modify the content and fix its checksum, as done by someone not knowing the signing key
+	data, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	i := bytes.Index(data, []byte("entry"))
+	copy(data[i:], "ENTRY")
+
+	meta := data[i-4-32-8 : i]
+	byteOrder.PutUint32(meta, crc32.Update(crc32.Checksum(meta[4:], crc32cTable), crc32cTable, []byte("ENTRY")))
+
+	if err := os.WriteFile("test_file.aof", data, 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cfg.SigningKey = key
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	var serr *InvalidSignatureError
+	if _, err := app.Read(off); !errors.As(err, &serr) || serr.Offset != off {
+		t.Errorf("Expected an invalid signature error but %v was returned", err)
+	}
+}
+
+func TestSigningKeyIncomplete(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.SigningKey = []byte("signing key")
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("entry"), []byte("other")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	// Modify the content and mark the entry incomplete, so it is not verified
+	data, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	i := bytes.Index(data, []byte("entry"))
+	copy(data[i:], "FORGE")
+	data[i+len("entry")] = fIncompleteEntry
+
+	if err := os.WriteFile("test_file.aof", data, 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	e, err := app.Read(offs[0])
+	if err == nil && (!e.Incomplete() || len(e.Bytes()) > 0) {
+		t.Errorf("Unexpected entry %q", e.Bytes())
+	}
+
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if bytes.Contains(e.Bytes(), []byte("FORGE")) {
+			t.Errorf("Unexpected forged entry at offset %d", e.Offset())
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Chained = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	offs, err := app.AppendBulk([][]byte{[]byte("entry1"), []byte("entry2"), []byte("entry3")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	head, err := app.ChainHead()
+	if err != nil || len(head) != sha256.Size {
+		t.Fatalf("Unexpected chain head %x, err: %v", head, err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if h, err := app.ChainHead(); err != nil || !bytes.Equal(h, head) {
+		t.Errorf("Expected chain head %x but %x was returned, err: %v", head, h, err)
+	}
+
+	off, err := app.Append([]byte("entry4"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.VerifyChain(head); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	last, _ := app.ChainHead()
+
+	if err := app.Truncate(off); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := app.VerifyChain(nil); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	var cerr *BrokenChainError
+	if err := app.VerifyChain(last); !errors.As(err, &cerr) || cerr.Offset != off {
+		t.Errorf("Expected a broken chain at offset %d but %v was returned", off, err)
+	}
+
+	app.Close()
+
+	data, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	i := bytes.Index(data, []byte("entry2"))
+	copy(data[i:], "ENTRY2")
+
+	if err := os.WriteFile("test_file.aof", data, 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if err := app.VerifyChain(nil); !errors.As(err, &cerr) || cerr.Offset != offs[2] {
+		t.Errorf("Expected a broken chain at offset %d but %v was returned", offs[2], err)
+	}
+
+	if !errors.Is(app.VerifyChain(nil), ErrBrokenChain) {
+		t.Errorf("Expected error %v", ErrBrokenChain)
+	}
+}
+
+func TestTrainDictionary(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	for i := 0; i < 100; i++ {
+		record := fmt.Sprintf(`{"id":%d,"username":"user%d","status":"active","created_at":"2024-01-%02d"}`, i, i, i%28+1)
+		if _, err := app.Append([]byte(record)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := app.TrainDictionary(0, 1024); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	dict, err := app.TrainDictionary(20, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	if len(dict) == 0 || len(dict) > 1024 || !bytes.Contains(dict, []byte(`","status":"active","created_at":"2024-01-`)) {
+		t.Errorf("Unexpected dictionary %q", dict)
+	}
+
+	records := make([][]byte, 100)
+	for i := range records {
+		records[i] = []byte(fmt.Sprintf(`{"id":%d,"username":"user%d","status":"active","created_at":"2024-02-%02d"}`, 1000+i, 1000+i, i%28+1))
+	}
+
+	plainSize := fileSizeWith(t, nil, records)
+	dictSize := fileSizeWith(t, dict, records)
+
+	// The dictionary is stored once in the header
+	if dictSize-int64(len(dict)) >= plainSize/2 {
+		t.Errorf("Expected dictionary to halve the size of the file, %d bytes with it, %d without", dictSize, plainSize)
+	}
+
+	cfg := defaultConfig()
+	cfg.Dictionary = []byte("other dictionary")
+
+	// The dictionary stored in the header is used instead of the configured one
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if !bytes.Equal(app.Config().Dictionary, dict) || app.Config().DictionaryCompressor != DeflateDictionary {
+		t.Errorf("Unexpected dictionary %q", app.Config().Dictionary)
+	}
+
+	off, err := app.Append(records[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	i := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if want := records[i%len(records)]; !bytes.Equal(e.Bytes(), want) {
+			t.Errorf("Expected entry %q but %q was read", want, e.Bytes())
+		}
+		i++
+		return false, nil
+	})
+	if err != nil || i != len(records)+1 {
+		t.Errorf("Unexpected %d entries, err: %v", i, err)
+	}
+
+	e, err := app.Read(off)
+	if err != nil || !bytes.Equal(e.Bytes(), records[0]) {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	dict := []byte(`"status":"active","created_at":"2024-`)
+	record := []byte(`{"id":1,"status":"active","created_at":"2024-01-01"}`)
+
+	formats := []struct {
+		name string
+		set  func(cfg *Config)
+	}{
+		{"plain", func(cfg *Config) {}},
+		{"dedup", func(cfg *Config) { cfg.Dedup = true }},
+		{"keyed", func(cfg *Config) { cfg.Keyed = true }},
+		{"encrypted", func(cfg *Config) { cfg.EncryptionKey = []byte("0123456789abcdef") }},
+	}
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Checksum = true
+			cfg.MaxEntrySize = len(record)
+			cfg.Dictionary = dict
+			format.set(cfg)
+
+			defer os.Remove("test_file.aof")
+
+			for i := 0; i < 2; i++ {
+				app, err := OpenWithConfig("test_file.aof", cfg)
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+
+				if cfg.Keyed {
+					_, err = app.AppendKeyed([]byte("key"), record)
+				} else {
+					_, err = app.AppendBulk([][]byte{record, record})
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+
+				// Compact compresses entries again, reopening loads the dictionary from the header
+				if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return true, nil, nil }); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+
+				app.Close()
+			}
+
+			cfg.Dictionary = nil
+
+			app, err := OpenWithConfig("test_file.aof", cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			defer app.Close()
+
+			// MaxEntrySize applies to the uncompressed content
+			large := append(bytes.Clone(record), 'x')
+			if cfg.Keyed {
+				_, err = app.AppendKeyed([]byte("key"), large)
+			} else {
+				_, err = app.Append(large)
+			}
+			if err != ErrEntryExceedsMaxSize {
+				t.Errorf("Expected error %v but %v was returned", ErrEntryExceedsMaxSize, err)
+			}
+
+			n, err := Fold(app, func(e *Entry, n int) (int, bool, error) {
+				if !bytes.Equal(e.Bytes(), record) {
+					t.Errorf("Unexpected entry %q", e.Bytes())
+				}
+				if _, ok := e.Deduplicated(); ok {
+					n++
+				}
+				return n, false, nil
+			}, 0)
+
+			switch {
+			case err != nil:
+				t.Errorf("Unexpected error %v", err)
+			case cfg.Dedup && n != 3:
+				t.Errorf("Expected 3 deduplicated entries but %d were read", n)
+			}
+
+			if cfg.Keyed {
+				if value, err := app.Get([]byte("key")); err != nil || !bytes.Equal(value, record) {
+					t.Errorf("Unexpected value %q, err: %v", value, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDictionaryHeader(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Dictionary = []byte("dictionary")
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte("entry")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	follower, err := OpenWithConfig("test_file_follower.aof", defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file_follower.aof")
+
+	// Frames compressed with another dictionary are not replicated, even if the format flags match
+	follower.hdr.flags |= hDictionary
+	follower.hdr.compressor = DeflateDictionary
+	follower.hdr.dictionary = []byte("other")
+
+	lc, fc := net.Pipe()
+	go app.ServeReplica(context.Background(), lc)
+
+	if err := follower.Replicate(context.Background(), fc); !errors.Is(err, ErrReplicationRejected) {
+		t.Errorf("Expected error %v but %v was returned", ErrReplicationRejected, err)
+	}
+
+	lc.Close()
+	follower.Close()
+	app.Close()
+
+	b, err := os.ReadFile("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !bytes.Equal(b[headerLen+headerDictionaryLen:headerLen+headerDictionaryLen+len(cfg.Dictionary)], cfg.Dictionary) {
+		t.Errorf("Dictionary not found in header %q", b[:headerLen+headerDictionaryLen+len(cfg.Dictionary)])
+	}
+
+	// Files compressed with compressors not registered can't be read
+	b[headerLen] = 255
+	if err := os.WriteFile("test_file.aof", b, DefaultPerm); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := OpenWithConfig("test_file.aof", defaultConfig()); err != ErrUnknownCompressor {
+		t.Errorf("Expected error %v but %v was returned", ErrUnknownCompressor, err)
+	}
+
+	b[headerLen] = deflateDictionaryID
+	byteOrder.PutUint32(b[headerLen+1:], maxHeaderDictionaryLen+1)
+	if err := os.WriteFile("test_file.aof", b, DefaultPerm); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := OpenWithConfig("test_file.aof", defaultConfig()); err != ErrInvalidHeader {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidHeader, err)
+	}
+}
+
+// fileSizeWith returns the size of a new file holding records, compressed with dict unless it is nil
+func fileSizeWith(t *testing.T, dict []byte, records [][]byte) int64 {
+	os.Remove("test_file.aof")
+
+	cfg := defaultConfig()
+	cfg.Dictionary = dict
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if _, err := app.AppendBulk(records); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	fi, err := os.Stat("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	return fi.Size()
+}
+
+func TestDedup(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Dedup = true
+	cfg.Checksum = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	content := bytes.Repeat([]byte("repeated content "), 10)
+
+	first, err := app.Append(content)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	size := app.size
+
+	offs, err := app.AppendBulk([][]byte{[]byte("other"), content, []byte("other")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Only the first entry holding "other" is stored in full
+	if app.size-size != 2*app.frameLen(5)+app.frameLen(referenceLen) {
+		t.Errorf("Unexpected size %d", app.size-size)
+	}
+
+	e, err := app.Read(offs[1])
+	if err != nil || !bytes.Equal(e.Bytes(), content) {
+		t.Fatalf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	if off, ok := e.Deduplicated(); !ok || off != first {
+		t.Errorf("Expected reference to %d but %d, %v was returned", first, off, ok)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	off, err := app.Append([]byte("other"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var ls []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		ls = append(ls, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !slices.Equal(ls, []string{string(content), "other", string(content), "other", "other"}) {
+		t.Errorf("Unexpected entries %q", ls)
+	}
+
+	e, err = app.Read(off)
+	if ref, ok := e.Deduplicated(); err != nil || !ok || ref != offs[0] {
+		t.Errorf("Expected reference to %d but %d, %v was returned, err: %v", offs[0], ref, ok, err)
+	}
+
+	// The entry at offs[1] references the first one
+	if err := app.TruncateHead(offs[0]); err != ErrEntryReferenced {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryReferenced, err)
+	}
+
+	if e, err := app.Read(offs[1]); err != nil || !bytes.Equal(e.Bytes(), content) {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	if err := app.TruncateHead(offs[2]); err != ErrEntryReferenced {
+		t.Errorf("Expected error %v but %v was returned", ErrEntryReferenced, err)
+	}
+
+	cfg.Keyed = true
+	if _, err := OpenWithConfig("test_file_keyed.aof", cfg); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+}
+
+func TestDedupCheckpoint(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Dedup = true
+	cfg.Checkpoints = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	content := []byte("repeated content")
+
+	if _, err := app.Append(content); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Checkpoint([]byte("state")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Entries after the checkpoint don't reference entries before it
+	var offs []int64
+	for i := 0; i < 2; i++ {
+		off, err := app.Append(content)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	off, err := app.Append(content)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i, off := range append(offs, off) {
+		e, err := app.Read(off)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if ref, ok := e.Deduplicated(); ok != (i > 0) || ok && ref != offs[0] {
+			t.Errorf("Unexpected reference %d, %v of entry %d", ref, ok, i)
+		}
+	}
+
+	if err := app.TruncateHeadToCheckpoint(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	n := 0
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		if !e.Checkpoint() && !bytes.Equal(e.Bytes(), content) {
+			t.Errorf("Unexpected entry %q", e.Bytes())
+		}
+		n++
+		return false, nil
+	})
+	if err != nil || n != 4 {
+		t.Errorf("Unexpected error %v after %d entries", err, n)
+	}
+}
+
+func TestMirroredAppender(t *testing.T) {
+	filenames := []string{"test_file.aof", "test_file_mirror1.aof", "test_file_mirror2.aof"}
+	for _, filename := range filenames {
+		defer os.Remove(filename)
+	}
+
+	cfg := defaultConfig()
+	cfg.Timestamps = true
+
+	if _, err := OpenMirrored(filenames, 4, cfg); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	ma, err := OpenMirrored(filenames, 2, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	offs, err := ma.AppendBulk([][]byte{[]byte("first"), []byte("second")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := ma.Read(offs[1])
+	if err != nil || string(e.Bytes()) != "second" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	if err := ma.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Every mirror holds the same frames
+	first, _ := os.ReadFile(filenames[0])
+	for _, filename := range filenames[1:] {
+		if b, _ := os.ReadFile(filename); !bytes.Equal(b, first) {
+			t.Errorf("Mirror %s differs", filename)
+		}
+	}
+
+	// A mirror left behind is replaced on Open
+	os.Remove(filenames[2])
+
+	ma, err = OpenMirrored(filenames, 2, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if b, _ := os.ReadFile(filenames[2]); !bytes.Equal(b, first) {
+		t.Errorf("Mirror %s was not synced", filenames[2])
+	}
+
+	// A failing mirror is left out while the quorum is reached
+	ma.mirrors[1].app.Close()
+
+	off, err := ma.Append([]byte("third"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := ma.Append([]byte("fourth")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if e, err := ma.Read(off); err != nil || string(e.Bytes()) != "third" {
+		t.Errorf("Unexpected entry %q, err: %v", e.Bytes(), err)
+	}
+
+	ma.mirrors[2].app.Close()
+
+	if _, err := ma.Append([]byte("fifth")); err != ErrQuorumNotReached {
+		t.Errorf("Expected error %v but %v was returned", ErrQuorumNotReached, err)
+	}
+
+	if err := ma.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if errs := ma.Failures(); errs[0] != nil || errs[1] != ErrAppenderClosed || errs[2] != ErrAppenderClosed {
+		t.Errorf("Unexpected failures %v", errs)
+	}
+}
+
+func TestMirroredAppenderLagging(t *testing.T) {
+	filenames := []string{"test_file.aof", "test_file_mirror1.aof", "test_file_mirror2.aof"}
+	for _, filename := range filenames {
+		defer os.Remove(filename)
+	}
+
+	ma, err := OpenMirrored(filenames, 2, defaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// A hung mirror fills its queue and is then left out, instead of blocking appends
+	hung := ma.mirrors[2].app
+	hung.mux.Lock()
+
+	for i := 0; i < 2*mirrorQueueSize; i++ {
+		if _, err := ma.Append([]byte("entry")); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if errs := ma.Failures(); errs[0] != nil || errs[1] != nil || errs[2] != ErrMirrorLagging {
+		t.Errorf("Unexpected failures %v", errs)
+	}
+
+	hung.mux.Unlock()
+
+	if err := ma.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := hung.Read(0); err != ErrAppenderClosed {
+		t.Errorf("Expected error %v but %v was returned", ErrAppenderClosed, err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Checkpoint([]byte("state")); err != ErrInvalidArguments {
+		t.Errorf("Expected error %v but %v was returned", ErrInvalidArguments, err)
+	}
+
+	if _, err := app.LastCheckpoint(); err != ErrNoCheckpoint {
+		t.Errorf("Expected error %v but %v was returned", ErrNoCheckpoint, err)
+	}
+
+	app.Close()
+	os.Remove("test_file.aof")
+
+	cfg := defaultConfig()
+	cfg.Checkpoints = true
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.AppendBulk([][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cp, err := app.Checkpoint([]byte("a,b"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := app.Append([]byte("c")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	app.Close()
+
+	app, err = OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer app.Close()
+
+	if info := app.Info(); info.Checkpoint != cp {
+		t.Errorf("Expected checkpoint at %d but %d was returned", cp, info.Checkpoint)
+	}
+
+	e, err := app.LastCheckpoint()
+	if err != nil || !e.Checkpoint() || string(e.Bytes()) != "a,b" {
+		t.Fatalf("Unexpected checkpoint %v, err: %v", e, err)
+	}
+
+	if err := app.TruncateHeadToCheckpoint(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if off := app.FirstOffset(); off != cp {
+		t.Errorf("Expected head at %d but %d was returned", cp, off)
+	}
+
+	if _, err := app.Compact(func(e *Entry) (bool, []byte, error) { return true, nil, nil }); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var ls []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		ls = append(ls, fmt.Sprintf("%s:%v", e.Bytes(), e.Checkpoint()))
+		return false, nil
+	})
+	if err != nil || !slices.Equal(ls, []string{"a,b:true", "c:false"}) {
+		t.Errorf("Unexpected entries %v, err: %v", ls, err)
+	}
+
+	if e, err := app.LastCheckpoint(); err != nil || string(e.Bytes()) != "a,b" {
+		t.Errorf("Unexpected checkpoint %v, err: %v", e, err)
+	}
+}
+
+func TestScanMeta(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxEntrySize = 1 << 20
+	cfg.Timestamps = true
+	cfg.Checksum = true
+
+	app, err := OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	// Large entries are skipped by seeking, small ones within the read buffer
+	sizes := []int{10, 100 << 10, 20, 300 << 10, 30}
+	for _, size := range sizes {
+		if _, err := app.Append(make([]byte, size)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	var expected []string
+	err = app.ForEach(func(e *Entry) (bool, error) {
+		expected = append(expected, fmt.Sprintf("%d:%d:%d", e.Offset(), e.Size(), e.Timestamp().UnixNano()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var scanned []string
+	var clone *Entry
+	err = app.ScanMeta(func(e *Entry) (bool, error) {
+		if e.Bytes() != nil {
+			t.Errorf("Unexpected content at offset %d", e.Offset())
+		}
+		scanned = append(scanned, fmt.Sprintf("%d:%d:%d", e.Offset(), e.Size(), e.Timestamp().UnixNano()))
+		clone = e.Clone()
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !slices.Equal(scanned, expected) {
+		t.Errorf("Expected entries %v but %v were scanned", expected, scanned)
+	}
+
+	if clone.Size() != sizes[len(sizes)-1] {
+		t.Errorf("Unexpected clone size %d", clone.Size())
+	}
+
+	n := 0
+	err = app.ScanMeta(func(e *Entry) (bool, error) {
+		n++
+		return n == 2, nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("Expected scan to stop after 2 entries but %d were scanned, err: %v", n, err)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build otel
+
+// Package aofotel creates OpenTelemetry spans for appender operations. It is only built with the otel build tag,
+// so OpenTelemetry is not a dependency of programs not using it
+package aofotel
+
+import (
+	"context"
+
+	"github.com/jeroiraz/go-aof"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	t trace.Tracer
+}
+
+// NewTracer returns an aof.Tracer creating spans with t
+func NewTracer(t trace.Tracer) aof.Tracer {
+	return &tracer{t: t}
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, aof.Span) {
+	ctx, s := t.t.Start(ctx, name)
+	return ctx, &span{s: s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s *span) SetAttribute(key string, value int64) {
+	s.s.SetAttributes(attribute.Int64(key, value))
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.s.RecordError(err)
+		s.s.SetStatus(codes.Error, err.Error())
+	}
+	s.s.End()
+}
@@ -0,0 +1,71 @@
+//go:build prometheus
+
+// Package aofprom exports aof.Counters as Prometheus metrics. It is only built with the prometheus build tag,
+// so the Prometheus client is not a dependency of programs not using it
+package aofprom
+
+import (
+	"github.com/jeroiraz/go-aof"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector reporting the values of aof.Counters
+type Collector struct {
+	counters *aof.Counters
+
+	appends  *prometheus.Desc
+	entries  *prometheus.Desc
+	bytes    *prometheus.Desc
+	flushes  *prometheus.Desc
+	syncs    *prometheus.Desc
+	scans    *prometheus.Desc
+	scanned  *prometheus.Desc
+	scanTime *prometheus.Desc
+	repairs  *prometheus.Desc
+}
+
+// NewCollector returns a collector for counters, whose metric names are prefixed with namespace
+func NewCollector(counters *aof.Counters, namespace string, constLabels prometheus.Labels) *Collector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "aof", name), help, nil, constLabels)
+	}
+
+	return &Collector{
+		counters: counters,
+		appends:  desc("appends_total", "Number of append calls"),
+		entries:  desc("appended_entries_total", "Number of appended entries"),
+		bytes:    desc("appended_bytes_total", "Number of appended payload bytes"),
+		flushes:  desc("flushes_total", "Number of flushes of buffered writes"),
+		syncs:    desc("fsyncs_total", "Number of fsyncs"),
+		scans:    desc("scans_total", "Number of scans run by Open and FoldWithHandler"),
+		scanned:  desc("scanned_entries_total", "Number of entries scanned"),
+		scanTime: desc("scan_seconds_total", "Time spent scanning entries"),
+		repairs:  desc("repairs_total", "Number of incomplete entries or transactions padded or removed"),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.appends
+	ch <- c.entries
+	ch <- c.bytes
+	ch <- c.flushes
+	ch <- c.syncs
+	ch <- c.scans
+	ch <- c.scanned
+	ch <- c.scanTime
+	ch <- c.repairs
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.counters.Snapshot()
+
+	ch <- prometheus.MustNewConstMetric(c.appends, prometheus.CounterValue, float64(s.Appends))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.CounterValue, float64(s.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(s.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.flushes, prometheus.CounterValue, float64(s.Flushes))
+	ch <- prometheus.MustNewConstMetric(c.syncs, prometheus.CounterValue, float64(s.Syncs))
+	ch <- prometheus.MustNewConstMetric(c.scans, prometheus.CounterValue, float64(s.Scans))
+	ch <- prometheus.MustNewConstMetric(c.scanned, prometheus.CounterValue, float64(s.Scanned))
+	ch <- prometheus.MustNewConstMetric(c.scanTime, prometheus.CounterValue, s.ScanTime.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.repairs, prometheus.CounterValue, float64(s.Repairs))
+}
@@ -0,0 +1,78 @@
+//go:build zstd
+
+// Package aofzstd compresses entries with Zstandard using the dictionary stored in the file header, see
+// aof.Config.Dictionary. It is only built with the zstd build tag, so the Zstandard implementation is not a
+// dependency of programs not using it. Importing it registers Compressor, so files using it can be opened
+package aofzstd
+
+import (
+	"bytes"
+
+	"github.com/jeroiraz/go-aof"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses entries with Zstandard. Dictionaries built with TrainDictionary or the zstd command line
+// tool are used along with their entropy tables, any other dictionary is used as raw content
+var Compressor aof.DictionaryCompressor = compressor{}
+
+const compressorID = 2
+
+// dictionaryID is the first ID not reserved by the Zstandard format
+const dictionaryID = 1 << 15
+
+// dictionaryMagic starts dictionaries in the Zstandard format
+var dictionaryMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+func init() {
+	aof.RegisterDictionaryCompressor(Compressor)
+}
+
+// TrainDictionary builds a Zstandard dictionary holding up to size bytes of the content selected by
+// aof.TrainDictionary, along with entropy tables fitted to samples. Samples are usually taken from an existing
+// file, see aof.Appender.SampleEntries
+func TrainDictionary(samples [][]byte, size int) ([]byte, error) {
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       dictionaryID,
+		Contents: samples,
+		History:  aof.TrainDictionary(samples, size),
+		Offsets:  [3]int{1, 4, 8},
+	})
+}
+
+type compressor struct{}
+
+func (compressor) ID() uint8 {
+	return compressorID
+}
+
+func (compressor) Hooks(dict []byte, maxSize int) (compress aof.HookFn, decompress aof.HookFn, err error) {
+	encDict := zstd.WithEncoderDictRaw(0, dict)
+	decDict := zstd.WithDecoderDictRaw(0, dict)
+
+	if bytes.HasPrefix(dict, dictionaryMagic) {
+		encDict = zstd.WithEncoderDict(dict)
+		decDict = zstd.WithDecoderDicts(dict)
+	}
+
+	enc, err := zstd.NewWriter(nil, encDict, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dec, err := zstd.NewReader(nil, decDict, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// EncodeAll and DecodeAll may be called concurrently
+	compress = func(bs []byte) ([]byte, error) {
+		return enc.EncodeAll(bs, nil), nil
+	}
+
+	decompress = func(bs []byte) ([]byte, error) {
+		return dec.DecodeAll(bs, nil)
+	}
+
+	return compress, decompress, nil
+}
@@ -0,0 +1,177 @@
+package aof
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compressor compresses archived segments. Implementations for codecs not included in the
+// standard library, such as zstd, can be provided through this interface
+type Compressor interface {
+	// Ext is the file extension appended to the names of compressed segments
+	Ext() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompressor compresses archived segments with gzip
+var GzipCompressor Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Ext() string {
+	return ".gz"
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (log *Log) archiveExt() string {
+	if log.compressor == nil {
+		return ""
+	}
+	return log.compressor.Ext()
+}
+
+// archive moves a closed segment into the archive directory, compressing it when configured
+func (log *Log) archive(seg *segment) error {
+	dst := filepath.Join(log.archiveDir, filepath.Base(seg.path)+log.archiveExt())
+
+	if log.compressor != nil {
+		if err := log.compressFile(seg.path, dst); err != nil {
+			os.Remove(dst)
+			return err
+		}
+	}
+
+	if err := seg.app.Close(); err != nil {
+		return err
+	}
+
+	if log.compressor == nil {
+		if err := os.Rename(seg.path, dst); err != nil {
+			return err
+		}
+	} else if err := os.Remove(seg.path); err != nil {
+		return err
+	}
+
+	os.Remove(indexFilename(seg.path))
+
+	seg.size = seg.app.size
+	seg.app = nil
+	seg.path = dst
+	seg.archived = true
+
+	return nil
+}
+
+func (log *Log) compressFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, log.segCfg.Perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w, err := log.compressor.NewWriter(out)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
+
+// appenderOf returns the appender of seg, opening archived segments read-only on first use.
+// Compressed segments are decompressed into a temporary file removed when the segment is closed
+func (log *Log) appenderOf(seg *segment) (*Appender, error) {
+	if seg.app != nil {
+		return seg.app, nil
+	}
+
+	path := seg.path
+
+	if log.compressor != nil {
+		tmpPath, err := log.decompressFile(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		seg.tmpPath = tmpPath
+		path = tmpPath
+	}
+
+	cfg := *log.segCfg
+	cfg.ReadOnly = true
+
+	app, err := OpenWithConfig(path, &cfg)
+	if err != nil && app == nil {
+		return nil, err
+	}
+
+	seg.app = app
+	seg.size = app.size
+
+	return app, nil
+}
+
+func (log *Log) decompressFile(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	r, err := log.compressor.NewReader(in)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	out, err := os.CreateTemp("", "aof-segment-*")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+
+	return out.Name(), nil
+}
+
+func (seg *segment) close() error {
+	var err error
+
+	if seg.app != nil && !seg.app.closed {
+		err = seg.app.Close()
+	}
+
+	if seg.tmpPath != "" {
+		os.Remove(seg.tmpPath)
+		seg.tmpPath = ""
+	}
+
+	return err
+}
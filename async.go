@@ -0,0 +1,249 @@
+package aof
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AppendResult is the outcome of an asynchronous append
+type AppendResult struct {
+	Offset int64
+	Err    error
+
+	// offs holds the offsets of every entry of a grouped AppendBulk call
+	offs []int64
+}
+
+// asyncAppend holds entries waiting to be appended by the async writer
+type asyncAppend struct {
+	bss  [][]byte
+	done chan AppendResult
+}
+
+// BackpressurePolicy determines what happens when entries are appended through a full async queue
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits until the writer makes room in the queue
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureFail fails the append with ErrQueueFull
+	BackpressureFail
+)
+
+// asyncWriter appends queued entries in order from a dedicated goroutine. Every request waiting
+// when the writer is ready is written with a single flush and fsync
+type asyncWriter struct {
+	mux    sync.Mutex
+	queue  chan *asyncAppend
+	closed bool
+	done   chan struct{}
+}
+
+// AppendAsync queues bs to be appended and returns a channel receiving the result once the entry
+// was flushed, and fsynced if required by the sync policy. Entries are appended in the order they are queued
+func (app *Appender) AppendAsync(bs []byte) <-chan AppendResult {
+	if err := app.throttle(context.Background(), [][]byte{bs}); err != nil {
+		done := make(chan AppendResult, 1)
+		done <- AppendResult{Err: err}
+		return done
+	}
+	return app.enqueue([][]byte{bs})
+}
+
+// appendGrouped appends bss through the async writer so it can share a write with concurrent appends
+func (app *Appender) appendGrouped(bss [][]byte) ([]int64, error) {
+	res := <-app.enqueue(bss)
+	return res.offs, res.Err
+}
+
+func (app *Appender) enqueue(bss [][]byte) <-chan AppendResult {
+	req := &asyncAppend{bss: bss, done: make(chan AppendResult, 1)}
+
+	aw := app.asyncWriter()
+	if aw == nil {
+		req.done <- AppendResult{Err: ErrAppenderClosed}
+		return req.done
+	}
+
+	aw.mux.Lock()
+	defer aw.mux.Unlock()
+
+	if aw.closed {
+		req.done <- AppendResult{Err: ErrAppenderClosed}
+		return req.done
+	}
+
+	if app.cfg.Backpressure == BackpressureFail {
+		select {
+		case aw.queue <- req:
+		default:
+			req.done <- AppendResult{Err: ErrQueueFull}
+		}
+		return req.done
+	}
+
+	aw.queue <- req
+
+	return req.done
+}
+
+// asyncWriter returns the async writer, starting it on first use. Nil is returned if the appender was closed first
+func (app *Appender) asyncWriter() *asyncWriter {
+	app.asyncOnce.Do(func() {
+		size := app.cfg.AsyncQueueSize
+		if size == 0 {
+			size = DefaultAsyncQueueSize
+		}
+
+		app.async = &asyncWriter{
+			queue: make(chan *asyncAppend, size),
+			done:  make(chan struct{}),
+		}
+		go app.asyncLoop(app.async)
+	})
+	return app.async
+}
+
+func (app *Appender) asyncLoop(aw *asyncWriter) {
+	defer close(aw.done)
+
+	for req := range aw.queue {
+		app.commit(app.group(aw, req))
+	}
+}
+
+// group collects the requests waiting after req, waiting up to GroupCommitWindow for more
+func (app *Appender) group(aw *asyncWriter, req *asyncAppend) []*asyncAppend {
+	reqs := []*asyncAppend{req}
+
+	var window <-chan time.Time
+	if app.cfg.GroupCommitWindow > 0 {
+		timer := time.NewTimer(app.cfg.GroupCommitWindow)
+		defer timer.Stop()
+		window = timer.C
+	}
+
+	for len(reqs) < cap(aw.queue) {
+		if window == nil {
+			select {
+			case req, ok := <-aw.queue:
+				if !ok {
+					return reqs
+				}
+				reqs = append(reqs, req)
+				continue
+			default:
+				return reqs
+			}
+		}
+
+		select {
+		case req, ok := <-aw.queue:
+			if !ok {
+				return reqs
+			}
+			reqs = append(reqs, req)
+		case <-window:
+			return reqs
+		}
+	}
+
+	return reqs
+}
+
+// commit appends the entries of every valid request with a single flush and sends the results. The requests
+// are appended one by one if the grouped append is rejected
+func (app *Appender) commit(reqs []*asyncAppend) {
+	var bss [][]byte
+	var valid []*asyncAppend
+
+	app.mux.Lock()
+
+	for _, req := range reqs {
+		if err := app.validate(req.bss); err != nil {
+			req.done <- AppendResult{Err: err}
+			continue
+		}
+		bss = append(bss, req.bss...)
+		valid = append(valid, req)
+	}
+
+	var offs []int64
+	var err error
+
+	if len(valid) > 0 {
+		offs, err = app.appendBulk(bss, &entryMeta{})
+	}
+
+	// Nothing is written when an entry is rejected by the append hooks, the size checks or the quota, so every
+	// request is then appended on its own and only the offending ones fail
+	if err != nil && !app.closed && len(valid) > 1 {
+		for _, req := range valid {
+			offs, err := app.appendBulk(req.bss, &entryMeta{})
+			if err != nil {
+				req.done <- AppendResult{Err: err}
+				continue
+			}
+			req.done <- AppendResult{Offset: offs[0], offs: offs}
+		}
+
+		app.mux.Unlock()
+		return
+	}
+
+	app.mux.Unlock()
+
+	for _, req := range valid {
+		if err != nil {
+			req.done <- AppendResult{Err: err}
+			continue
+		}
+
+		n := len(req.bss)
+		req.done <- AppendResult{Offset: offs[0], offs: offs[:n:n]}
+		offs = offs[n:]
+	}
+}
+
+// validate checks the entries of a request before running the append hooks, so an invalid one doesn't fail the
+// whole group
+func (app *Appender) validate(bss [][]byte) error {
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if len(bss) == 0 || app.keys != nil {
+		return ErrInvalidArguments
+	}
+
+	for _, bs := range bss {
+		if len(bs) == 0 && !app.cfg.EmptyEntries {
+			return ErrInvalidArguments
+		}
+		if len(bs) > app.maxEntrySize {
+			return ErrEntryExceedsMaxSize
+		}
+	}
+
+	return nil
+}
+
+// stopAsync waits for queued entries to be appended and stops the async writer
+func (app *Appender) stopAsync() {
+	app.asyncOnce.Do(func() {})
+
+	aw := app.async
+	if aw == nil {
+		return
+	}
+
+	aw.mux.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.queue)
+	}
+	aw.mux.Unlock()
+
+	<-aw.done
+}
@@ -0,0 +1,97 @@
+package aof
+
+import (
+	"io"
+	"os"
+)
+
+const restoreExt = ".restore"
+
+// Backup writes a consistent copy of the file to w, covering every entry appended before it is called.
+// Appends continue while the copy is written, Truncate, TruncateHead and Compact wait until it finishes
+func (app *Appender) Backup(w io.Writer) (n int64, err error) {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return 0, ErrAppenderClosed
+	}
+
+	v := app.view()
+
+	app.mux.Unlock()
+
+	f, err := app.openFile()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return io.Copy(w, io.NewSectionReader(f, 0, v.dataOffset+v.size))
+}
+
+// Restore creates the file filename from a copy written by Backup. Every entry is verified, and decrypted when
+// cfg holds an EncryptionKey, before the file is moved into place. Existing files are never overwritten
+func Restore(r io.Reader, filename string, cfg *Config) error {
+	if _, err := os.Stat(filename); err == nil {
+		return os.ErrExist
+	}
+
+	tmpFilename := filename + restoreExt
+
+	f, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, cfg.Perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = verifyFile(tmpFilename, cfg)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFilename, filename)
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	return nil
+}
+
+// verifyFile opens filename read-only and decodes every entry, failing if the last one is incomplete
+func verifyFile(filename string, cfg *Config) error {
+	vcfg := *cfg
+	vcfg.ReadOnly = true
+	vcfg.NoLock = true
+	vcfg.PersistIndex = false
+	vcfg.Mmap = false
+	vcfg.Recovery = RecoverFail
+	vcfg.ReadHooks = nil
+
+	if vcfg.MaxEntrySize < 1 {
+		vcfg.MaxEntrySize = DefaultMaxEntrySize
+	}
+
+	app, err := OpenWithConfig(filename, &vcfg)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	return app.ForEach(func(e *Entry) (bool, error) {
+		return false, nil
+	})
+}
@@ -0,0 +1,118 @@
+package aof
+
+import "encoding/binary"
+
+// knownBoundary returns true if offset off is known to be an entry boundary without reading the file.
+// Otherwise it returns the closest indexed entry located before off, from which frames must be walked.
+// It must be called with mux held and off located within [head, size]
+func (app *Appender) knownBoundary(off int64) (start int64, known bool) {
+	if off == app.head || off == app.size {
+		return off, true
+	}
+
+	_, start = app.index.nearestOffset(off)
+
+	return start, start == off
+}
+
+// sizeAt decodes the entry size encoded at the beginning of b. ok is false if it can't be decoded
+func (app *Appender) sizeAt(b []byte) (size int, sizeLen int, ok bool) {
+	sizeLen = len(app.sharedMem.bufRWEntrySize)
+
+	if app.varintSize {
+		s, n := binary.Uvarint(b[:min(len(b), sizeLen)])
+		if n <= 0 {
+			return 0, 0, false
+		}
+		return int(s), n, true
+	}
+
+	if len(b) < sizeLen {
+		return 0, 0, false
+	}
+
+	return readInt(b[:sizeLen]), sizeLen, true
+}
+
+// frameLenAt returns the length of the frame whose encoded size is at the beginning of b, 0 if it can't be decoded
+func (app *Appender) frameLenAt(b []byte) int64 {
+	size, sizeLen, ok := app.sizeAt(b)
+	if !ok {
+		return 0
+	}
+	return int64(sizeLen + len(app.sharedMem.bufRWEntryMeta) + size + len(app.sharedMem.bufRWEntryFlag))
+}
+
+// boundaryFrom returns true if an entry starts at offset off, walking the frames from the entry at offset start.
+// frameLen returns the length of the frame located at the given offset, 0 if it can't be read
+func boundaryFrom(start int64, off int64, frameLen func(pos int64) int64) bool {
+	pos := start
+
+	for pos < off {
+		n := frameLen(pos)
+		if n == 0 {
+			return false
+		}
+		pos += n
+	}
+
+	return pos == off
+}
+
+// mappedBoundary walks the frames of the mapping m from the entry at offset start
+func (app *Appender) mappedBoundary(m []byte, dataOffset int64, start int64, off int64) bool {
+	return boundaryFrom(start, off, func(pos int64) int64 {
+		if dataOffset+pos >= int64(len(m)) {
+			return 0
+		}
+		return app.frameLenAt(m[dataOffset+pos:])
+	})
+}
+
+// readBoundary walks the frames read with rd from the entry at offset start. Only entry sizes are read
+func (app *Appender) readBoundary(rd *fileReader, dataOffset int64, start int64, off int64) (bool, error) {
+	if err := rd.seek(dataOffset + start); err != nil {
+		return false, ErrUnexpectedReadError
+	}
+
+	return boundaryFrom(start, off, func(pos int64) int64 {
+		b, _ := rd.r.Peek(len(rd.bufSize))
+
+		n := app.frameLenAt(b)
+		if n > 0 {
+			if _, err := rd.r.Discard(int(n)); err != nil {
+				return 0
+			}
+		}
+
+		return n
+	}), nil
+}
+
+// checkViewBoundary returns ErrNotEntryBoundary if no entry of view v starts at offset off. Frames are walked
+// from the head of the view when the index doesn't cover it
+func (app *Appender) checkViewBoundary(rd *fileReader, v view, off int64) error {
+	app.mux.Lock()
+
+	start, known := v.head, off == v.head
+	if !known && off >= app.head && v.generation == app.hdr.generation {
+		start, known = app.knownBoundary(off)
+	}
+
+	app.mux.Unlock()
+
+	if known {
+		return nil
+	}
+
+	boundary, err := app.readBoundary(rd, v.dataOffset, start, off)
+	if err != nil {
+		return err
+	}
+
+	if !boundary {
+		return ErrNotEntryBoundary
+	}
+
+	return nil
+}
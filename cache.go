@@ -0,0 +1,115 @@
+package aof
+
+import (
+	"container/list"
+	"sync"
+)
+
+// entryCache keeps recently read entries by offset, evicting the least recently used ones once
+// maxEntries or maxBytes are exceeded. Cached entries belong to a file generation and are dropped
+// when it changes
+type entryCache struct {
+	mux        sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	generation uint64
+	ll         *list.List
+	items      map[int64]*list.Element
+}
+
+func newEntryCache(maxEntries int, maxBytes int64) *entryCache {
+	if maxEntries == 0 && maxBytes == 0 {
+		return nil
+	}
+	return &entryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[int64]*list.Element),
+	}
+}
+
+func entryCost(e *Entry) int64 {
+	return int64(len(e.bytes) + len(e.plain))
+}
+
+// get returns a copy of the entry cached at offset off
+func (c *entryCache) get(generation uint64, off int64) (*Entry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.generation != generation {
+		c.resetLocked(generation)
+		return nil, false
+	}
+
+	el, ok := c.items[off]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+
+	e := *el.Value.(*Entry)
+
+	return &e, true
+}
+
+func (c *entryCache) put(generation uint64, e *Entry) {
+	cost := entryCost(e)
+	if c.maxBytes > 0 && cost > c.maxBytes {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.generation != generation {
+		c.resetLocked(generation)
+	}
+
+	if _, ok := c.items[e.off]; ok {
+		return
+	}
+
+	cached := *e
+	c.items[e.off] = c.ll.PushFront(&cached)
+	c.bytes += cost
+
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		el := c.ll.Back()
+		evicted := el.Value.(*Entry)
+		c.ll.Remove(el)
+		delete(c.items, evicted.off)
+		c.bytes -= entryCost(evicted)
+	}
+}
+
+// evictFrom drops every entry located at or after offset off
+func (c *entryCache) evictFrom(off int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for o, el := range c.items {
+		if o >= off {
+			c.bytes -= entryCost(el.Value.(*Entry))
+			c.ll.Remove(el)
+			delete(c.items, o)
+		}
+	}
+}
+
+func (c *entryCache) resetLocked(generation uint64) {
+	c.generation = generation
+	c.bytes = 0
+	c.ll.Init()
+	c.items = make(map[int64]*list.Element)
+}
+
+// cacheEntry caches e, read from view v, when the cache is enabled
+func (app *Appender) cacheEntry(v view, e *Entry) {
+	if app.cache != nil {
+		app.cache.put(v.generation, e)
+	}
+}
@@ -0,0 +1,145 @@
+package aof
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+// ChainHead returns the hash of the last entry of a chained file. Recording it outside of the file allows
+// VerifyChain to prove later that the file was not truncated after that entry
+func (app *Appender) ChainHead() ([]byte, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if app.meta.prev < 0 {
+		return nil, ErrInvalidArguments
+	}
+
+	// Buffered entries are flushed so the head can be found by VerifyChain
+	if err := app.flushPending(); err != nil {
+		return nil, err
+	}
+
+	return bytes.Clone(app.chain), nil
+}
+
+// VerifyChain checks that every entry of a chained file stores the hash of the entry before it, proving that
+// no entry was modified, inserted or removed. When head is not nil the chain must reach it, as returned earlier
+// by ChainHead, proving the file was not truncated since. Entries dropped with TruncateHead are not covered,
+// the chain is verified from the first entry found at the head. A *BrokenChainError is returned on failure
+func (app *Appender) VerifyChain(head []byte) error {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return ErrAppenderClosed
+	}
+
+	if app.meta.prev < 0 {
+		app.mux.Unlock()
+		return ErrInvalidArguments
+	}
+
+	v := app.view()
+
+	rd, err := app.newFileReader()
+	app.mux.Unlock()
+
+	if err != nil {
+		return err
+	}
+	defer rd.f.Close()
+
+	if err := rd.seek(v.dataOffset + v.head); err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	e := rd.entry
+	off := v.head
+
+	// Entries before a non-zero head are gone, so the first entry links to an unknown hash
+	var chain []byte
+	if v.head == 0 {
+		chain = make([]byte, sha256.Size)
+	}
+
+	found := head == nil
+
+	for off < v.size {
+		// Sizes are checked before reading so a corrupted size can't cause a huge read
+		if size, _, ok := app.sizeAt(peekSize(rd)); ok && (size < 0 || size > app.maxStoredSize) {
+			return &BrokenChainError{Offset: off}
+		}
+
+		e.off = off
+		mb, err := e.read(app, rd)
+		if err == io.EOF && mb == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if mb > 0 {
+			break
+		}
+
+		// The hash stored in entries completed on recovery may have been partially written
+		prev := e.rawMeta[app.meta.prev : app.meta.prev+sha256.Size]
+		if chain != nil && !e.incomplete && !bytes.Equal(prev, chain) {
+			return &BrokenChainError{Offset: off}
+		}
+
+		chain = app.meta.chainHash(e.rawMeta, e.bytes[:e.size])
+
+		if !found && bytes.Equal(chain, head) {
+			found = true
+		}
+
+		off += app.entryFrameLen(e)
+	}
+
+	if !found {
+		return &BrokenChainError{Offset: off}
+	}
+
+	return nil
+}
+
+// loadChain sets the chain hash of chained files to the hash of their last entry, a zero hash
+// is stored in the first entry
+func (app *Appender) loadChain() error {
+	if app.meta.prev < 0 {
+		return nil
+	}
+
+	if app.last < 0 {
+		app.chain = make([]byte, sha256.Size)
+		return nil
+	}
+
+	if err := app.seek(app.last); err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	e := &Entry{off: app.last}
+
+	mb, err := e.read(app, app.rd)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if mb > 0 {
+		return ErrUnexpectedReadError
+	}
+
+	app.chain = app.meta.chainHash(e.rawMeta, e.bytes[:e.size])
+
+	return nil
+}
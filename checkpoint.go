@@ -0,0 +1,59 @@
+package aof
+
+import "errors"
+
+var ErrNoCheckpoint = errors.New("aof: No checkpoint")
+
+// kindCheckpoint is the value of the kind metadata field of checkpoints
+const kindCheckpoint uint8 = 3
+
+// Checkpoint appends an entry holding state, a snapshot of the state built from the entries before it, and
+// returns its offset. Entries before the latest checkpoint can then be dropped with TruncateHeadToCheckpoint,
+// and state is rebuilt from LastCheckpoint and the entries following it. Checkpoints are returned by folds and
+// iterators like any other entry, see Entry.Checkpoint. Checkpoints must be enabled in the file format
+func (app *Appender) Checkpoint(state []byte) (off int64, err error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if !app.closed && app.hdr.flags&hCheckpoints == 0 {
+		return 0, ErrInvalidArguments
+	}
+
+	offs, err := app.appendBulk([][]byte{state}, &entryMeta{checkpoint: true})
+	if err != nil {
+		return 0, err
+	}
+
+	return offs[0], nil
+}
+
+// LastCheckpoint reads the latest checkpoint, ErrNoCheckpoint is returned if there is none
+func (app *Appender) LastCheckpoint() (*Entry, error) {
+	app.mux.Lock()
+	off := app.checkpoint
+	app.mux.Unlock()
+
+	if off < 0 {
+		return nil, ErrNoCheckpoint
+	}
+
+	return app.Read(off)
+}
+
+// TruncateHeadToCheckpoint removes every entry located before the latest checkpoint, see TruncateHead
+func (app *Appender) TruncateHeadToCheckpoint() error {
+	app.mux.Lock()
+	off := app.checkpoint
+	app.mux.Unlock()
+
+	if off < 0 {
+		return ErrNoCheckpoint
+	}
+
+	return app.TruncateHead(off)
+}
+
+// Checkpoint returns true if the entry was appended with Appender.Checkpoint
+func (e *Entry) Checkpoint() bool {
+	return e.checkpoint
+}
@@ -0,0 +1,362 @@
+// Command aof inspects append only files.
+//
+// Usage:
+//
+//	aof inspect [flags] file   prints the format and a summary of the entries of file
+//	aof dump [flags] file      prints every entry of file
+//	aof migrate [flags] src dst  rewrites src into the new file dst changing its format
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jeroiraz/go-aof"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func usage(stderr io.Writer) int {
+	fmt.Fprintln(stderr, "usage: aof inspect|dump [flags] file")
+	fmt.Fprintln(stderr, "       aof migrate [flags] src dst")
+	fmt.Fprintln(stderr, "run aof <command> -h for the flags of each command")
+	return 2
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		return usage(stderr)
+	}
+
+	cmd := args[0]
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	base := fs.Int64("base", aof.DefaultBaseOffset, "offset of the file header")
+	key := fs.String("key", "", "hex encoded encryption key")
+	signingKey := fs.String("signing-key", "", "hex encoded signing key")
+
+	var format *string
+	var from *int64
+	var limit *int
+	var mf *migrateFlags
+
+	nargs := 1
+
+	switch cmd {
+	case "inspect":
+	case "dump":
+		format = fs.String("format", "string", "payload format: string, hex or base64")
+		from = fs.Int64("from", -1, "offset of the first entry to print, the head by default")
+		limit = fs.Int("limit", 0, "maximum number of entries to print, zero prints every entry")
+	case "migrate":
+		mf = newMigrateFlags(fs)
+		nargs = 2
+	default:
+		return usage(stderr)
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != nargs {
+		return usage(stderr)
+	}
+
+	if cmd == "migrate" {
+		if err := migrate(fs, mf, fs.Arg(0), fs.Arg(1), *base, *key, *signingKey, stdout); err != nil {
+			fmt.Fprintf(stderr, "aof: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	app, err := open(fs.Arg(0), *base, *key, *signingKey)
+	if err != nil {
+		fmt.Fprintf(stderr, "aof: %v\n", err)
+		return 1
+	}
+	defer app.Close()
+
+	if cmd == "inspect" {
+		err = inspect(app, stdout)
+	} else {
+		err = dump(app, stdout, *format, *from, *limit)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "aof: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func open(filename string, base int64, key string, signingKey string) (*aof.Appender, error) {
+	cfg := &aof.Config{
+		MaxEntrySize:  aof.DefaultMaxEntrySize,
+		BaseOffset:    base,
+		ReadOnly:      true,
+		NoLock:        true,
+		Recovery:      aof.RecoverPad,
+		IndexInterval: aof.DefaultIndexInterval,
+	}
+
+	if key != "" {
+		k, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, errors.New("invalid encryption key")
+		}
+		cfg.EncryptionKey = k
+	}
+
+	if signingKey != "" {
+		k, err := hex.DecodeString(signingKey)
+		if err != nil {
+			return nil, errors.New("invalid signing key")
+		}
+		cfg.SigningKey = k
+	}
+
+	return aof.OpenWithConfig(filename, cfg)
+}
+
+func inspect(app *aof.Appender, w io.Writer) error {
+	info := app.Info()
+	cfg := app.Config()
+
+	fmt.Fprintf(w, "version:        %d\n", info.Version)
+	fmt.Fprintf(w, "max entry size: %d\n", cfg.MaxEntrySize)
+	fmt.Fprintf(w, "checksum:       %v\n", cfg.Checksum)
+	fmt.Fprintf(w, "varint size:    %v\n", cfg.VarintSize)
+	fmt.Fprintf(w, "encrypted:      %v\n", len(cfg.EncryptionKey) > 0)
+	fmt.Fprintf(w, "signed:         %v\n", len(cfg.SigningKey) > 0)
+	fmt.Fprintf(w, "timestamps:     %v\n", cfg.Timestamps)
+	fmt.Fprintf(w, "types:          %v\n", cfg.Types)
+	fmt.Fprintf(w, "sequences:      %v\n", cfg.Sequences)
+	fmt.Fprintf(w, "keyed:          %v\n", cfg.Keyed)
+	fmt.Fprintf(w, "transactions:   %v\n", cfg.Transactions)
+	fmt.Fprintf(w, "tombstones:     %v\n", cfg.Tombstones)
+	fmt.Fprintf(w, "versions:       %v\n", cfg.Versions)
+	fmt.Fprintf(w, "chained:        %v\n", cfg.Chained)
+	fmt.Fprintf(w, "dedup:          %v\n", cfg.Dedup)
+	fmt.Fprintf(w, "checkpoints:    %v\n", cfg.Checkpoints)
+	if len(cfg.Dictionary) > 0 {
+		fmt.Fprintf(w, "dictionary:     %d bytes, compressor %d\n", len(cfg.Dictionary), cfg.DictionaryCompressor.ID())
+	}
+	fmt.Fprintf(w, "generation:     %d\n", info.Generation)
+	fmt.Fprintf(w, "head:           %d\n", info.Head)
+	fmt.Fprintf(w, "size:           %d\n", info.Size)
+	if info.Checkpoint >= 0 {
+		fmt.Fprintf(w, "checkpoint:     %d\n", info.Checkpoint)
+	}
+
+	var entries, incomplete, payload int64
+
+	err := app.ForEach(func(e *aof.Entry) (bool, error) {
+		entries++
+		payload += int64(e.Size())
+		if e.Incomplete() {
+			incomplete++
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "entries:        %d\n", entries)
+	fmt.Fprintf(w, "incomplete:     %d\n", incomplete)
+	fmt.Fprintf(w, "payload bytes:  %d\n", payload)
+
+	return nil
+}
+
+func dump(app *aof.Appender, w io.Writer, format string, from int64, limit int) error {
+	var encode func([]byte) string
+
+	switch format {
+	case "string":
+		encode = func(b []byte) string { return strconv.Quote(string(b)) }
+	case "hex":
+		encode = hex.EncodeToString
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	if from < 0 {
+		from = app.Info().Head
+	}
+
+	it, err := app.Iterator(from)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for n := 0; limit <= 0 || n < limit; n++ {
+		e, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "offset=%d size=%d", e.Offset(), e.Size())
+
+		if e.Incomplete() {
+			fmt.Fprint(w, " incomplete")
+		}
+		if e.Checkpoint() {
+			fmt.Fprint(w, " checkpoint")
+		}
+		if ts := e.Timestamp(); !ts.IsZero() {
+			fmt.Fprintf(w, " timestamp=%s", ts.Format(time.RFC3339Nano))
+		}
+		if e.Type() != 0 {
+			fmt.Fprintf(w, " type=%d", e.Type())
+		}
+		if e.Seq() != 0 {
+			fmt.Fprintf(w, " seq=%d", e.Seq())
+		}
+		if e.Version() != 0 {
+			fmt.Fprintf(w, " version=%d", e.Version())
+		}
+		if e.Key() != nil {
+			fmt.Fprintf(w, " key=%s", encode(e.Key()))
+		}
+
+		fmt.Fprintf(w, " payload=%s\n", encode(e.Bytes()))
+	}
+
+	return nil
+}
+
+// migrateFlags are the format settings of the migrated file. Settings not given keep the format of the source file
+type migrateFlags struct {
+	base         *int64
+	key          *string
+	maxEntrySize *int
+	checksum     *bool
+	varintSize   *bool
+	timestamps   *bool
+	types        *bool
+	sequences    *bool
+	versions     *bool
+	chained      *bool
+	dedup        *bool
+	checkpoints  *bool
+	dictionary   *string
+	train        *int
+}
+
+// dictionarySamples is the number of source entries a dictionary is trained from
+const dictionarySamples = 1000
+
+func newMigrateFlags(fs *flag.FlagSet) *migrateFlags {
+	return &migrateFlags{
+		base:         fs.Int64("dst-base", aof.DefaultBaseOffset, "offset of the header of the migrated file"),
+		key:          fs.String("dst-key", "", "hex encoded encryption key of the migrated file, the source key by default"),
+		maxEntrySize: fs.Int("max-entry-size", 0, "max entry size of the migrated file"),
+		checksum:     fs.Bool("checksum", false, "store checksums"),
+		varintSize:   fs.Bool("varint-size", false, "store entry sizes as varints"),
+		timestamps:   fs.Bool("timestamps", false, "store timestamps"),
+		types:        fs.Bool("types", false, "store type tags"),
+		sequences:    fs.Bool("sequences", false, "store sequence numbers"),
+		versions:     fs.Bool("versions", false, "store schema versions"),
+		chained:      fs.Bool("chained", false, "store the hash of the previous entry in every entry"),
+		dedup:        fs.Bool("dedup", false, "store repeated contents as references"),
+		checkpoints:  fs.Bool("checkpoints", false, "allow checkpoints"),
+		dictionary:   fs.String("dictionary", "", "file holding the compression dictionary of the migrated file, empty disables compression"),
+		train:        fs.Int("train-dictionary", 0, "compress the migrated file with a dictionary of this size trained from the source entries"),
+	}
+}
+
+func migrate(fs *flag.FlagSet, mf *migrateFlags, src string, dst string, base int64, key string, signingKey string, w io.Writer) error {
+	app, err := open(src, base, key, signingKey)
+	if err != nil {
+		return err
+	}
+	srcCfg := app.Config()
+
+	var dict []byte
+	if *mf.train > 0 {
+		dict, err = app.TrainDictionary(dictionarySamples, *mf.train)
+	}
+	app.Close()
+
+	if err != nil {
+		return err
+	}
+
+	dstCfg := srcCfg
+	dstCfg.BaseOffset = 0
+	dstCfg.Perm = aof.DefaultPerm
+
+	var ferr, derr error
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dst-base":
+			dstCfg.BaseOffset = *mf.base
+		case "dst-key":
+			dstCfg.EncryptionKey, ferr = hex.DecodeString(*mf.key)
+		case "max-entry-size":
+			dstCfg.MaxEntrySize = *mf.maxEntrySize
+		case "checksum":
+			dstCfg.Checksum = *mf.checksum
+		case "varint-size":
+			dstCfg.VarintSize = *mf.varintSize
+		case "timestamps":
+			dstCfg.Timestamps = *mf.timestamps
+		case "types":
+			dstCfg.Types = *mf.types
+		case "sequences":
+			dstCfg.Sequences = *mf.sequences
+		case "versions":
+			dstCfg.Versions = *mf.versions
+		case "chained":
+			dstCfg.Chained = *mf.chained
+		case "dedup":
+			dstCfg.Dedup = *mf.dedup
+		case "checkpoints":
+			dstCfg.Checkpoints = *mf.checkpoints
+		case "dictionary":
+			dstCfg.Dictionary = nil
+			if *mf.dictionary != "" {
+				dstCfg.Dictionary, derr = os.ReadFile(*mf.dictionary)
+			}
+		case "train-dictionary":
+			dstCfg.Dictionary = dict
+		}
+	})
+	if ferr != nil {
+		return errors.New("invalid encryption key")
+	}
+	if derr != nil {
+		return derr
+	}
+
+	offsets, err := aof.Migrate(src, dst, &srcCfg, &dstCfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "migrated %d entries\n", len(offsets))
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jeroiraz/go-aof"
+)
+
+func TestRun(t *testing.T) {
+	app, err := aof.Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.AppendBulk([][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	if rc := run([]string{"inspect", "test_file.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), "entries:        2\n") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+
+	if rc := run([]string{"dump", "-format", "hex", "-limit", "1", "test_file.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+
+	if stdout.String() != "offset=0 size=5 payload=6669727374\n" {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+
+	if rc := run([]string{"migrate", "-checksum", "-varint-size", "test_file.aof", "test_file_migrated.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+	defer os.Remove("test_file_migrated.aof")
+
+	if stdout.String() != "migrated 2 entries\n" {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+
+	if rc := run([]string{"inspect", "test_file_migrated.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), "checksum:       true\n") || !strings.Contains(stdout.String(), "entries:        2\n") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+
+	if err := os.WriteFile("test_file.dict", []byte("first second"), aof.DefaultPerm); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.dict")
+
+	if rc := run([]string{"migrate", "-dictionary", "test_file.dict", "test_file.aof", "test_file_compressed.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+	defer os.Remove("test_file_compressed.aof")
+
+	stdout.Reset()
+
+	if rc := run([]string{"inspect", "test_file_compressed.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), "dictionary:     12 bytes, compressor 1\n") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+
+	if rc := run([]string{"dump", "-limit", "1", "test_file_compressed.aof"}, &stdout, &stderr); rc != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", rc, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), `payload="first"`) {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	if rc := run([]string{"unknown"}, &stdout, &stderr); rc != 2 {
+		t.Errorf("Unexpected exit code %d", rc)
+	}
+}
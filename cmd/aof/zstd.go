@@ -0,0 +1,6 @@
+//go:build zstd
+
+package main
+
+// Files compressed with Zstandard can be read when built with the zstd build tag
+import _ "github.com/jeroiraz/go-aof/aofzstd"
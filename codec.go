@@ -0,0 +1,122 @@
+package aof
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+var ErrUnsupportedValue = errors.New("aof: Value not supported by codec")
+
+// Codec turns values into entry contents and back
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values as JSON
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values with encoding/gob. Every entry is self-describing, so type information
+// is repeated in each one
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtoMessage is implemented by protocol buffer messages generated with Marshal and Unmarshal methods,
+// such as those generated by gogo/protobuf or vtprotobuf
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtoCodec encodes protocol buffer messages implementing ProtoMessage. Unmarshal accepts a message
+// or a pointer to a message pointer, which is allocated when nil
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return nil, ErrUnsupportedValue
+	}
+	return m.Marshal()
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(ProtoMessage); ok {
+		return m.Unmarshal(data)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return ErrUnsupportedValue
+	}
+
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+
+	m, ok := rv.Elem().Interface().(ProtoMessage)
+	if !ok {
+		return ErrUnsupportedValue
+	}
+
+	return m.Unmarshal(data)
+}
+
+// codec returns the codec configured for the appender
+func (app *Appender) codec() Codec {
+	if app.cfg.Codec == nil {
+		return JSONCodec{}
+	}
+	return app.cfg.Codec
+}
+
+// Decode unmarshals the payload of the entry into v using the codec configured for its appender
+func (e *Entry) Decode(v interface{}) error {
+	if e.incomplete {
+		return ErrLastEntryIncomplete
+	}
+	if e.codec == nil {
+		return JSONCodec{}.Unmarshal(e.payload, v)
+	}
+	return e.codec.Unmarshal(e.payload, v)
+}
+
+// AppendValue appends v encoded with the configured codec
+func (app *Appender) AppendValue(v interface{}) (off int64, err error) {
+	bs, err := app.codec().Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return app.Append(bs)
+}
+
+// ReadValue decodes the entry located at offset off into v using the configured codec
+func (app *Appender) ReadValue(off int64, v interface{}) error {
+	e, err := app.Read(off)
+	if err != nil {
+		return err
+	}
+	return app.codec().Unmarshal(e.Bytes(), v)
+}
@@ -0,0 +1,173 @@
+package aof
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// CompactFn decides whether an entry is kept by Compact. A non-nil replacement is stored instead of the entry content
+type CompactFn func(e *Entry) (keep bool, replacement []byte, err error)
+
+const compactExt = ".compact"
+
+// Compact rewrites the file keeping only the entries accepted by f, then atomically replaces the original file.
+// Incomplete, expired and deleted entries, as well as tombstones, are always dropped. Type tags and timestamps of kept entries are preserved.
+// Encrypted entries are re-encrypted with the current key, so previous keys are no longer needed to read them.
+// The offsets of kept entries change, the returned map translates original offsets into new ones
+func (app *Appender) Compact(f CompactFn) (offsets map[int64]int64, err error) {
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Files managed by the caller cannot be replaced
+	if app.handle != nil {
+		return nil, ErrUnsupported
+	}
+
+	if err := app.flushPending(); err != nil {
+		return nil, err
+	}
+
+	tmpFilename := app.filename + compactExt
+
+	os.Remove(tmpFilename)
+
+	offsets, hdr, size, err := app.compactInto(tmpFilename, f)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpFilename, app.filename); err != nil {
+		os.Remove(tmpFilename)
+		return nil, ErrUnexpectedWriteErr
+	}
+
+	nf, err := os.OpenFile(app.filename, os.O_RDWR|os.O_APPEND|app.cfg.SyncWrites.flag(), app.cfg.Perm)
+	if err != nil {
+		app.close(err)
+		return nil, ErrUnexpectedReadError
+	}
+
+	// The lock was held on the replaced file
+	if !app.cfg.NoLock {
+		if err := lockFile(nf, true); err != nil {
+			nf.Close()
+			app.close(err)
+			return nil, err
+		}
+	}
+
+	var cf file = nf
+	if app.cfg.DirectIO {
+		if cf, err = directIO(nf, true); err != nil {
+			nf.Close()
+			app.close(err)
+			return nil, err
+		}
+	}
+
+	app.closeReaders()
+	app.f.Close()
+	app.f = cf
+	app.mmap = nil
+	app.rd.reset(cf)
+	app.w.Reset(cf)
+	app.hdr = hdr
+	app.head = hdr.head
+	app.dataOffset = app.baseOffset + int64(hdr.len())
+	app.size = size
+
+	app.wakeFollowers()
+
+	if err := app.rebuildIndex(); err != nil {
+		return nil, err
+	}
+
+	return offsets, nil
+}
+
+// compactInto writes the entries accepted by f into a new file, returning the offset translation, the header
+// and the size of the new file
+func (app *Appender) compactInto(filename string, f CompactFn) (map[int64]int64, *header, int64, error) {
+	if err := app.copyPrefix(filename); err != nil {
+		return nil, nil, 0, err
+	}
+
+	cfg := *app.cfg
+	cfg.PersistIndex = false
+	cfg.AppendHooks = nil
+
+	dst, err := OpenWithConfig(filename, &cfg)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer dst.Close()
+
+	// Offsets change, the new file starts a new generation
+	dst.hdr.generation = app.hdr.generation + 1
+
+	if err := dst.writeHeader(headerGenerationPos, dst.hdr.generation); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if app.expires() || app.deleted != nil {
+		now := time.Now()
+		keep := f
+		f = func(e *Entry) (bool, []byte, error) {
+			if app.expiredAt(e, now) || e.tombstone || app.deleted.has(e.off) {
+				return false, nil, nil
+			}
+			return keep(e)
+		}
+	}
+
+	handler := &compactHandler{f: f, dst: dst, offsets: make(map[int64]int64)}
+
+	if err := app.fold(handler, true); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if err := dst.f.Sync(); err != nil {
+		return nil, nil, 0, ErrUnexpectedWriteErr
+	}
+
+	return handler.offsets, dst.hdr, dst.size, nil
+}
+
+// copyPrefix copies the bytes preceding BaseOffset into a new file
+func (app *Appender) copyPrefix(filename string) error {
+	if app.baseOffset == 0 {
+		return nil
+	}
+
+	dst, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, app.cfg.Perm)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	w := bufio.NewWriter(dst)
+
+	if _, err := io.Copy(w, io.NewSectionReader(app.f, 0, app.baseOffset)); err != nil {
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := w.Flush(); err != nil {
+		return ErrUnexpectedWriteErr
+	}
+
+	return nil
+}
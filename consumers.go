@@ -0,0 +1,290 @@
+package aof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Consumers keeps the cursor committed by every named consumer of an appender in a sidecar file, so consumers
+// can resume where they left off after a restart. The sidecar file is replaced atomically on every commit, so
+// a crash leaves either the previous or the new cursors. The sidecar file is owned by a single process
+type Consumers struct {
+	app     *Appender
+	mux     sync.Mutex
+	cursors map[string]Cursor
+}
+
+const consumersExt = ".consumers"
+
+var consumersMagic = []byte("GCON")
+
+const consumersVersion = 1
+
+func consumersFilename(filename string) string {
+	return filename + consumersExt
+}
+
+// Consumers returns the consumers of the appender, loading their committed cursors on first use
+func (app *Appender) Consumers() (*Consumers, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if app.consumers != nil {
+		return app.consumers, nil
+	}
+
+	cursors, err := app.loadConsumersFile()
+	if err != nil {
+		return nil, err
+	}
+
+	app.consumers = &Consumers{app: app, cursors: cursors}
+
+	return app.consumers, nil
+}
+
+// Commit records cur as the position of consumer name, persisting every cursor before returning
+func (c *Consumers) Commit(name string, cur Cursor) error {
+	if name == "" || cur.Offset < 0 {
+		return ErrInvalidArguments
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	prev, ok := c.cursors[name]
+	c.cursors[name] = cur
+
+	if err := c.write(); err != nil {
+		if ok {
+			c.cursors[name] = prev
+		} else {
+			delete(c.cursors, name)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CommitEntry records e as the last entry processed by consumer name, see Commit. e must have been read
+// after the last Truncate or Compact
+func (c *Consumers) CommitEntry(name string, e *Entry) error {
+	app := c.app
+
+	app.mux.Lock()
+	generation := app.hdr.generation
+	app.mux.Unlock()
+
+	return c.Commit(name, Cursor{Offset: e.off + app.entryFrameLen(e), Seq: e.seq, Generation: generation})
+}
+
+// Cursor returns the cursor last committed by consumer name
+func (c *Consumers) Cursor(name string) (cur Cursor, ok bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	cur, ok = c.cursors[name]
+	return cur, ok
+}
+
+// Names returns the names of every consumer in lexicographical order
+func (c *Consumers) Names() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	names := make([]string, 0, len(c.cursors))
+	for name := range c.cursors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Remove forgets consumer name
+func (c *Consumers) Remove(name string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	cur, ok := c.cursors[name]
+	if !ok {
+		return nil
+	}
+
+	delete(c.cursors, name)
+
+	if err := c.write(); err != nil {
+		c.cursors[name] = cur
+		return err
+	}
+
+	return nil
+}
+
+// Resume returns an iterator positioned after the last entry processed by consumer name, or at the first entry
+// if it never committed. ErrStaleCursor is returned if offsets were invalidated since the last commit
+func (c *Consumers) Resume(name string) (*Iterator, error) {
+	cur, ok := c.Cursor(name)
+	if !ok {
+		return c.app.headIterator()
+	}
+	return c.app.Resume(cur)
+}
+
+// Lag returns the number of entries and bytes appended after the last entry processed by consumer name
+func (c *Consumers) Lag(name string) (entries int64, bytes int64, err error) {
+	it, err := c.Resume(name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	from := it.off
+
+	err = it.forEach(func(e *Entry) (bool, error) {
+		entries++
+		bytes = e.Offset() + c.app.entryFrameLen(e) - from
+		return false, nil
+	})
+
+	return entries, bytes, err
+}
+
+// write persists every cursor replacing the sidecar file, it must be called with mux held
+func (c *Consumers) write() error {
+	if c.app.fsys != nil {
+		return ErrReadOnly
+	}
+
+	if c.app.filename == "" {
+		return ErrUnsupported
+	}
+
+	names := make([]string, 0, len(c.cursors))
+	for name := range c.cursors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	buf.Write(consumersMagic)
+	buf.WriteByte(consumersVersion)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(names))))
+
+	for _, name := range names {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(name))))
+		buf.WriteString(name)
+
+		b, _ := c.cursors[name].MarshalBinary()
+		buf.Write(b)
+	}
+
+	b := byteOrder.AppendUint32(buf.Bytes(), crc32.Checksum(buf.Bytes(), crc32cTable))
+
+	filename := consumersFilename(c.app.filename)
+	tmpFilename := filename + compactExt
+
+	if err := writeFileSync(tmpFilename, b, c.app.cfg.Perm); err != nil {
+		os.Remove(tmpFilename)
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return ErrUnexpectedWriteErr
+	}
+
+	// The rename itself is only durable once the directory is synced
+	if err := syncDir(filepath.Dir(filename)); err != nil {
+		return ErrUnexpectedWriteErr
+	}
+
+	return nil
+}
+
+// writeFileSync writes b to filename and syncs it to stable storage
+func writeFileSync(filename string, b []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadConsumersFile reads the committed cursors, a missing sidecar file means there are no consumers
+func (app *Appender) loadConsumersFile() (map[string]Cursor, error) {
+	cursors := make(map[string]Cursor)
+
+	if app.filename == "" {
+		return cursors, nil
+	}
+
+	b, err := app.readFile(consumersFilename(app.filename))
+	if os.IsNotExist(err) {
+		return cursors, nil
+	}
+	if err != nil {
+		return nil, ErrUnexpectedReadError
+	}
+
+	if len(b) < len(consumersMagic)+1+crc32.Size {
+		return nil, ErrCorruptedEntry
+	}
+
+	n := len(b) - crc32.Size
+	if crc32.Checksum(b[:n], crc32cTable) != byteOrder.Uint32(b[n:]) {
+		return nil, ErrCorruptedEntry
+	}
+
+	if !bytes.Equal(b[:4], consumersMagic) || b[4] != consumersVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	b = b[5:n]
+
+	count, l := binary.Uvarint(b)
+	if l <= 0 {
+		return nil, ErrCorruptedEntry
+	}
+	b = b[l:]
+
+	for i := uint64(0); i < count; i++ {
+		nameLen, l := binary.Uvarint(b)
+		if l <= 0 || nameLen > uint64(len(b)-l) || len(b)-l-int(nameLen) < cursorLen {
+			return nil, ErrCorruptedEntry
+		}
+		b = b[l:]
+
+		name := string(b[:nameLen])
+		b = b[nameLen:]
+
+		var cur Cursor
+		cur.UnmarshalBinary(b[:cursorLen])
+		b = b[cursorLen:]
+
+		cursors[name] = cur
+	}
+
+	return cursors, nil
+}
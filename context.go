@@ -0,0 +1,137 @@
+package aof
+
+import "context"
+
+// contextHandler stops folding with the context error once ctx is done
+type contextHandler struct {
+	ctx     context.Context
+	handler FoldHandler
+}
+
+func (h *contextHandler) Fold(e *Entry) (bool, error) {
+	if err := h.ctx.Err(); err != nil {
+		return true, err
+	}
+	return h.handler.Fold(e)
+}
+
+func (h *contextHandler) Value() interface{} {
+	return h.handler.Value()
+}
+
+func (h *contextHandler) Values() []interface{} {
+	return h.handler.Values()
+}
+
+// AppendContext appends bs unless ctx is done before the appender could be locked
+func (app *Appender) AppendContext(ctx context.Context, bs []byte) (off int64, err error) {
+	offs, err := app.AppendBulkContext(ctx, [][]byte{bs})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// AppendBulkContext appends every entry in bss unless ctx is done before the appender could be locked
+func (app *Appender) AppendBulkContext(ctx context.Context, bss [][]byte) (offs []int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return app.traceAppend(ctx, "aof.AppendBulk", bss, func() ([]int64, error) {
+		if err := app.throttle(ctx, bss); err != nil {
+			return nil, err
+		}
+
+		app.mux.Lock()
+		defer app.mux.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		return app.appendBulk(bss, &entryMeta{})
+	})
+}
+
+// ReadContext reads the entry located at offset off unless ctx is done before the appender could be locked
+func (app *Appender) ReadContext(ctx context.Context, off int64) (e *Entry, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return app.Read(off)
+}
+
+// ForEachContext runs f over every entry, stopping with the context error once ctx is done
+func (app *Appender) ForEachContext(ctx context.Context, f ForEachFn) error {
+	return app.FoldWithHandlerContext(ctx, &forEachHandler{f: f})
+}
+
+func (app *Appender) MapContext(ctx context.Context, f MapFn) (ls []interface{}, err error) {
+	handler := &mapHandler{f: f, ls: nil}
+	err = app.FoldWithHandlerContext(ctx, handler)
+	return handler.Values(), err
+}
+
+func (app *Appender) FoldContext(ctx context.Context, f FoldFn, v interface{}) (ret interface{}, err error) {
+	handler := &gFoldHandler{f: f, v: v}
+	err = app.FoldWithHandlerContext(ctx, handler)
+	return handler.Value(), err
+}
+
+// FoldWithHandlerContext runs handler over every entry, stopping with the context error once ctx is done
+func (app *Appender) FoldWithHandlerContext(ctx context.Context, handler FoldHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return app.foldWithHandler(ctx, &contextHandler{ctx: ctx, handler: handler})
+}
+
+// AppendContext appends bs unless ctx is done before the log could be locked
+func (log *Log) AppendContext(ctx context.Context, bs []byte) (off int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return log.Append(bs)
+}
+
+// AppendBulkContext appends every entry in bss unless ctx is done before the log could be locked
+func (log *Log) AppendBulkContext(ctx context.Context, bss [][]byte) (offs []int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return log.AppendBulk(bss)
+}
+
+// ReadContext reads the entry located at offset off unless ctx is done before the log could be locked
+func (log *Log) ReadContext(ctx context.Context, off int64) (e *Entry, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return log.Read(off)
+}
+
+// ForEachContext runs f over every entry, stopping with the context error once ctx is done
+func (log *Log) ForEachContext(ctx context.Context, f ForEachFn) error {
+	return log.FoldWithHandlerContext(ctx, &forEachHandler{f: f})
+}
+
+func (log *Log) MapContext(ctx context.Context, f MapFn) (ls []interface{}, err error) {
+	handler := &mapHandler{f: f, ls: nil}
+	err = log.FoldWithHandlerContext(ctx, handler)
+	return handler.Values(), err
+}
+
+func (log *Log) FoldContext(ctx context.Context, f FoldFn, v interface{}) (ret interface{}, err error) {
+	handler := &gFoldHandler{f: f, v: v}
+	err = log.FoldWithHandlerContext(ctx, handler)
+	return handler.Value(), err
+}
+
+// FoldWithHandlerContext runs handler over the entries of every segment, stopping with the context error once ctx is done
+func (log *Log) FoldWithHandlerContext(ctx context.Context, handler FoldHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return log.FoldWithHandler(&contextHandler{ctx: ctx, handler: handler})
+}
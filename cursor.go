@@ -0,0 +1,85 @@
+package aof
+
+import "errors"
+
+var ErrStaleCursor = errors.New("aof: Cursor does not match the file")
+
+// cursorLen is the length of an encoded cursor: offset | seq | generation
+const cursorLen = 24
+
+// Cursor records the position of an iterator so iteration can be resumed later, possibly by another process.
+// Offset is the location of the next entry to read, Seq the sequence number of the last entry read and
+// Generation the file generation at the time, which changes whenever offsets are invalidated by Truncate or Compact
+type Cursor struct {
+	Offset     int64
+	Seq        uint64
+	Generation uint64
+}
+
+func (c Cursor) MarshalBinary() ([]byte, error) {
+	b := make([]byte, cursorLen)
+	byteOrder.PutUint64(b, uint64(c.Offset))
+	byteOrder.PutUint64(b[8:], c.Seq)
+	byteOrder.PutUint64(b[16:], c.Generation)
+	return b, nil
+}
+
+func (c *Cursor) UnmarshalBinary(b []byte) error {
+	if len(b) != cursorLen {
+		return ErrInvalidArguments
+	}
+	c.Offset = int64(byteOrder.Uint64(b))
+	c.Seq = byteOrder.Uint64(b[8:])
+	c.Generation = byteOrder.Uint64(b[16:])
+	return nil
+}
+
+// Cursor returns the position of a forward iterator, right after the last entry returned by Next
+func (it *Iterator) Cursor() Cursor {
+	return Cursor{Offset: it.off, Seq: it.seq, Generation: it.generation}
+}
+
+// Resume returns an iterator positioned at cursor c. ErrStaleCursor is returned if the file generation changed
+// or, when sequences are enabled, the entry at the cursor does not follow the last one read
+func (app *Appender) Resume(c Cursor) (*Iterator, error) {
+	if err := app.checkCursor(c); err != nil {
+		return nil, err
+	}
+
+	it, err := app.Iterator(c.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	it.seq = c.Seq
+
+	return it, nil
+}
+
+func (app *Appender) checkCursor(c Cursor) error {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if c.Generation != app.hdr.generation {
+		return ErrStaleCursor
+	}
+
+	if app.meta.seq < 0 || c.Seq == 0 || c.Offset < app.head || c.Offset >= app.size {
+		return nil
+	}
+
+	e, err := app.readEntry(c.Offset)
+	if err != nil {
+		return err
+	}
+
+	if e.seq != c.Seq+1 {
+		return ErrStaleCursor
+	}
+
+	return nil
+}
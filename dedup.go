@@ -0,0 +1,133 @@
+package aof
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+var ErrEntryReferenced = errors.New("aof: Entry is referenced by a later entry")
+
+// kindReference is the value of the kind metadata field of references to an identical earlier entry
+const kindReference uint8 = 2
+
+// referenceLen is the length of the stored content of a reference, the offset of the referenced entry
+const referenceLen = 8
+
+// contentSet maps the hash of the stored content of every entry to the offset of the first entry holding it.
+// It is nil when deduplication is not enabled in the file format
+type contentSet map[[sha256.Size]byte]int64
+
+func newContentSet(flags uint16) contentSet {
+	if flags&hDedup == 0 {
+		return nil
+	}
+	return make(contentSet)
+}
+
+// add registers the stored content bs of the entry at offset off, unless an earlier entry holds it
+func (s contentSet) add(bs []byte, off int64) {
+	if s == nil {
+		return
+	}
+
+	h := sha256.Sum256(bs)
+	if _, ok := s[h]; !ok {
+		s[h] = off
+	}
+}
+
+// reset forgets every content, so later entries don't reference earlier ones
+func (s contentSet) reset() {
+	clear(s)
+}
+
+// trackContent registers an existing entry holding content which may be referenced
+func (app *Appender) trackContent(e *Entry) {
+	if e.incomplete || e.tombstone || e.reference {
+		return
+	}
+
+	// Entries never reference entries before a checkpoint, so TruncateHeadToCheckpoint doesn't break references
+	if e.checkpoint {
+		app.contents.reset()
+		return
+	}
+
+	app.contents.add(e.bytes[:e.size], e.off)
+}
+
+// checkReferences returns ErrEntryReferenced if an entry located at or after offset off references an entry
+// located before it. It must be called with mux held
+func (app *Appender) checkReferences(off int64) error {
+	if app.contents == nil {
+		return nil
+	}
+
+	handler := &forEachHandler{f: func(e *Entry) (bool, error) {
+		if e.reference && !e.incomplete && len(e.payload) == referenceLen && int64(byteOrder.Uint64(e.payload)) < off {
+			return true, ErrEntryReferenced
+		}
+		return false, nil
+	}}
+
+	return app.foldFrom(off, handler, false)
+}
+
+// Deduplicated returns the offset of the entry holding the content of e if it was stored as a reference to it,
+// see Config.Dedup
+func (e *Entry) Deduplicated() (off int64, ok bool) {
+	if !e.reference {
+		return 0, false
+	}
+	return e.original, true
+}
+
+// resolve replaces the payload of a reference with the content of the entry it points to
+func (e *Entry) resolve(app *Appender) error {
+	if !e.reference || e.incomplete {
+		return nil
+	}
+
+	if len(e.payload) != referenceLen {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	off := int64(byteOrder.Uint64(e.payload))
+	if off >= e.off {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	if off < app.head {
+		return ErrOffsetPurged
+	}
+
+	// The referenced entry is read with its own buffers as the reader of e may be in use
+	rd := &fileReader{
+		r:       bufio.NewReader(io.NewSectionReader(app.f, app.dataOffset+off, e.off-off)),
+		bufSize: make([]byte, len(app.sharedMem.bufRWEntrySize)),
+		bufMeta: make([]byte, app.meta.len),
+		bufFlag: make([]byte, 1),
+	}
+
+	orig := &Entry{off: off}
+
+	mb, err := orig.read(app, rd)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if mb > 0 || orig.incomplete || orig.reference {
+		return &CorruptedEntryError{Offset: off}
+	}
+
+	if err := orig.verify(app); err != nil {
+		return err
+	}
+
+	e.original = off
+	e.payload = orig.payload
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package aof
+
+import (
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+var ErrUnknownCompressor = errors.New("aof: Unknown dictionary compressor")
+
+// MaxDictionarySize is the largest useful compression dictionary, the DEFLATE window size
+const MaxDictionarySize = 32 << 10
+
+// dictGramLen is the length of the substrings counted when training a dictionary
+const dictGramLen = 8
+
+// TrainDictionary builds a compression dictionary of at most size bytes from samples, holding the substrings
+// repeated in most of them. Dictionaries improve the compression of small entries sharing content, such as
+// records with the same field names, see Config.Dictionary
+func TrainDictionary(samples [][]byte, size int) []byte {
+	size = min(size, MaxDictionarySize)
+
+	type gram struct {
+		count int
+		first int
+	}
+
+	// Substrings are counted once per sample
+	grams := make(map[string]*gram)
+	for _, s := range samples {
+		seen := make(map[string]struct{})
+
+		for i := 0; i+dictGramLen <= len(s); i++ {
+			k := string(s[i : i+dictGramLen])
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			if g, ok := grams[k]; ok {
+				g.count++
+			} else {
+				grams[k] = &gram{count: 1, first: len(grams)}
+			}
+		}
+	}
+
+	var keys []string
+	for k, g := range grams {
+		if g.count > 1 {
+			keys = append(keys, k)
+		}
+	}
+
+	// Substrings of a longer repeated string share its count and follow each other, so they are merged back
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := cmp.Compare(grams[b].count, grams[a].count); c != 0 {
+			return c
+		}
+		return cmp.Compare(grams[a].first, grams[b].first)
+	})
+
+	var pieces [][]byte
+	n := 0
+
+	for _, k := range keys {
+		if len(pieces) > 0 {
+			last := pieces[len(pieces)-1]
+			if bytes.HasSuffix(last, []byte(k[:dictGramLen-1])) {
+				if n+1 > size {
+					break
+				}
+				pieces[len(pieces)-1] = append(last, k[dictGramLen-1])
+				n++
+				continue
+			}
+		}
+
+		if n+len(k) > size {
+			break
+		}
+
+		if slices.ContainsFunc(pieces, func(p []byte) bool { return bytes.Contains(p, []byte(k)) }) {
+			continue
+		}
+
+		pieces = append(pieces, []byte(k))
+		n += len(k)
+	}
+
+	// Closer matches are encoded with fewer bits, so the most repeated content goes last
+	slices.Reverse(pieces)
+
+	return bytes.Join(pieces, nil)
+}
+
+// TrainDictionary builds a dictionary of at most size bytes, see TrainDictionary, from up to n entries
+// sampled evenly across the appender. Existing files are compressed with it by migrating them into a file
+// created with it as Config.Dictionary, see Migrate
+func (app *Appender) TrainDictionary(n int, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, ErrInvalidArguments
+	}
+
+	samples, err := app.SampleEntries(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return TrainDictionary(samples, size), nil
+}
+
+// SampleEntries returns a copy of the payload of up to n complete entries sampled evenly across the appender,
+// to train dictionaries with
+func (app *Appender) SampleEntries(n int) ([][]byte, error) {
+	if n <= 0 {
+		return nil, ErrInvalidArguments
+	}
+
+	step := max(app.Count()/int64(n), 1)
+
+	var samples [][]byte
+	var i int64
+
+	err := app.ForEach(func(e *Entry) (bool, error) {
+		if i%step == 0 && !e.incomplete && !e.tombstone {
+			samples = append(samples, bytes.Clone(e.Bytes()))
+		}
+		i++
+		return len(samples) == n, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// DictionaryCompressor compresses entries using the dictionary stored in the file header, see Config.Dictionary.
+// Compressors are recorded in headers by their ID, files using one can only be opened once it is registered with
+// RegisterDictionaryCompressor
+type DictionaryCompressor interface {
+	// ID identifies the compressor in file headers. IDs below 16 are reserved for the compressors of this module
+	ID() uint8
+	// Hooks returns the functions compressing entries with dict and decompressing them, failing when the
+	// decompressed content exceeds maxSize bytes. They must be safe for concurrent use
+	Hooks(dict []byte, maxSize int) (compress HookFn, decompress HookFn, err error)
+}
+
+// DeflateDictionary compresses entries with DEFLATE using the dictionary as preset dictionary. It is used when
+// Config.DictionaryCompressor is not set
+var DeflateDictionary DictionaryCompressor = deflateDictionary{}
+
+const deflateDictionaryID = 1
+
+var (
+	compressorsMux sync.RWMutex
+	compressors    = map[uint8]DictionaryCompressor{deflateDictionaryID: DeflateDictionary}
+)
+
+// RegisterDictionaryCompressor makes c available to open files using it. It panics if the ID of c is zero or
+// already registered
+func RegisterDictionaryCompressor(c DictionaryCompressor) {
+	compressorsMux.Lock()
+	defer compressorsMux.Unlock()
+
+	if _, ok := compressors[c.ID()]; c.ID() == 0 || ok {
+		panic(fmt.Sprintf("aof: dictionary compressor ID %d already in use", c.ID()))
+	}
+
+	compressors[c.ID()] = c
+}
+
+func lookupDictionaryCompressor(id uint8) DictionaryCompressor {
+	compressorsMux.RLock()
+	defer compressorsMux.RUnlock()
+
+	return compressors[id]
+}
+
+// compressedBound is the largest size of n bytes once compressed, covering the worst case expansion of
+// DEFLATE and Zstandard
+func compressedBound(n int) int {
+	return n + n>>8 + 64
+}
+
+// maxEncodedSize is the largest content of an entry before encryption
+func (app *Appender) maxEncodedSize() int {
+	if app.compress != nil {
+		return compressedBound(app.maxEntrySize)
+	}
+	return app.maxEntrySize
+}
+
+// dictionaryHooks returns the functions compressing and decompressing the entries of files with a dictionary
+func (hdr *header) dictionaryHooks() (compress HookFn, decompress HookFn, err error) {
+	if hdr.flags&hDictionary == 0 {
+		return nil, nil, nil
+	}
+	return hdr.compressor.Hooks(hdr.dictionary, hdr.maxEntrySize)
+}
+
+// compressEntry compresses the content bs of an entry being appended
+func (app *Appender) compressEntry(bs []byte) ([]byte, error) {
+	if len(bs) > app.maxEntrySize {
+		return nil, ErrEntryExceedsMaxSize
+	}
+
+	bs, err := app.compress(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bs) > compressedBound(app.maxEntrySize) {
+		return nil, ErrEntryExceedsMaxSize
+	}
+
+	return bs, nil
+}
+
+// decompress restores the payload of complete entries compressed with the dictionary of the file. Tombstones
+// are not compressed
+func (e *Entry) decompress(app *Appender) error {
+	if app.decompress == nil || e.incomplete || e.tombstone {
+		return nil
+	}
+
+	plain, err := app.decompress(e.payload)
+	if err != nil || len(plain) > app.maxEntrySize {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	e.payload = plain
+
+	return nil
+}
+
+type deflateDictionary struct{}
+
+func (deflateDictionary) ID() uint8 {
+	return deflateDictionaryID
+}
+
+func (deflateDictionary) Hooks(dict []byte, maxSize int) (compress HookFn, decompress HookFn, err error) {
+	// Writers are expensive to create, they are reset to their dictionary instead
+	writers := &sync.Pool{New: func() any {
+		w, _ := flate.NewWriterDict(nil, flate.BestCompression, dict)
+		return w
+	}}
+
+	compress = func(bs []byte) ([]byte, error) {
+		w := writers.Get().(*flate.Writer)
+		defer writers.Put(w)
+
+		var buf bytes.Buffer
+		w.Reset(&buf)
+
+		if _, err := w.Write(bs); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	decompress = func(bs []byte) ([]byte, error) {
+		r := flate.NewReaderDict(bytes.NewReader(bs), dict)
+		defer r.Close()
+
+		plain, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(plain) > maxSize {
+			return nil, ErrEntryExceedsMaxSize
+		}
+
+		return plain, nil
+	}
+
+	return compress, decompress, nil
+}
@@ -0,0 +1,14 @@
+package aof
+
+import (
+	"os"
+	"syscall"
+)
+
+// directIO disables caching of f with F_NOCACHE, which has no alignment requirements
+func directIO(f *os.File, write bool) (file, error) {
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_NOCACHE, 1); errno != 0 {
+		return nil, errno
+	}
+	return f, nil
+}
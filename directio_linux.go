@@ -0,0 +1,226 @@
+package aof
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// directAlign is the alignment of buffers, offsets and lengths used with O_DIRECT
+const directAlign = 4096
+
+// directFile reads and writes f with O_DIRECT, bypassing the page cache. Writes are extended to whole
+// aligned blocks, merging the data already stored in the first block. The trailing part of a write
+// not filling a block is written through a regular file descriptor, so the file never holds padding
+type directFile struct {
+	f *os.File
+	// tail is used to write partial blocks, nil for read-only files
+	tail *os.File
+	size int64
+	pos  int64
+	// mux guards buf, shared by reads and writes
+	mux sync.Mutex
+	buf []byte
+}
+
+// directIO turns f into a file bypassing the page cache. The returned file takes ownership of f
+func directIO(f *os.File, write bool) (file, error) {
+	flags, err := fcntl(f, syscall.F_GETFL, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fcntl(f, syscall.F_SETFL, (flags|syscall.O_DIRECT)&^syscall.O_APPEND); err != nil {
+		return nil, err
+	}
+
+	d := &directFile{f: f}
+
+	if write {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		d.size = fi.Size()
+
+		d.tail, err = os.OpenFile(f.Name(), os.O_WRONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+func fcntl(f *os.File, cmd int, arg int) (int, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), uintptr(cmd), uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+func pwrite(f *os.File, b []byte, off int64) error {
+	for len(b) > 0 {
+		n, err := syscall.Pwrite(int(f.Fd()), b, off)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+// buffer returns an aligned buffer of n bytes, reused by later calls
+func (d *directFile) buffer(n int) []byte {
+	if cap(d.buf) < n {
+		b := make([]byte, n+directAlign)
+		o := int(uintptr(unsafe.Pointer(&b[0])) & (directAlign - 1))
+		if o != 0 {
+			o = directAlign - o
+		}
+		d.buf = b[o : o+n : o+n]
+	}
+	return d.buf[:n]
+}
+
+func (d *directFile) osFile() *os.File {
+	return d.f
+}
+
+func (d *directFile) ReadAt(p []byte, off int64) (int, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	start := off &^ (directAlign - 1)
+	end := (off + int64(len(p)) + directAlign - 1) &^ (directAlign - 1)
+
+	buf := d.buffer(int(end - start))
+
+	n, err := d.f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	avail := n - int(off-start)
+	if avail <= 0 {
+		return 0, io.EOF
+	}
+
+	c := copy(p, buf[off-start:n])
+	if c < len(p) {
+		return c, io.EOF
+	}
+
+	return c, nil
+}
+
+func (d *directFile) Read(p []byte) (int, error) {
+	n, err := d.ReadAt(p, d.pos)
+	d.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (d *directFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		fi, err := d.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	d.pos = offset
+
+	return offset, nil
+}
+
+func (d *directFile) WriteAt(p []byte, off int64) (int, error) {
+	if d.tail == nil {
+		return 0, os.ErrPermission
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	n := len(p)
+	end := off + int64(n)
+	start := off &^ (directAlign - 1)
+	alignedEnd := end &^ (directAlign - 1)
+
+	// Whole blocks are written directly, merging the data stored before off in the first block
+	if alignedEnd > start {
+		buf := d.buffer(int(alignedEnd - start))
+
+		if off > start {
+			if _, err := d.f.ReadAt(buf[:directAlign], start); err != nil && err != io.EOF {
+				return 0, err
+			}
+		}
+
+		copy(buf[off-start:], p[:alignedEnd-off])
+
+		// os.File refuses WriteAt on files opened with O_APPEND, even once it was cleared
+		if err := pwrite(d.f, buf, start); err != nil {
+			return 0, err
+		}
+
+		p = p[alignedEnd-off:]
+		off = alignedEnd
+	}
+
+	if len(p) > 0 {
+		if _, err := d.tail.WriteAt(p, off); err != nil {
+			return 0, err
+		}
+	}
+
+	if end > d.size {
+		d.size = end
+	}
+
+	return n, nil
+}
+
+func (d *directFile) Write(p []byte) (int, error) {
+	return d.WriteAt(p, d.size)
+}
+
+func (d *directFile) Stat() (os.FileInfo, error) {
+	return d.f.Stat()
+}
+
+func (d *directFile) Sync() error {
+	return d.f.Sync()
+}
+
+func (d *directFile) Truncate(size int64) error {
+	if err := d.f.Truncate(size); err != nil {
+		return err
+	}
+	d.size = size
+	return nil
+}
+
+func (d *directFile) Close() error {
+	if d.tail != nil {
+		d.tail.Close()
+	}
+	return d.f.Close()
+}
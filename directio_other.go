@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package aof
+
+import "os"
+
+// directIO returns f unchanged, direct I/O is not supported
+func directIO(f *os.File, write bool) (file, error) {
+	return f, nil
+}
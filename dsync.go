@@ -0,0 +1,7 @@
+//go:build linux || darwin || netbsd || openbsd
+
+package aof
+
+import "syscall"
+
+const oDSYNC = syscall.O_DSYNC
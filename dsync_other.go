@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !netbsd && !openbsd
+
+package aof
+
+import "os"
+
+// oDSYNC falls back to O_SYNC on platforms without O_DSYNC
+const oDSYNC = os.O_SYNC
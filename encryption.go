@@ -0,0 +1,133 @@
+package aof
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+)
+
+// Encrypted entries are stored as nonce || ciphertext, where the ciphertext includes the GCM tag.
+// A random nonce is generated for every entry. Entries don't record the key they were encrypted with,
+// entries which can't be authenticated with the current key are decrypted with the previous keys in turn
+
+func newAEAD(hdr *header, key []byte) (cipher.AEAD, error) {
+	encrypted := hdr.flags&hEncrypted != 0
+
+	if encrypted != (len(key) > 0) {
+		return nil, ErrEncryptionKey
+	}
+
+	if !encrypted {
+		return nil, nil
+	}
+
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrEncryptionKey
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// newKeyring returns the AEADs of the previous keys, which are only allowed for encrypted files
+func newKeyring(hdr *header, keys [][]byte) ([]cipher.AEAD, error) {
+	if len(keys) > 0 && hdr.flags&hEncrypted == 0 {
+		return nil, ErrEncryptionKey
+	}
+
+	keyring := make([]cipher.AEAD, len(keys))
+
+	for i, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring[i] = aead
+	}
+
+	return keyring, nil
+}
+
+// RotateKey makes key the current encryption key of an encrypted file. New entries are encrypted with key while
+// the previous key is kept to read older entries, which Compact re-encrypts with key. The previous keys must be
+// given in Config.PreviousEncryptionKeys when the file is opened again, the most recent first
+func (app *Appender) RotateKey(key []byte) error {
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if app.aead == nil {
+		return ErrEncryptionKey
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	app.keyring = append([]cipher.AEAD{app.aead}, app.keyring...)
+	app.aead = aead
+
+	app.cfg.PreviousEncryptionKeys = append([][]byte{app.cfg.EncryptionKey}, app.cfg.PreviousEncryptionKeys...)
+	app.cfg.EncryptionKey = append([]byte(nil), key...)
+
+	return nil
+}
+
+// seal returns the bytes to be stored for payload bs. The returned slice is only valid until the next call
+func (app *Appender) seal(bs []byte) ([]byte, error) {
+	if app.aead == nil {
+		return bs, nil
+	}
+
+	nonceSize := app.aead.NonceSize()
+	sealedLen := nonceSize + len(bs) + app.aead.Overhead()
+
+	if cap(app.sharedMem.bufSeal) < sealedLen {
+		app.sharedMem.bufSeal = make([]byte, sealedLen)
+	}
+
+	nonce := app.sharedMem.bufSeal[:nonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, ErrUnexpectedWriteErr
+	}
+
+	return app.aead.Seal(nonce, nonce, bs, nil), nil
+}
+
+// decrypt authenticates and decrypts the stored content of the entry. Incomplete entries are left as is
+func (e *Entry) decrypt(app *Appender) error {
+	if app.aead == nil || e.incomplete {
+		return nil
+	}
+
+	nonceSize := app.aead.NonceSize()
+	if e.size < nonceSize+app.aead.Overhead() {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	stored := e.bytes[:e.size]
+
+	plain, err := app.aead.Open(e.plain[:0], stored[:nonceSize], stored[nonceSize:], nil)
+	for i := 0; err != nil && i < len(app.keyring); i++ {
+		plain, err = app.keyring[i].Open(e.plain[:0], stored[:nonceSize], stored[nonceSize:], nil)
+	}
+	if err != nil {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	e.plain = plain
+	e.payload = plain
+
+	return nil
+}
@@ -1,17 +1,48 @@
 package aof
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
 
 func (e *Entry) Offset() int64 {
 	return e.off
 }
 
+// Size returns the size of the payload, or the stored size for entries read with Appender.ScanMeta
 func (e *Entry) Size() int {
-	return e.size
+	if e.metaOnly {
+		return e.size
+	}
+	return len(e.payload)
 }
 
 func (e *Entry) Bytes() []byte {
-	return e.bytes[:e.size]
+	return e.payload
+}
+
+// Timestamp returns the time at which the entry was appended. The zero time is returned if timestamps are not enabled
+func (e *Entry) Timestamp() time.Time {
+	if e.timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, e.timestamp)
+}
+
+// Type returns the type tag of the entry, see Appender.AppendTyped. Zero is returned if types are not enabled
+func (e *Entry) Type() uint8 {
+	return e.tag
+}
+
+// Version returns the schema version of the entry, see Appender.AppendVersioned. Zero is returned if versions are not enabled
+func (e *Entry) Version() uint16 {
+	return e.version
+}
+
+// Seq returns the sequence number of the entry, zero if sequences are not enabled
+func (e *Entry) Seq() uint64 {
+	return e.seq
 }
 
 func (e *Entry) Incomplete() bool {
@@ -21,3 +52,40 @@ func (e *Entry) Incomplete() bool {
 func (e *Entry) String() string {
 	return fmt.Sprintf("{offset: %v, bytes: %v, incomplete: %v}", e.Offset(), e.Bytes(), e.Incomplete())
 }
+
+var entryPool = sync.Pool{New: func() interface{} { return &Entry{} }}
+
+// Clone returns a copy of the entry which doesn't share memory with it. Entries received by fold handlers and
+// iteration functions are reused for the next entry and must be cloned to be retained.
+// Clones are taken from a pool, Release may be used to return them once they are no longer needed
+func (e *Entry) Clone() *Entry {
+	c := entryPool.Get().(*Entry)
+
+	bytes, payload, key, rawMeta := c.bytes[:0], c.payload[:0], c.key[:0], c.rawMeta[:0]
+
+	*c = *e
+
+	c.bytes = bytes
+	if !e.metaOnly {
+		c.bytes = append(bytes, e.bytes[:e.size]...)
+	}
+	c.payload = append(payload, e.payload...)
+	c.rawMeta = append(rawMeta, e.rawMeta...)
+	c.plain = nil
+	c.key = nil
+	if e.key != nil {
+		c.key = append(key, e.key...)
+	}
+	c.pooled = true
+
+	return c
+}
+
+// Release returns an entry obtained with Clone to the pool so its memory can be reused by later clones.
+// The entry must not be used afterwards. Entries not obtained with Clone are left untouched
+func (e *Entry) Release() {
+	if !e.pooled {
+		return
+	}
+	entryPool.Put(e)
+}
@@ -0,0 +1,126 @@
+package aof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// EntryReader reads the payload of a single entry. It implements io.Reader, io.ReaderAt and io.Seeker
+type EntryReader struct {
+	*io.SectionReader
+	f file
+}
+
+// Close releases the file descriptor used by the reader
+func (r *EntryReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// EntryReader returns a reader limited to the payload of the entry located at offset off. The payload is
+// read from the file on demand through its own file descriptor, so checksums are not verified.
+// Payloads of encrypted files are read and decrypted upfront. Readers must be closed
+func (app *Appender) EntryReader(off int64) (*EntryReader, error) {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return nil, ErrAppenderClosed
+	}
+
+	if off < 0 || off >= app.size {
+		app.mux.Unlock()
+		return nil, ErrInvalidArguments
+	}
+
+	if off < app.head {
+		app.mux.Unlock()
+		return nil, ErrOffsetPurged
+	}
+
+	start, known := app.knownBoundary(off)
+
+	v := app.view()
+
+	rd, err := app.acquireReader()
+	app.mux.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	defer app.releaseReader(rd)
+
+	if !known {
+		boundary, err := app.readBoundary(rd, v.dataOffset, start, off)
+		if err != nil {
+			return nil, err
+		}
+		if !boundary {
+			return nil, ErrNotEntryBoundary
+		}
+	}
+
+	if app.aead != nil {
+		e, err := app.readEntryWith(rd, v.dataOffset, off)
+		if err != nil {
+			return nil, err
+		}
+		if e.incomplete {
+			return nil, ErrLastEntryIncomplete
+		}
+
+		payload := append([]byte(nil), e.payload...)
+
+		return &EntryReader{SectionReader: io.NewSectionReader(bytes.NewReader(payload), 0, int64(len(payload)))}, nil
+	}
+
+	if err := rd.seek(v.dataOffset + off); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{off: off}
+
+	_, ms, err := e.readEntrySize(app, rd)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if ms > 0 {
+		return nil, ErrLastEntryIncomplete
+	}
+
+	f, err := app.openFile()
+	if err != nil {
+		return nil, err
+	}
+
+	pos := v.dataOffset + off + int64(e.sizeLen) + int64(len(rd.bufMeta))
+	size := int64(e.size)
+
+	flag := make([]byte, 1)
+	if _, err := f.ReadAt(flag, pos+size); err != nil || flag[0] != fCompleteEntry {
+		f.Close()
+		return nil, ErrLastEntryIncomplete
+	}
+
+	if app.cfg.Keyed {
+		b := make([]byte, binary.MaxVarintLen64)
+		n, _ := f.ReadAt(b[:min(size, int64(len(b)))], pos)
+
+		l, n := binary.Uvarint(b[:n])
+		if n <= 0 || l > uint64(size)-uint64(n) {
+			f.Close()
+			return nil, &CorruptedEntryError{Offset: off}
+		}
+
+		pos += int64(n) + int64(l)
+		size -= int64(n) + int64(l)
+	}
+
+	return &EntryReader{SectionReader: io.NewSectionReader(f, pos, size), f: f}, nil
+}
@@ -0,0 +1,59 @@
+package aof
+
+import "time"
+
+// pendingBatch holds the entries of an AppendBulk call written to the buffer but not flushed yet
+type pendingBatch struct {
+	offs         []int64
+	writtenBytes int64
+	payloadBytes int64
+	m            entryMeta
+}
+
+// deferFlush returns true if appended entries are left buffered until the next periodic flush
+func (app *Appender) deferFlush() bool {
+	return app.cfg.FlushInterval > 0
+}
+
+// flushPending flushes the buffer and registers the entries it held, which become visible to readers
+func (app *Appender) flushPending() error {
+	if len(app.pending) == 0 {
+		return nil
+	}
+
+	if err := app.w.Flush(); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	pending := app.pending
+	app.pending = nil
+	app.pendingBytes = 0
+
+	for i := range pending {
+		b := &pending[i]
+		if err := app.flushed(b.offs, b.writtenBytes, b.payloadBytes, &b.m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *Appender) flushLoop(period time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			app.mux.Lock()
+			if !app.closed {
+				app.flushPending()
+			}
+			app.mux.Unlock()
+		}
+	}
+}
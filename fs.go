@@ -0,0 +1,179 @@
+package aof
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// file is the part of *os.File used by appenders and readers
+type file interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (fs.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// fsFile adapts a file opened from an fs.FS. Files not supporting random access are read into memory
+type fsFile struct {
+	fs.File
+	r interface {
+		io.Reader
+		io.ReaderAt
+		io.Seeker
+	}
+}
+
+func openFSFile(fsys fs.FS, name string) (*fsFile, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ff := &fsFile{File: f}
+
+	if r, ok := f.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		ff.r = struct {
+			io.Reader
+			io.ReaderAt
+			io.Seeker
+		}{f, r, r}
+		return ff, nil
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ff.r = bytes.NewReader(b)
+
+	return ff, nil
+}
+
+func (f *fsFile) Read(b []byte) (int, error) {
+	return f.r.Read(b)
+}
+
+func (f *fsFile) ReadAt(b []byte, off int64) (int, error) {
+	return f.r.ReadAt(b, off)
+}
+
+func (f *fsFile) Seek(off int64, whence int) (int64, error) {
+	return f.r.Seek(off, whence)
+}
+
+func (f *fsFile) Write(b []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (f *fsFile) Sync() error {
+	return ErrReadOnly
+}
+
+func (f *fsFile) Truncate(size int64) error {
+	return ErrReadOnly
+}
+
+// OpenFS opens the file name of fsys read-only using the default configuration
+func OpenFS(fsys fs.FS, name string) (app *Appender, err error) {
+	return OpenFSWithConfig(fsys, name, &Config{
+		MaxEntrySize:  DefaultMaxEntrySize,
+		BaseOffset:    DefaultBaseOffset,
+		ReadOnly:      true,
+		Recovery:      DefaultRecovery,
+		IndexInterval: DefaultIndexInterval,
+		PersistIndex:  DefaultPersistIndex,
+	})
+}
+
+// OpenFSWithConfig opens the file name of fsys. Files are always opened read-only
+func OpenFSWithConfig(fsys fs.FS, name string, cfg *Config) (app *Appender, err error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	rcfg := *cfg
+	rcfg.ReadOnly = true
+
+	f, err := openFSFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return openWith(name, f, fsys, nil, &rcfg)
+}
+
+// openFile opens the file of the appender again for reading
+func (app *Appender) openFile() (file, error) {
+	if app.fsys != nil {
+		return openFSFile(app.fsys, app.filename)
+	}
+
+	if app.handle != nil {
+		return app.handle.view(), nil
+	}
+
+	f, err := os.Open(app.filename)
+	if err != nil || !app.cfg.DirectIO {
+		return f, err
+	}
+
+	df, err := directIO(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return df, nil
+}
+
+// osFile returns the operating system file backing f, if any
+func osFile(f file) (*os.File, bool) {
+	switch f := f.(type) {
+	case *os.File:
+		return f, true
+	case interface{ osFile() *os.File }:
+		osf := f.osFile()
+		return osf, osf != nil
+	}
+	return nil, false
+}
+
+func (app *Appender) statFile() (fs.FileInfo, error) {
+	if app.fsys != nil {
+		return fs.Stat(app.fsys, app.filename)
+	}
+	if app.handle != nil {
+		return app.f.Stat()
+	}
+	return os.Stat(app.filename)
+}
+
+func (app *Appender) readFile(name string) ([]byte, error) {
+	if app.fsys != nil {
+		return fs.ReadFile(app.fsys, name)
+	}
+	return os.ReadFile(name)
+}
+
+// sameFile reports whether fi and cur describe the same file. Files of an fs.FS are compared by
+// size and modification time, files managed by the caller are never replaced
+func (app *Appender) sameFile(fi fs.FileInfo, cur fs.FileInfo) bool {
+	if app.handle != nil {
+		return true
+	}
+	if app.fsys != nil {
+		return fi.Size() == cur.Size() && fi.ModTime().Equal(cur.ModTime())
+	}
+	return os.SameFile(fi, cur)
+}
@@ -0,0 +1,48 @@
+package aof
+
+// Folder is implemented by Appender, Log and Snapshot
+type Folder interface {
+	FoldWithHandler(handler FoldHandler) error
+}
+
+// Map returns the values produced by f for every entry in src
+func Map[T any](src Folder, f func(e *Entry) (r T, cutoff bool, err error)) (ls []T, err error) {
+	err = src.FoldWithHandler(&forEachHandler{f: func(e *Entry) (bool, error) {
+		r, cutoff, err := f(e)
+		if err != nil {
+			return false, err
+		}
+		ls = append(ls, r)
+		return cutoff, nil
+	}})
+	return ls, err
+}
+
+// FilteredMap returns the values produced by m for every entry in src accepted by f
+func FilteredMap[T any](src Folder, f FilterFn, m func(e *Entry) (r T, cutoff bool, err error)) (ls []T, err error) {
+	err = src.FoldWithHandler(&forEachHandler{f: func(e *Entry) (bool, error) {
+		include, fcutoff, err := f(e)
+		if err != nil || !include {
+			return fcutoff, err
+		}
+		r, mcutoff, err := m(e)
+		if err != nil {
+			return false, err
+		}
+		ls = append(ls, r)
+		return fcutoff || mcutoff, nil
+	}})
+	return ls, err
+}
+
+// Fold reduces the entries in src into a value of type T starting from v
+func Fold[T any](src Folder, f func(e *Entry, pred T) (red T, cutoff bool, err error), v T) (ret T, err error) {
+	err = src.FoldWithHandler(&forEachHandler{f: func(e *Entry) (bool, error) {
+		nv, cutoff, err := f(e, v)
+		if err == nil {
+			v = nv
+		}
+		return cutoff, err
+	}})
+	return v, err
+}
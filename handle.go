@@ -0,0 +1,212 @@
+package aof
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// OpenFile opens an appender over f, a file managed by the caller. f must be opened for reading, and for
+// writing unless cfg.ReadOnly is set. f is neither locked nor closed by the appender, and Compact is not supported
+func OpenFile(f *os.File, cfg *Config) (app *Appender, err error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	h := &handle{rw: f, f: f}
+
+	return openWith(f.Name(), h.view(), nil, h, cfg)
+}
+
+// OpenRW opens an appender over rw. Every access seeks rw first, so it must not be used by the caller while
+// the appender is open. rw is synced and truncated when it implements Sync and Truncate, and it is never closed.
+// Without a file name the index and consumers are not persisted, and Compact is not supported
+func OpenRW(rw io.ReadWriteSeeker, cfg *Config) (app *Appender, err error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	hcfg := *cfg
+	hcfg.PersistIndex = false
+
+	h := &handle{rw: rw}
+
+	return openWith("", h.view(), nil, h, &hcfg)
+}
+
+// handle is a file managed by the caller, shared by the appender and its readers
+type handle struct {
+	mux sync.Mutex
+	rw  io.ReadWriteSeeker
+	// f is set when rw is an *os.File, so reads do not need to seek
+	f *os.File
+}
+
+// view returns a file reading from h with its own position. Writes always go to the end of h
+func (h *handle) view() *handleFile {
+	return &handleFile{h: h}
+}
+
+func (h *handle) readAt(b []byte, off int64) (int, error) {
+	if h.f != nil {
+		return h.f.ReadAt(b, off)
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if _, err := h.rw.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(h.rw, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (h *handle) writeAt(b []byte, off int64) (int, error) {
+	if h.f != nil {
+		n, err := h.f.WriteAt(b, off)
+		if err == nil {
+			return n, nil
+		}
+
+		// Files opened with O_APPEND do not support WriteAt
+		f, err := os.OpenFile(h.f.Name(), os.O_WRONLY, 0)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+
+		return f.WriteAt(b, off)
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if _, err := h.rw.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return h.rw.Write(b)
+}
+
+func (h *handle) size() (int64, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	return h.rw.Seek(0, io.SeekEnd)
+}
+
+// handleFile implements file over a handle
+type handleFile struct {
+	h   *handle
+	pos int64
+}
+
+func (f *handleFile) Read(b []byte) (int, error) {
+	n, err := f.h.readAt(b, f.pos)
+	f.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *handleFile) ReadAt(b []byte, off int64) (int, error) {
+	return f.h.readAt(b, off)
+}
+
+func (f *handleFile) Write(b []byte) (int, error) {
+	f.h.mux.Lock()
+	defer f.h.mux.Unlock()
+
+	if _, err := f.h.rw.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+
+	return f.h.rw.Write(b)
+}
+
+func (f *handleFile) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		off += f.pos
+	case io.SeekEnd:
+		size, err := f.h.size()
+		if err != nil {
+			return 0, err
+		}
+		off += size
+	}
+
+	if off < 0 {
+		return 0, ErrInvalidArguments
+	}
+
+	f.pos = off
+
+	return off, nil
+}
+
+// Close does nothing, the caller closes the handle
+func (f *handleFile) Close() error {
+	return nil
+}
+
+func (f *handleFile) Stat() (fs.FileInfo, error) {
+	if f.h.f != nil {
+		return f.h.f.Stat()
+	}
+
+	size, err := f.h.size()
+	if err != nil {
+		return nil, err
+	}
+
+	return handleInfo{size: size}, nil
+}
+
+func (f *handleFile) Sync() error {
+	if f.h.f != nil {
+		return f.h.f.Sync()
+	}
+	if s, ok := f.h.rw.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (f *handleFile) Truncate(size int64) error {
+	if f.h.f != nil {
+		return f.h.f.Truncate(size)
+	}
+	if t, ok := f.h.rw.(interface{ Truncate(size int64) error }); ok {
+		f.h.mux.Lock()
+		defer f.h.mux.Unlock()
+
+		return t.Truncate(size)
+	}
+	return ErrUnsupported
+}
+
+func (f *handleFile) osFile() *os.File {
+	return f.h.f
+}
+
+// handleInfo describes a handle not backed by an operating system file
+type handleInfo struct {
+	size int64
+}
+
+func (fi handleInfo) Name() string       { return "" }
+func (fi handleInfo) Size() int64        { return fi.size }
+func (fi handleInfo) Mode() fs.FileMode  { return 0 }
+func (fi handleInfo) ModTime() time.Time { return time.Time{} }
+func (fi handleInfo) IsDir() bool        { return false }
+func (fi handleInfo) Sys() any           { return nil }
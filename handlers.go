@@ -92,13 +92,17 @@ func (h *filteredMapHandler) Values() []interface{} {
 	return ls
 }
 
+// sizeFoldHandler computes the size of the file and builds its offset index
 type sizeFoldHandler struct {
 	app  *Appender
 	size int64
 }
 
 func (h *sizeFoldHandler) Fold(e *Entry) (bool, error) {
-	h.size += int64(len(h.app.sharedMem.bufRWEntrySize) + e.size + len(h.app.sharedMem.bufRWEntryFlag))
+	if err := h.app.track(e); err != nil {
+		return false, err
+	}
+	h.size += h.app.entryFrameLen(e)
 	return false, nil
 }
 
@@ -109,3 +113,164 @@ func (h *sizeFoldHandler) Value() interface{} {
 func (h *sizeFoldHandler) Values() []interface{} {
 	return nil
 }
+
+// segmentFoldHandler translates segment offsets into logical offsets before delegating to handler
+type segmentFoldHandler struct {
+	handler FoldHandler
+	start   int64
+	cutoff  bool
+}
+
+func (h *segmentFoldHandler) Fold(e *Entry) (bool, error) {
+	e.off += h.start
+	cutoff, err := h.handler.Fold(e)
+	h.cutoff = cutoff
+	return cutoff, err
+}
+
+func (h *segmentFoldHandler) Value() interface{} {
+	return h.handler.Value()
+}
+
+func (h *segmentFoldHandler) Values() []interface{} {
+	return h.handler.Values()
+}
+
+type compactHandler struct {
+	f       CompactFn
+	dst     *Appender
+	offsets map[int64]int64
+}
+
+func (h *compactHandler) Fold(e *Entry) (bool, error) {
+	if e.incomplete {
+		return false, nil
+	}
+
+	keep, replacement, err := h.f(e)
+	if err != nil || !keep {
+		return false, err
+	}
+
+	bs := e.Bytes()
+	if replacement != nil {
+		bs = replacement
+	}
+
+	offs, err := h.dst.appendBulk([][]byte{bs}, &entryMeta{timestamp: e.timestamp, tag: e.tag, seq: e.seq, version: e.version, key: e.key, checkpoint: e.checkpoint})
+	if err != nil {
+		return false, err
+	}
+
+	h.offsets[e.off] = offs[0]
+
+	return false, nil
+}
+
+func (h *compactHandler) Value() interface{} {
+	return h.offsets
+}
+
+func (h *compactHandler) Values() []interface{} {
+	return nil
+}
+
+// boundaryHandler looks for an entry starting at offset off
+type boundaryHandler struct {
+	off   int64
+	found bool
+}
+
+func (h *boundaryHandler) Fold(e *Entry) (bool, error) {
+	h.found = e.off == h.off
+	return e.off >= h.off, nil
+}
+
+func (h *boundaryHandler) Value() interface{} {
+	return h.found
+}
+
+func (h *boundaryHandler) Values() []interface{} {
+	return nil
+}
+
+// nthHandler looks for the offset of the n-th entry
+type nthHandler struct {
+	n   int64
+	off int64
+}
+
+func (h *nthHandler) Fold(e *Entry) (bool, error) {
+	h.off = e.off
+	h.n--
+	return h.n < 0, nil
+}
+
+func (h *nthHandler) Value() interface{} {
+	return h.off
+}
+
+func (h *nthHandler) Values() []interface{} {
+	return nil
+}
+
+// blockHandler collects the offsets of up to max entries located before offset end
+type blockHandler struct {
+	end  int64
+	max  int
+	offs []int64
+}
+
+func (h *blockHandler) Fold(e *Entry) (bool, error) {
+	if e.off >= h.end {
+		return true, nil
+	}
+	h.offs = append(h.offs, e.off)
+	return len(h.offs) == h.max, nil
+}
+
+func (h *blockHandler) Value() interface{} {
+	return h.offs
+}
+
+func (h *blockHandler) Values() []interface{} {
+	return nil
+}
+
+type indexFoldHandler struct {
+	app *Appender
+}
+
+func (h *indexFoldHandler) Fold(e *Entry) (bool, error) {
+	return false, h.app.track(e)
+}
+
+func (h *indexFoldHandler) Value() interface{} {
+	return h.app.index.count
+}
+
+func (h *indexFoldHandler) Values() []interface{} {
+	return nil
+}
+
+// sinceHandler finds the first complete entry with a timestamp at or after ts
+type sinceHandler struct {
+	ts  int64
+	off int64
+}
+
+func (h *sinceHandler) Fold(e *Entry) (bool, error) {
+	if e.incomplete || e.timestamp < h.ts {
+		return false, nil
+	}
+	h.off = e.off
+	return true, nil
+}
+
+func (h *sinceHandler) Value() interface{} {
+	return h.off
+}
+
+func (h *sinceHandler) Values() []interface{} {
+	return nil
+}
@@ -0,0 +1,432 @@
+package aof
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// File header layout:
+//
+//	magic (4 bytes) | version (1 byte) | flags (2 bytes) | maxEntrySize (4 bytes) | head (8 bytes) | generation (8 bytes)
+//
+// The header is written and synced at BaseOffset when the file is created, a file holding only part of it, left by a
+// crash, is created again. Entry offsets are relative to the end of the header.
+// head is the offset of the first entry not removed with TruncateHead. generation is increased every time existing
+// offsets are invalidated by Truncate or Compact. Version 1 headers have no generation field.
+// Files written before headers were introduced, handled as version 0, start with their first entry and use the
+// MaxEntrySize given on Open with no other format setting. Their head and generation can't be changed
+// Files allowing entries larger than 4GiB set hLargeEntries and append the high 32 bits of maxEntrySize (4 bytes).
+// Files compressing entries with a dictionary set hDictionary and append, after the fields above:
+//
+//	compressor (1 byte) | dictionaryLen (4 bytes) | dictionary
+const headerLen = 27
+
+const headerLargeLen = headerLen + 4
+
+const headerV1Len = 19
+
+const headerHeadPos = 11
+
+const headerGenerationPos = 19
+
+const headerDictionaryLen = 5
+
+// maxHeaderDictionaryLen bounds the dictionary read from headers, so a corrupted length doesn't cause a huge allocation
+const maxHeaderDictionaryLen = 1 << 20
+
+const formatVersion uint8 = 2
+
+// errPartialHeader is returned while reading a header the file ends before
+var errPartialHeader = errors.New("aof: Partial header")
+
+var headerMagic = []byte{'G', 'A', 'O', 'F'}
+
+const (
+	hChecksum uint16 = 1 << iota
+	hVarintSize
+	hEncrypted
+	hTimestamp
+	hType
+	hSequence
+	hKeyed
+	hTransactions
+	hTombstones
+	// hLargeEntries is set when maxEntrySize needs more than 32 bits, entry sizes are then stored in 8 bytes
+	hLargeEntries
+	hVersions
+	hSigned
+	hChained
+	hDedup
+	hCheckpoints
+	hDictionary
+)
+
+const hKnownFlags = hChecksum | hVarintSize | hEncrypted | hTimestamp | hType | hSequence | hKeyed | hTransactions |
+	hTombstones | hLargeEntries | hVersions | hSigned | hChained | hDedup | hCheckpoints | hDictionary
+
+type header struct {
+	version      uint8
+	flags        uint16
+	maxEntrySize int
+	head         int64
+	generation   uint64
+	// compressor and dictionary are set when hDictionary is
+	compressor DictionaryCompressor
+	dictionary []byte
+}
+
+func newHeader(cfg *Config) *header {
+	hdr := &header{
+		version:      formatVersion,
+		maxEntrySize: cfg.MaxEntrySize,
+	}
+
+	if cfg.Checksum {
+		hdr.flags |= hChecksum
+	}
+
+	if cfg.VarintSize {
+		hdr.flags |= hVarintSize
+	}
+
+	if len(cfg.EncryptionKey) > 0 {
+		hdr.flags |= hEncrypted
+	}
+
+	if len(cfg.SigningKey) > 0 {
+		hdr.flags |= hSigned
+	}
+
+	if cfg.Timestamps {
+		hdr.flags |= hTimestamp
+	}
+
+	if cfg.Types {
+		hdr.flags |= hType
+	}
+
+	if cfg.Sequences {
+		hdr.flags |= hSequence
+	}
+
+	if cfg.Keyed {
+		hdr.flags |= hKeyed
+	}
+
+	if cfg.Transactions {
+		hdr.flags |= hTransactions
+	}
+
+	if cfg.Tombstones {
+		hdr.flags |= hTombstones
+	}
+
+	if cfg.Versions {
+		hdr.flags |= hVersions
+	}
+
+	if cfg.Chained {
+		hdr.flags |= hChained
+	}
+
+	if cfg.Dedup {
+		hdr.flags |= hDedup
+	}
+
+	if cfg.Checkpoints {
+		hdr.flags |= hCheckpoints
+	}
+
+	if uint64(cfg.MaxEntrySize) > math.MaxUint32 {
+		hdr.flags |= hLargeEntries
+	}
+
+	if len(cfg.Dictionary) > 0 {
+		hdr.flags |= hDictionary
+		hdr.compressor = cfg.DictionaryCompressor
+		if hdr.compressor == nil {
+			hdr.compressor = DeflateDictionary
+		}
+		hdr.dictionary = bytes.Clone(cfg.Dictionary)
+	}
+
+	return hdr
+}
+
+// config returns a copy of cfg with the format settings recorded in the header
+func (hdr *header) config(cfg *Config) *Config {
+	c := *cfg
+	c.MaxEntrySize = hdr.maxEntrySize
+	c.Checksum = hdr.flags&hChecksum != 0
+	c.VarintSize = hdr.flags&hVarintSize != 0
+	c.Timestamps = hdr.flags&hTimestamp != 0
+	c.Types = hdr.flags&hType != 0
+	c.Sequences = hdr.flags&hSequence != 0
+	c.Keyed = hdr.flags&hKeyed != 0
+	c.Transactions = hdr.flags&hTransactions != 0
+	c.Tombstones = hdr.flags&hTombstones != 0
+	c.Versions = hdr.flags&hVersions != 0
+	c.Chained = hdr.flags&hChained != 0
+	c.Dedup = hdr.flags&hDedup != 0
+	c.Checkpoints = hdr.flags&hCheckpoints != 0
+	c.Dictionary = hdr.dictionary
+	c.DictionaryCompressor = hdr.compressor
+	return &c
+}
+
+// len returns the number of bytes used by the header
+func (hdr *header) len() int {
+	n := hdr.fixedLen()
+	if hdr.flags&hDictionary != 0 {
+		n += headerDictionaryLen + len(hdr.dictionary)
+	}
+	return n
+}
+
+// fixedLen returns the number of bytes used by the header fields preceding the dictionary
+func (hdr *header) fixedLen() int {
+	if hdr.version == 0 {
+		return 0
+	}
+	if hdr.version == 1 {
+		return headerV1Len
+	}
+	if hdr.flags&hLargeEntries != 0 {
+		return headerLargeLen
+	}
+	return headerLen
+}
+
+func (hdr *header) encode() []byte {
+	b := make([]byte, hdr.len())
+	copy(b, headerMagic)
+	b[4] = hdr.version
+	byteOrder.PutUint16(b[5:], hdr.flags)
+	byteOrder.PutUint32(b[7:], uint32(hdr.maxEntrySize))
+	byteOrder.PutUint64(b[headerHeadPos:], uint64(hdr.head))
+	byteOrder.PutUint64(b[headerGenerationPos:], hdr.generation)
+	if hdr.flags&hLargeEntries != 0 {
+		byteOrder.PutUint32(b[headerLen:], uint32(uint64(hdr.maxEntrySize)>>32))
+	}
+	if hdr.flags&hDictionary != 0 {
+		n := hdr.fixedLen()
+		b[n] = hdr.compressor.ID()
+		byteOrder.PutUint32(b[n+1:], uint32(len(hdr.dictionary)))
+		copy(b[n+headerDictionaryLen:], hdr.dictionary)
+	}
+	return b
+}
+
+// dictionarySum returns a checksum of the compressor and dictionary of the file, zero if it has none
+func (hdr *header) dictionarySum() uint32 {
+	if hdr.flags&hDictionary == 0 {
+		return 0
+	}
+	return crc32.Update(crc32.ChecksumIEEE([]byte{hdr.compressor.ID()}), crc32.IEEETable, hdr.dictionary)
+}
+
+func decodeHeader(b []byte) (*header, error) {
+	if len(b) < headerV1Len || !bytes.Equal(b[:4], headerMagic) {
+		return nil, ErrInvalidHeader
+	}
+
+	hdr := &header{
+		version:      b[4],
+		flags:        byteOrder.Uint16(b[5:]),
+		maxEntrySize: int(byteOrder.Uint32(b[7:])),
+		head:         int64(byteOrder.Uint64(b[headerHeadPos:])),
+	}
+
+	if hdr.version < 1 || hdr.version > formatVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	if hdr.version > 1 {
+		if len(b) < headerLen {
+			return nil, ErrInvalidHeader
+		}
+		hdr.generation = byteOrder.Uint64(b[headerGenerationPos:])
+	}
+
+	if hdr.flags&^hKnownFlags != 0 {
+		return nil, ErrInvalidHeader
+	}
+
+	if hdr.flags&hLargeEntries != 0 {
+		if hdr.version < 2 || len(b) < headerLargeLen {
+			return nil, ErrInvalidHeader
+		}
+		hdr.maxEntrySize |= int(uint64(byteOrder.Uint32(b[headerLen:])) << 32)
+	}
+
+	if hdr.flags&hDictionary != 0 && hdr.version < 2 {
+		return nil, ErrInvalidHeader
+	}
+
+	if hdr.maxEntrySize < 1 || hdr.head < 0 {
+		return nil, ErrInvalidHeader
+	}
+
+	return hdr, nil
+}
+
+// openHeader reads and validates the header of f, writing a new one when the file is empty
+func openHeader(f file, cfg *Config) (*header, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, ErrUnexpectedReadError
+	}
+
+	if fi.Size() < cfg.BaseOffset {
+		return nil, ErrInvalidArguments
+	}
+
+	if fi.Size() == cfg.BaseOffset {
+		return createHeader(f, cfg, false)
+	}
+
+	// Version 1 files may be shorter than the current header
+	b := make([]byte, headerLargeLen)
+	n, err := f.ReadAt(b, cfg.BaseOffset)
+	if err != nil && err != io.EOF {
+		return nil, ErrUnexpectedReadError
+	}
+
+	// A crash while the file was created may leave part of its header and no entry
+	if partialHeader(b[:n]) {
+		return createHeader(f, cfg, true)
+	}
+
+	if n >= len(headerMagic) && !bytes.Equal(b[:len(headerMagic)], headerMagic) {
+		return legacyHeader(f, cfg, fi.Size())
+	}
+
+	hdr, err := decodeHeader(b[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.flags&hDictionary != 0 {
+		err := hdr.readDictionary(f, cfg.BaseOffset+int64(hdr.fixedLen()))
+		if err == errPartialHeader {
+			return createHeader(f, cfg, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hdr, nil
+}
+
+// createHeader writes and syncs a new header at the base offset of f, first dropping the partial header found
+// there when partial is set
+func createHeader(f file, cfg *Config, partial bool) (*header, error) {
+	hdr := newHeader(cfg)
+
+	if cfg.ReadOnly {
+		return hdr, nil
+	}
+
+	if partial {
+		if err := f.Truncate(cfg.BaseOffset); err != nil {
+			return nil, ErrUnexpectedWriteErr
+		}
+	}
+
+	if _, err := f.Write(hdr.encode()); err != nil {
+		return nil, ErrUnexpectedWriteErr
+	}
+
+	if err := f.Sync(); err != nil {
+		return nil, ErrUnexpectedWriteErr
+	}
+
+	return hdr, nil
+}
+
+// partialHeader reports whether b, read from the base offset of a file, ends before the header it starts.
+// Valid files always hold a whole header, and b is only shorter than headerLargeLen when the file ends
+func partialHeader(b []byte) bool {
+	if len(b) < len(headerMagic) {
+		return bytes.HasPrefix(headerMagic, b)
+	}
+
+	if !bytes.Equal(b[:len(headerMagic)], headerMagic) {
+		return false
+	}
+
+	if len(b) < headerV1Len {
+		return true
+	}
+
+	hdr := &header{version: b[4], flags: byteOrder.Uint16(b[5:])}
+
+	return hdr.version >= 1 && hdr.version <= formatVersion && len(b) < hdr.fixedLen()
+}
+
+// readDictionary reads the compressor and dictionary recorded at offset off of f
+func (hdr *header) readDictionary(f file, off int64) error {
+	b := make([]byte, headerDictionaryLen)
+	if _, err := f.ReadAt(b, off); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errPartialHeader
+	} else if err != nil {
+		return ErrInvalidHeader
+	}
+
+	n := byteOrder.Uint32(b[1:])
+	if n == 0 || n > maxHeaderDictionaryLen {
+		return ErrInvalidHeader
+	}
+
+	compressor := lookupDictionaryCompressor(b[0])
+	if compressor == nil {
+		return ErrUnknownCompressor
+	}
+
+	dictionary := make([]byte, n)
+	if _, err := f.ReadAt(dictionary, off+headerDictionaryLen); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errPartialHeader
+	} else if err != nil {
+		return ErrInvalidHeader
+	}
+
+	hdr.compressor = compressor
+	hdr.dictionary = dictionary
+
+	return nil
+}
+
+// legacyHeader returns the version 0 header of files written before headers were introduced. Their first entry
+// must be complete, so files which are not append-only files are not mistaken for them
+func legacyHeader(f file, cfg *Config, fileSize int64) (*header, error) {
+	if uint64(cfg.MaxEntrySize) > math.MaxUint32 {
+		return nil, ErrInvalidHeader
+	}
+
+	b := make([]byte, entrySizeLen(cfg.MaxEntrySize))
+	if _, err := f.ReadAt(b, cfg.BaseOffset); err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	size := readInt(b)
+	flagOff := cfg.BaseOffset + int64(len(b)+size)
+
+	if size < 1 || size > cfg.MaxEntrySize || flagOff >= fileSize {
+		return nil, ErrInvalidHeader
+	}
+
+	flag := make([]byte, 1)
+	if _, err := f.ReadAt(flag, flagOff); err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	if flag[0] != fCompleteEntry && flag[0] != fIncompleteEntry {
+		return nil, ErrInvalidHeader
+	}
+
+	return &header{maxEntrySize: cfg.MaxEntrySize}, nil
+}
@@ -0,0 +1,21 @@
+package aof
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// punchHole deallocates the given range of f without changing its size. Errors are ignored as
+// the range is already logically removed
+func punchHole(f *os.File, off int64, size int64) {
+	if size <= 0 {
+		return
+	}
+
+	syscall.Fallocate(int(f.Fd()), fallocKeepSize|fallocPunchHole, off, size)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package aof
+
+import "os"
+
+// punchHole is a no-op on platforms without hole punching support
+func punchHole(f *os.File, off int64, size int64) {
+}
@@ -0,0 +1,48 @@
+package aof
+
+// HookFn transforms the content of an entry, see Config.AppendHooks and Config.ReadHooks.
+// Hooks must not modify bs, a new slice has to be returned instead
+type HookFn func(bs []byte) ([]byte, error)
+
+// runHooks passes bs through every hook in order
+func runHooks(hooks []HookFn, bs []byte) ([]byte, error) {
+	for _, h := range hooks {
+		var err error
+
+		bs, err = h(bs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bs, nil
+}
+
+// readHooks replaces the payload of e with the result of the read hooks. Incomplete entries and tombstones are left as is
+func (app *Appender) readHooks(e *Entry) error {
+	if len(app.cfg.ReadHooks) == 0 || e.incomplete || e.tombstone {
+		return nil
+	}
+
+	bs, err := runHooks(app.cfg.ReadHooks, e.payload)
+	if err != nil {
+		return err
+	}
+
+	e.payload = bs
+
+	return nil
+}
+
+// readHooksHandler runs the read hooks over every entry before passing it to the wrapped handler
+type readHooksHandler struct {
+	FoldHandler
+	app *Appender
+}
+
+func (h *readHooksHandler) Fold(e *Entry) (bool, error) {
+	if err := h.app.readHooks(e); err != nil {
+		return true, err
+	}
+	return h.FoldHandler.Fold(e)
+}
@@ -0,0 +1,84 @@
+package aof
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// idempotencyWindow remembers the offsets of the entries appended with AppendIdempotent during the
+// last window, oldest first. It is only used with mux held
+type idempotencyWindow struct {
+	window time.Duration
+	ll     *list.List
+	items  map[string]*list.Element
+}
+
+type idempotentAppend struct {
+	id  string
+	off int64
+	at  time.Time
+}
+
+func newIdempotencyWindow(window time.Duration) *idempotencyWindow {
+	if window == 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return &idempotencyWindow{window: window, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the offset of the entry appended with id during the window ending at now
+func (w *idempotencyWindow) get(id string, now time.Time) (int64, bool) {
+	for el := w.ll.Front(); el != nil && now.Sub(el.Value.(*idempotentAppend).at) >= w.window; el = w.ll.Front() {
+		delete(w.items, el.Value.(*idempotentAppend).id)
+		w.ll.Remove(el)
+	}
+
+	el, ok := w.items[id]
+	if !ok {
+		return 0, false
+	}
+	return el.Value.(*idempotentAppend).off, true
+}
+
+func (w *idempotencyWindow) put(id string, off int64, now time.Time) {
+	w.items[id] = w.ll.PushBack(&idempotentAppend{id: id, off: off, at: now})
+}
+
+// reset forgets every id, needed once offsets are no longer valid
+func (w *idempotencyWindow) reset() {
+	w.ll.Init()
+	clear(w.items)
+}
+
+// AppendIdempotent appends bs unless an entry was appended with the same id during the last
+// Config.IdempotencyWindow, in which case the offset of that entry is returned. Producers retrying an append
+// with the same id don't create duplicates. Ids are kept in memory, and forgotten when the appender is closed or
+// entries are removed by Truncate, TruncateHead or Compact
+func (app *Appender) AppendIdempotent(id []byte, bs []byte) (off int64, err error) {
+	if len(id) == 0 {
+		return 0, ErrInvalidArguments
+	}
+
+	if err := app.throttle(context.Background(), [][]byte{bs}); err != nil {
+		return 0, err
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	now := time.Now()
+
+	if off, ok := app.idempotency.get(string(id), now); ok && !app.closed {
+		return off, nil
+	}
+
+	offs, err := app.appendBulk([][]byte{bs}, &entryMeta{})
+	if err != nil {
+		return 0, err
+	}
+
+	app.idempotency.put(string(id), offs[0], now)
+
+	return offs[0], nil
+}
@@ -0,0 +1,248 @@
+package aof
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+// sparseIndex keeps the offset of every n-th entry, counting from the first entry after the head.
+// It allows locating entries by ordinal or nearby offset without scanning the whole file
+type sparseIndex struct {
+	every int
+	count int64
+	offs  []int64
+}
+
+func newSparseIndex(every int) *sparseIndex {
+	if every == 0 {
+		every = DefaultIndexInterval
+	}
+	return &sparseIndex{every: every}
+}
+
+// add registers the entry located at offset off, which must follow every previously added entry
+func (idx *sparseIndex) add(off int64) {
+	if idx.count%int64(idx.every) == 0 {
+		idx.offs = append(idx.offs, off)
+	}
+	idx.count++
+}
+
+func (idx *sparseIndex) reset() {
+	idx.count = 0
+	idx.offs = idx.offs[:0]
+}
+
+// nearestOrdinal returns the closest indexed entry at or before the entry with ordinal n
+func (idx *sparseIndex) nearestOrdinal(n int64) (ordinal int64, off int64) {
+	i := n / int64(idx.every)
+	return i * int64(idx.every), idx.offs[i]
+}
+
+// nearestOffset returns the closest indexed entry located at or before offset off.
+// It must only be used with offsets located after the first entry
+func (idx *sparseIndex) nearestOffset(off int64) (ordinal int64, entryOff int64) {
+	i := sort.Search(len(idx.offs), func(i int) bool { return idx.offs[i] > off }) - 1
+	return int64(i) * int64(idx.every), idx.offs[i]
+}
+
+// rebuildIndex indexes every entry again, needed after entries are removed
+func (app *Appender) rebuildIndex() error {
+	app.index.reset()
+	app.resetStats()
+
+	if app.keys != nil {
+		app.keys = make(map[string]int64)
+	}
+
+	app.deleted.reset()
+	app.idempotency.reset()
+	app.checkpoint = -1
+
+	if app.contents != nil {
+		app.contents = make(contentSet)
+	}
+
+	if err := app.fold(&indexFoldHandler{app: app}, false); err != nil {
+		return err
+	}
+
+	return app.loadChain()
+}
+
+// track registers an existing entry in the index and keeps sequence numbers increasing
+func (app *Appender) track(e *Entry) error {
+	app.index.add(e.off)
+
+	app.last = e.off
+	app.payloadBytes += int64(e.size)
+	if e.incomplete {
+		app.incomplete = append(app.incomplete, e.off)
+	}
+
+	if !e.incomplete && e.seq >= app.nextSeq {
+		app.nextSeq = e.seq + 1
+	}
+
+	app.trackContent(e)
+
+	if e.checkpoint && !e.incomplete {
+		app.checkpoint = e.off
+	}
+
+	if err := app.trackTombstone(e); err != nil {
+		return err
+	}
+
+	return app.trackKey(e)
+}
+
+const indexExt = ".idx"
+
+var indexMagic = []byte("GIDX")
+
+const indexVersion = 3
+
+// indexFileHeaderLen is the length of magic | version | interval | head | size | nextSeq | count | generation |
+// lastOffset | lastChecksum | payloadBytes | offsets | incomplete, followed by the indexed offsets and the offsets
+// of incomplete entries. lastOffset is the offset of the last entry and lastChecksum the CRC32C of its frame,
+// used to check the data file still holds the indexed entries
+const indexFileHeaderLen = 4 + 1 + 4 + 8 + 8 + 8 + 8 + 8 + 8 + 4 + 8 + 4 + 4
+
+func indexFilename(filename string) string {
+	return filename + indexExt
+}
+
+// writeIndexFile persists the index next to the data file so it can be loaded instead of scanning the file on Open
+func (app *Appender) writeIndexFile() error {
+	idx := app.index
+
+	lastOff := app.last
+	if lastOff < 0 {
+		lastOff = app.size
+	}
+
+	lastChecksum, err := app.frameChecksum(lastOff, app.size)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, indexFileHeaderLen+8*(len(idx.offs)+len(app.incomplete))+crc32.Size)
+
+	copy(b, indexMagic)
+	b[4] = indexVersion
+	byteOrder.PutUint32(b[5:], uint32(idx.every))
+	byteOrder.PutUint64(b[9:], uint64(app.head))
+	byteOrder.PutUint64(b[17:], uint64(app.size))
+	byteOrder.PutUint64(b[25:], app.nextSeq)
+	byteOrder.PutUint64(b[33:], uint64(idx.count))
+	byteOrder.PutUint64(b[41:], app.hdr.generation)
+	byteOrder.PutUint64(b[49:], uint64(lastOff))
+	byteOrder.PutUint32(b[57:], lastChecksum)
+	byteOrder.PutUint64(b[61:], uint64(app.payloadBytes))
+	byteOrder.PutUint32(b[69:], uint32(len(idx.offs)))
+	byteOrder.PutUint32(b[73:], uint32(len(app.incomplete)))
+
+	for i, off := range append(idx.offs[:len(idx.offs):len(idx.offs)], app.incomplete...) {
+		byteOrder.PutUint64(b[indexFileHeaderLen+8*i:], uint64(off))
+	}
+
+	n := len(b) - crc32.Size
+	byteOrder.PutUint32(b[n:], crc32.Checksum(b[:n], crc32cTable))
+
+	filename := indexFilename(app.filename)
+	tmpFilename := filename + compactExt
+
+	if err := os.WriteFile(tmpFilename, b, app.cfg.Perm); err != nil {
+		os.Remove(tmpFilename)
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return ErrUnexpectedWriteErr
+	}
+
+	return nil
+}
+
+// loadIndexFile loads a persisted index, returning false if it is missing or does not match the data file.
+// Entries appended after the index was written, as happens when the appender was not closed, are not indexed
+func (app *Appender) loadIndexFile() bool {
+	if app.keys != nil || app.deleted != nil || app.contents != nil || app.hdr.flags&hCheckpoints != 0 {
+		return false
+	}
+
+	b, err := app.readFile(indexFilename(app.filename))
+	if err != nil || len(b) < indexFileHeaderLen+crc32.Size {
+		return false
+	}
+
+	n := len(b) - crc32.Size
+	if crc32.Checksum(b[:n], crc32cTable) != byteOrder.Uint32(b[n:]) {
+		return false
+	}
+
+	if !bytes.Equal(b[:4], indexMagic) || b[4] != indexVersion {
+		return false
+	}
+
+	every := int(byteOrder.Uint32(b[5:]))
+	head := int64(byteOrder.Uint64(b[9:]))
+	size := int64(byteOrder.Uint64(b[17:]))
+	nextSeq := byteOrder.Uint64(b[25:])
+	count := int64(byteOrder.Uint64(b[33:]))
+	generation := byteOrder.Uint64(b[41:])
+	lastOff := int64(byteOrder.Uint64(b[49:]))
+	lastChecksum := byteOrder.Uint32(b[57:])
+	payloadBytes := int64(byteOrder.Uint64(b[61:]))
+	offsLen := int(byteOrder.Uint32(b[69:]))
+	incompleteLen := int(byteOrder.Uint32(b[73:]))
+
+	if every != app.index.every || head != app.head || generation != app.hdr.generation || n != indexFileHeaderLen+8*(offsLen+incompleteLen) {
+		return false
+	}
+
+	if lastOff < head || lastOff > size {
+		return false
+	}
+
+	fi, err := app.f.Stat()
+	if err != nil || fi.Size()-app.dataOffset < size {
+		return false
+	}
+
+	if checksum, err := app.frameChecksum(lastOff, size); err != nil || checksum != lastChecksum {
+		return false
+	}
+
+	offs := make([]int64, offsLen+incompleteLen)
+	for i := range offs {
+		offs[i] = int64(byteOrder.Uint64(b[indexFileHeaderLen+8*i:]))
+	}
+
+	app.index.count = count
+	app.index.offs = offs[:offsLen:offsLen]
+	if count > 0 {
+		app.last = lastOff
+	}
+	app.payloadBytes = payloadBytes
+	if incompleteLen > 0 {
+		app.incomplete = offs[offsLen:]
+	}
+	app.size = size
+	app.nextSeq = nextSeq
+
+	return true
+}
+
+// frameChecksum returns the CRC32C of the data stored between offsets start and end
+func (app *Appender) frameChecksum(start int64, end int64) (uint32, error) {
+	b := make([]byte, end-start)
+	if _, err := app.f.ReadAt(b, app.dataOffset+start); err != nil {
+		return 0, ErrUnexpectedReadError
+	}
+	return crc32.Checksum(b, crc32cTable), nil
+}
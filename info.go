@@ -0,0 +1,79 @@
+package aof
+
+// Info describes the file of an appender
+type Info struct {
+	// Version is the file format version
+	Version uint8
+	// Head is the offset of the first entry not removed with TruncateHead
+	Head int64
+	// Size is the offset right after the last entry
+	Size int64
+	// Generation changes whenever existing offsets are invalidated by Truncate or Compact
+	Generation uint64
+	// Checkpoint is the offset of the latest checkpoint, -1 if there is none
+	Checkpoint int64
+}
+
+// Info returns the current state of the file
+func (app *Appender) Info() Info {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	return Info{
+		Version:    app.hdr.version,
+		Head:       app.head,
+		Size:       app.size,
+		Generation: app.hdr.generation,
+		Checkpoint: app.checkpoint,
+	}
+}
+
+// Config returns the configuration of the appender, with the format settings recorded in the file header
+func (app *Appender) Config() Config {
+	return *app.cfg
+}
+
+// Count returns the number of entries located after the head, including incomplete ones. It is maintained
+// while appending so no scan is needed
+func (app *Appender) Count() int64 {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	return app.index.count
+}
+
+// Size returns the offset right after the last entry, where the next entry will be appended
+func (app *Appender) Size() int64 {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	return app.size
+}
+
+// FirstOffset returns the offset of the first entry not removed with TruncateHead, -1 when there are no entries
+func (app *Appender) FirstOffset() int64 {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.index.count == 0 {
+		return -1
+	}
+	return app.head
+}
+
+// LastOffset returns the offset of the last entry, -1 when there are no entries
+func (app *Appender) LastOffset() int64 {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	return app.last
+}
+
+// LastEntry reads the last entry. ErrNoEntries is returned when there are no entries
+func (app *Appender) LastEntry() (*Entry, error) {
+	off := app.LastOffset()
+	if off < 0 {
+		return nil, ErrNoEntries
+	}
+	return app.Read(off)
+}
@@ -0,0 +1,378 @@
+package aof
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+)
+
+var ErrIteratorClosed = errors.New("aof: Iterator closed")
+
+// Iterator reads entries one at a time. The appender is only locked while an entry is being read.
+// Once entries are removed by Truncate, TruncateHead or Compact, Next returns ErrStaleCursor
+type Iterator struct {
+	app    *Appender
+	off    int64
+	err    error
+	closed bool
+
+	// seq and generation identify the position of the iterator, see Cursor
+	seq        uint64
+	generation uint64
+
+	// follow makes Next wait for new entries until it is done, nil for iterators that stop at the last entry
+	follow context.Context
+
+	// end bounds the entries returned to those located before it, -1 means no bound
+	end int64
+
+	// reverse iterators read the entries of an index block at a time, pending holds the offsets left in the current one
+	reverse bool
+	block   int
+	pending []int64
+}
+
+// Iterator returns an iterator positioned at the entry located at offset startOff
+func (app *Appender) Iterator(startOff int64) (*Iterator, error) {
+	return app.IteratorRange(startOff, -1)
+}
+
+// IteratorRange returns an iterator over the entries located from offset fromOff and before offset toOff.
+// A negative toOff means no upper bound
+func (app *Appender) IteratorRange(fromOff int64, toOff int64) (*Iterator, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if fromOff < 0 || fromOff > app.size || (toOff >= 0 && toOff < fromOff) {
+		return nil, ErrInvalidArguments
+	}
+
+	if fromOff < app.head {
+		return nil, ErrOffsetPurged
+	}
+
+	boundary, err := app.isEntryBoundary(fromOff)
+	if err != nil {
+		return nil, err
+	}
+
+	if !boundary {
+		return nil, ErrNotEntryBoundary
+	}
+
+	return &Iterator{app: app, off: fromOff, end: toOff, generation: app.hdr.generation}, nil
+}
+
+// headIterator returns an iterator positioned at the first entry
+func (app *Appender) headIterator() (*Iterator, error) {
+	app.mux.Lock()
+	head := app.head
+	app.mux.Unlock()
+
+	return app.Iterator(head)
+}
+
+// Follow returns an iterator over every entry which, like tail -f, waits for new entries once the last one was read.
+// Next returns the context error once ctx is done
+func (app *Appender) Follow(ctx context.Context) (*Iterator, error) {
+	it, err := app.headIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	it.follow = ctx
+
+	return it, nil
+}
+
+// FollowFrom is like Follow but starts at the entry located at offset startOff
+func (app *Appender) FollowFrom(ctx context.Context, startOff int64) (*Iterator, error) {
+	it, err := app.Iterator(startOff)
+	if err != nil {
+		return nil, err
+	}
+
+	it.follow = ctx
+
+	return it, nil
+}
+
+// IteratorReverse returns an iterator reading entries from the last one back to the head.
+// Entries appended after the iterator is created are not returned
+func (app *Appender) IteratorReverse() (*Iterator, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	return &Iterator{app: app, reverse: true, end: app.size, block: len(app.index.offs) - 1, generation: app.hdr.generation}, nil
+}
+
+// ForEachReverse runs f over every entry starting from the last one
+func (app *Appender) ForEachReverse(f ForEachFn) error {
+	it, err := app.IteratorReverse()
+	if err != nil {
+		return err
+	}
+	return it.forEach(f)
+}
+
+// ReadLast reads the last entry, skipping entries hidden by SkipExpired or SkipDeleted.
+// ErrNoEntries is returned when there are no entries
+func (app *Appender) ReadLast() (*Entry, error) {
+	es, err := app.ReadLastN(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(es) == 0 {
+		return nil, ErrNoEntries
+	}
+
+	return es[0], nil
+}
+
+// ReadLastN reads up to n entries from the tail, returned in the order they were appended.
+// Only the index blocks holding them are scanned
+func (app *Appender) ReadLastN(n int) ([]*Entry, error) {
+	if n < 1 {
+		return nil, ErrInvalidArguments
+	}
+
+	it, err := app.IteratorReverse()
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var es []*Entry
+
+	for len(es) < n {
+		e, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+
+	slices.Reverse(es)
+
+	return es, nil
+}
+
+// ForEachRange runs f over the entries located from offset fromOff and before offset toOff
+func (app *Appender) ForEachRange(fromOff int64, toOff int64, f ForEachFn) error {
+	it, err := app.IteratorRange(fromOff, toOff)
+	if err != nil {
+		return err
+	}
+	return it.forEach(f)
+}
+
+// Stream reads every entry in a background goroutine and sends them through the returned channel, which is
+// closed once every entry was sent, an error occurs or ctx is done. At most one error is sent through the error channel
+func (app *Appender) Stream(ctx context.Context) (<-chan *Entry, <-chan error) {
+	entries := make(chan *Entry)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(entries)
+		defer close(errs)
+
+		it, err := app.headIterator()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer it.Close()
+
+		for {
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+
+			e, err := it.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case entries <- e:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return entries, errs
+}
+
+// forEach runs f over every entry returned by the iterator and closes it
+func (it *Iterator) forEach(f ForEachFn) error {
+	defer it.Close()
+
+	for {
+		e, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cutoff, err := f(e)
+		if cutoff || err != nil {
+			return err
+		}
+	}
+}
+
+// Next returns the next entry, io.EOF is returned once every entry was read.
+// Entries appended while iterating are also returned
+func (it *Iterator) Next() (*Entry, error) {
+	for {
+		e, appended, err := it.next()
+		if err == nil {
+			if it.app.hidden(e, time.Now()) {
+				continue
+			}
+			if err := it.app.readHooks(e); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+		if err != io.EOF || it.follow == nil {
+			return e, err
+		}
+
+		select {
+		case <-appended:
+		case <-it.follow.Done():
+			return nil, it.follow.Err()
+		}
+	}
+}
+
+// next returns the next entry or io.EOF along with a channel closed once more entries are appended
+func (it *Iterator) next() (*Entry, <-chan struct{}, error) {
+	if it.closed {
+		return nil, nil, ErrIteratorClosed
+	}
+
+	if it.err != nil {
+		return nil, nil, it.err
+	}
+
+	app := it.app
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, nil, ErrAppenderClosed
+	}
+
+	// The offset of the iterator may no longer be an entry boundary once entries were removed. Files without
+	// generation are only known to be truncated when the offset is past their end
+	if it.generation != app.hdr.generation {
+		it.err = ErrStaleCursor
+		return nil, nil, it.err
+	}
+
+	if it.reverse {
+		e, err := it.prev()
+		return e, nil, err
+	}
+
+	if it.off < app.head || it.off > app.size {
+		it.err = ErrStaleCursor
+		return nil, nil, it.err
+	}
+
+	if it.off == app.size || (it.end >= 0 && it.off >= it.end) {
+		return nil, app.appended, io.EOF
+	}
+
+	e, err := app.readEntry(it.off)
+	if err != nil {
+		it.err = err
+		return nil, nil, err
+	}
+
+	it.off += app.entryFrameLen(e)
+	it.seq = e.seq
+
+	return e, nil, nil
+}
+
+// wakeFollowers wakes the iterators waiting for new entries once entries were removed, so they stop with
+// ErrStaleCursor instead of waiting at an offset which no longer exists. It must be called with mux held
+func (app *Appender) wakeFollowers() {
+	close(app.appended)
+	app.appended = make(chan struct{})
+}
+
+// prev returns the entry preceding the last one returned by a reverse iterator
+func (it *Iterator) prev() (*Entry, error) {
+	app := it.app
+
+	if len(it.pending) == 0 {
+		if it.block < 0 {
+			return nil, io.EOF
+		}
+
+		if it.block >= len(app.index.offs) || app.index.offs[it.block] < app.head {
+			it.err = ErrOffsetPurged
+			return nil, it.err
+		}
+
+		handler := &blockHandler{end: it.end, max: app.index.every, offs: it.pending}
+
+		if err := app.foldFrom(app.index.offs[it.block], handler, false); err != nil {
+			it.err = err
+			return nil, err
+		}
+
+		it.pending = handler.offs
+		it.block--
+
+		if len(it.pending) == 0 {
+			return nil, io.EOF
+		}
+	}
+
+	off := it.pending[len(it.pending)-1]
+	it.pending = it.pending[:len(it.pending)-1]
+
+	e, err := app.readEntry(off)
+	if err != nil {
+		it.err = err
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Close releases the iterator, Next must not be called afterwards
+func (it *Iterator) Close() error {
+	it.closed = true
+	it.app = nil
+	return nil
+}
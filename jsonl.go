@@ -0,0 +1,94 @@
+package aof
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonlEntry is the JSON representation of an entry used by ExportJSONL and ImportJSONL.
+// Binary fields are base64 encoded and metadata not enabled in the file format is omitted
+type jsonlEntry struct {
+	Offset     int64  `json:"offset"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	Type       uint8  `json:"type,omitempty"`
+	Seq        uint64 `json:"seq,omitempty"`
+	Version    uint16 `json:"version,omitempty"`
+	Key        []byte `json:"key,omitempty"`
+	Payload    []byte `json:"payload"`
+	Incomplete bool   `json:"incomplete,omitempty"`
+}
+
+// ExportJSONL writes every entry to w as newline delimited JSON objects holding its offset, metadata and
+// base64 encoded payload. Timestamps are formatted as RFC 3339
+func (app *Appender) ExportJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	err := app.ForEach(func(e *Entry) (bool, error) {
+		je := jsonlEntry{
+			Offset:     e.Offset(),
+			Type:       e.Type(),
+			Seq:        e.Seq(),
+			Version:    e.Version(),
+			Key:        e.Key(),
+			Payload:    e.Bytes(),
+			Incomplete: e.Incomplete(),
+		}
+
+		if ts := e.Timestamp(); !ts.IsZero() {
+			je.Timestamp = ts.Format(time.RFC3339Nano)
+		}
+
+		return false, enc.Encode(je)
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ImportJSONL appends the entries read from r in the format written by ExportJSONL. Offsets and sequence numbers
+// are assigned again while timestamps, types, versions and keys are kept. Incomplete entries are skipped.
+// The number of imported entries is returned
+func (app *Appender) ImportJSONL(r io.Reader) (n int, err error) {
+	dec := json.NewDecoder(r)
+
+	for {
+		var je jsonlEntry
+
+		err := dec.Decode(&je)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if je.Incomplete {
+			continue
+		}
+
+		m := &entryMeta{tag: je.Type, version: je.Version, key: je.Key}
+
+		if je.Timestamp != "" {
+			ts, err := time.Parse(time.RFC3339Nano, je.Timestamp)
+			if err != nil {
+				return n, err
+			}
+			m.timestamp = ts.UnixNano()
+		}
+
+		app.mux.Lock()
+		_, err = app.appendBulk([][]byte{je.Payload}, m)
+		app.mux.Unlock()
+
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+}
@@ -0,0 +1,125 @@
+package aof
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrKeyNotFound = errors.New("aof: Key not found")
+
+// Key returns the key of an entry appended with AppendKeyed. Nil is returned if keys are not enabled
+func (e *Entry) Key() []byte {
+	return e.key
+}
+
+// AppendKeyed appends value under key. Reading key with Get returns the latest value appended for it.
+// Keys must be enabled in the file format
+func (app *Appender) AppendKeyed(key []byte, value []byte) (off int64, err error) {
+	if err := app.throttle(context.Background(), [][]byte{value}); err != nil {
+		return 0, err
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if !app.closed && app.keys == nil {
+		return 0, ErrInvalidArguments
+	}
+
+	offs, err := app.appendBulk([][]byte{value}, &entryMeta{key: key})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// Get returns the latest value appended under key
+func (app *Appender) Get(key []byte) ([]byte, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if app.keys == nil {
+		return nil, ErrInvalidArguments
+	}
+
+	off, ok := app.keys[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	e, err := app.readEntry(off)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// Keys returns the number of distinct keys
+func (app *Appender) Keys() int {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	return len(app.keys)
+}
+
+// CompactKeys compacts the file dropping every entry superseded by a later entry with the same key
+func (app *Appender) CompactKeys() (offsets map[int64]int64, err error) {
+	if app.keys == nil {
+		return nil, ErrInvalidArguments
+	}
+
+	return app.Compact(func(e *Entry) (bool, []byte, error) {
+		return app.keys[string(e.key)] == e.off, nil, nil
+	})
+}
+
+// encodeKeyed prepends the uvarint encoded length of key and key itself to value
+func encodeKeyed(key []byte, value []byte) []byte {
+	bs := make([]byte, binary.MaxVarintLen64+len(key)+len(value))
+	n := binary.PutUvarint(bs, uint64(len(key)))
+	n += copy(bs[n:], key)
+	n += copy(bs[n:], value)
+	return bs[:n]
+}
+
+// splitKey separates the key from the payload of a complete entry
+func (e *Entry) splitKey(app *Appender) error {
+	if !app.cfg.Keyed || e.incomplete {
+		return nil
+	}
+
+	l, n := binary.Uvarint(e.payload)
+	if n <= 0 || l > uint64(len(e.payload)-n) {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	e.key = e.payload[n : n+int(l)]
+	e.payload = e.payload[n+int(l):]
+
+	return nil
+}
+
+// trackKey points the key of an existing entry to it
+func (app *Appender) trackKey(e *Entry) error {
+	if app.keys == nil || e.incomplete {
+		return nil
+	}
+
+	if err := e.decrypt(app); err != nil {
+		return err
+	}
+
+	if err := e.splitKey(app); err != nil {
+		return err
+	}
+
+	app.keys[string(e.key)] = e.off
+
+	return nil
+}
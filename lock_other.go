@@ -0,0 +1,10 @@
+//go:build (!unix || solaris || illumos || aix) && !windows
+
+package aof
+
+import "os"
+
+// lockFile is a no-op on platforms without file locking support
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build unix && !solaris && !illumos && !aix
+
+package aof
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an advisory lock on f without blocking, exclusive or shared.
+// The lock is released when f is closed
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrFileLocked
+	}
+
+	return err
+}
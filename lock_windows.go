@@ -0,0 +1,38 @@
+package aof
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x01
+	lockfileExclusiveLock   = 0x02
+
+	errLockViolation syscall.Errno = 33
+)
+
+// lockFile acquires a lock on f without blocking, exclusive or shared. The locked byte lies far beyond
+// the end of the file so reads through other handles are not affected. The lock is released when f is closed
+func lockFile(f *os.File, exclusive bool) error {
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+
+	ol := &syscall.Overlapped{Offset: ^uint32(0), OffsetHigh: ^uint32(0) >> 1}
+
+	r, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r != 0 {
+		return nil
+	}
+
+	if err == errLockViolation {
+		return ErrFileLocked
+	}
+
+	return err
+}
@@ -0,0 +1,742 @@
+package aof
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log is an append-only log stored as an ordered set of segment files within a directory.
+// Entry offsets are logical and continuous across segments: the first entry of a segment is
+// located right after the last entry of the previous one
+type Log struct {
+	dir            string
+	segCfg         *Config
+	maxSegmentSize int64
+	rotationPeriod time.Duration
+	rotationTimer  *time.Timer
+	nameTemplate   string
+	namePattern    *regexp.Regexp
+	timeLayout     string
+	retention      retention
+	maxLogSize     int64
+	quotaPolicy    QuotaPolicy
+	archiveDir     string
+	compressor     Compressor
+	purgeDone      chan struct{}
+	mux            sync.Mutex
+	segments       []*segment
+	closed         bool
+}
+
+type LogConfig struct {
+	// Segment is the configuration used to open every segment file
+	Segment *Config
+	// MaxSegmentSize is the size in bytes after which a new segment is started. Zero disables size-based rotation
+	MaxSegmentSize int64
+	// RotationPeriod starts a new segment every period, aligned to UTC wall-clock boundaries (e.g. time.Hour).
+	// Zero disables time-based rotation
+	RotationPeriod time.Duration
+	// NameTemplate is used to name segment files. "{offset}" is replaced with the zero-padded logical offset
+	// of the first entry in the segment and must be present, "{time}" with the UTC creation time formatted using TimeLayout
+	NameTemplate string
+	// TimeLayout is the layout used to format "{time}" in NameTemplate
+	TimeLayout string
+	// RetentionBytes is the maximum size in bytes of all segments. Zero means no limit
+	RetentionBytes int64
+	// RetentionAge is the maximum time since a segment was last written. Zero means no limit
+	RetentionAge time.Duration
+	// RetentionSegments is the maximum number of segments. Zero means no limit
+	RetentionSegments int
+	// PurgeInterval is the time between background retention checks when any retention limit is set
+	PurgeInterval time.Duration
+	// ArchiveDir is the directory where segments are moved to once a new segment is started.
+	// Archived segments remain readable. Empty disables archival
+	ArchiveDir string
+	// ArchiveCompressor compresses archived segments. Nil archives segments uncompressed
+	ArchiveCompressor Compressor
+	// MaxLogSize is the maximum size in bytes of all segments, enforced on every append. Zero means no limit
+	MaxLogSize int64
+	// QuotaPolicy determines what happens when appending would exceed MaxLogSize
+	QuotaPolicy QuotaPolicy
+}
+
+const DefaultMaxSegmentSize = 64 << 20
+const DefaultRotationPeriod = 0
+const DefaultNameTemplate = "{offset}.aof"
+const DefaultTimeLayout = "20060102T150405Z"
+const DefaultPurgeInterval = time.Minute
+
+type segment struct {
+	// app is nil for archived segments until they are read
+	app      *Appender
+	start    int64
+	size     int64
+	created  time.Time
+	path     string
+	archived bool
+	tmpPath  string
+}
+
+const (
+	offsetPlaceholder = "{offset}"
+	timePlaceholder   = "{time}"
+)
+
+func (log *Log) segmentName(start int64, created time.Time) string {
+	r := strings.NewReplacer(
+		offsetPlaceholder, fmt.Sprintf("%020d", start),
+		timePlaceholder, created.UTC().Format(log.timeLayout),
+	)
+	return r.Replace(log.nameTemplate)
+}
+
+func (log *Log) parseSegmentName(name string) (start int64, created time.Time, ok bool) {
+	m := log.namePattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, created, false
+	}
+
+	start, err := strconv.ParseInt(m[log.namePattern.SubexpIndex("offset")], 10, 64)
+	if err != nil || start < 0 {
+		return 0, created, false
+	}
+
+	if i := log.namePattern.SubexpIndex("time"); i >= 0 {
+		created, err = time.Parse(log.timeLayout, m[i])
+		if err != nil {
+			return 0, created, false
+		}
+	}
+
+	return start, created, true
+}
+
+// namePattern builds a regular expression matching the segment names produced by template
+func namePattern(template string) (*regexp.Regexp, error) {
+	if strings.Count(template, offsetPlaceholder) != 1 || strings.Count(template, timePlaceholder) > 1 ||
+		strings.ContainsRune(template, filepath.Separator) {
+		return nil, ErrInvalidArguments
+	}
+
+	expr := regexp.QuoteMeta(template)
+	expr = strings.Replace(expr, regexp.QuoteMeta(offsetPlaceholder), `(?P<offset>\d{20})`, 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta(timePlaceholder), `(?P<time>.+?)`, 1)
+
+	return regexp.Compile("^" + expr + "$")
+}
+
+func OpenLog(dir string) (*Log, error) {
+	defaultCfg := &LogConfig{
+		Segment:        defaultConfig(),
+		MaxSegmentSize: DefaultMaxSegmentSize,
+		RotationPeriod: DefaultRotationPeriod,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+		PurgeInterval:  DefaultPurgeInterval,
+		QuotaPolicy:    DefaultQuotaPolicy,
+	}
+	return OpenLogWithConfig(dir, defaultCfg)
+}
+
+func OpenLogWithConfig(dir string, cfg *LogConfig) (*Log, error) {
+	if cfg.Segment == nil || cfg.MaxSegmentSize < 0 || cfg.RotationPeriod < 0 || cfg.TimeLayout == "" {
+		return nil, ErrInvalidArguments
+	}
+
+	ret := retention{
+		bytes:    cfg.RetentionBytes,
+		age:      cfg.RetentionAge,
+		segments: cfg.RetentionSegments,
+	}
+
+	if ret.bytes < 0 || ret.age < 0 || ret.segments < 0 || (ret.enabled() && cfg.PurgeInterval <= 0) {
+		return nil, ErrInvalidArguments
+	}
+
+	if cfg.MaxLogSize < 0 || cfg.QuotaPolicy < QuotaFail || cfg.QuotaPolicy > QuotaPurge {
+		return nil, ErrInvalidArguments
+	}
+
+	pattern, err := namePattern(cfg.NameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.Segment.ReadOnly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	log := &Log{
+		dir:            dir,
+		segCfg:         cfg.Segment,
+		maxSegmentSize: cfg.MaxSegmentSize,
+		rotationPeriod: cfg.RotationPeriod,
+		nameTemplate:   cfg.NameTemplate,
+		namePattern:    pattern,
+		timeLayout:     cfg.TimeLayout,
+		retention:      ret,
+		maxLogSize:     cfg.MaxLogSize,
+		quotaPolicy:    cfg.QuotaPolicy,
+		archiveDir:     cfg.ArchiveDir,
+		compressor:     cfg.ArchiveCompressor,
+	}
+
+	segs, err := log.listSegments(dir, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if log.archiveDir != "" {
+		if !cfg.Segment.ReadOnly {
+			if err := os.MkdirAll(log.archiveDir, 0755); err != nil {
+				return nil, err
+			}
+		}
+
+		archived, err := log.listSegments(log.archiveDir, log.archiveExt(), true)
+		if err != nil {
+			return nil, err
+		}
+
+		segs = mergeSegments(segs, archived)
+	}
+
+	for i, seg := range segs {
+		if seg.archived {
+			if i+1 < len(segs) {
+				seg.size = segs[i+1].start - seg.start
+			}
+			log.segments = append(log.segments, seg)
+			continue
+		}
+
+		if err := log.openSegment(seg); err != nil {
+			log.close()
+			return nil, err
+		}
+	}
+
+	// The size of the last segment is needed to continue appending
+	if n := len(log.segments); n > 0 && log.segments[n-1].archived {
+		if _, err := log.appenderOf(log.segments[n-1]); err != nil {
+			log.close()
+			return nil, err
+		}
+	}
+
+	if len(log.segments) == 0 && !cfg.Segment.ReadOnly {
+		if _, err := log.newSegment(0); err != nil {
+			return nil, err
+		}
+	}
+
+	if log.rotationPeriod > 0 && !cfg.Segment.ReadOnly {
+		log.rotationTimer = time.AfterFunc(log.untilNextRotation(), log.rotateOnSchedule)
+	}
+
+	if ret.enabled() && !cfg.Segment.ReadOnly {
+		log.purgeDone = make(chan struct{})
+		go log.purgeLoop(cfg.PurgeInterval, log.purgeDone)
+	}
+
+	return log, nil
+}
+
+// listSegments returns the segments found in dir sorted by offset. ext is the suffix following segment names
+func (log *Log) listSegments(dir string, ext string, archived bool) ([]*segment, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) && archived {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var segs []*segment
+	for _, de := range des {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ext) {
+			continue
+		}
+
+		start, created, ok := log.parseSegmentName(strings.TrimSuffix(de.Name(), ext))
+		if !ok {
+			continue
+		}
+
+		if created.IsZero() {
+			fi, err := de.Info()
+			if err != nil {
+				return nil, err
+			}
+			created = fi.ModTime()
+		}
+
+		segs = append(segs, &segment{
+			start:    start,
+			created:  created,
+			path:     filepath.Join(dir, de.Name()),
+			archived: archived,
+		})
+	}
+
+	sort.Slice(segs, func(i, j int) bool { return segs[i].start < segs[j].start })
+
+	return segs, nil
+}
+
+// mergeSegments merges two sorted lists of segments, preferring hot segments when archival was interrupted
+func mergeSegments(hot []*segment, archived []*segment) []*segment {
+	starts := make(map[int64]bool, len(hot))
+	for _, seg := range hot {
+		starts[seg.start] = true
+	}
+
+	segs := hot
+	for _, seg := range archived {
+		if !starts[seg.start] {
+			segs = append(segs, seg)
+		}
+	}
+
+	sort.Slice(segs, func(i, j int) bool { return segs[i].start < segs[j].start })
+
+	return segs
+}
+
+func (log *Log) newSegment(start int64) (*segment, error) {
+	created := time.Now()
+	seg := &segment{
+		start:   start,
+		created: created,
+		path:    filepath.Join(log.dir, log.segmentName(start, created)),
+	}
+
+	if err := log.openSegment(seg); err != nil {
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+func (log *Log) openSegment(seg *segment) error {
+	app, err := OpenWithConfig(seg.path, log.segCfg)
+	if err != nil && app == nil {
+		return err
+	}
+
+	// Sequence numbers of an empty segment continue from the previous one
+	if n := len(log.segments); n > 0 && app.size == 0 {
+		prev, err := log.appenderOf(log.segments[n-1])
+		if err != nil {
+			app.Close()
+			return err
+		}
+		app.nextSeq = prev.nextSeq
+	}
+
+	seg.app = app
+	log.segments = append(log.segments, seg)
+
+	return nil
+}
+
+func (seg *segment) end() int64 {
+	if seg.app == nil {
+		return seg.start + seg.size
+	}
+	return seg.start + seg.app.size
+}
+
+func (log *Log) Close() error {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	return log.close()
+}
+
+func (log *Log) close() error {
+	log.closed = true
+
+	if log.rotationTimer != nil {
+		log.rotationTimer.Stop()
+	}
+
+	if log.purgeDone != nil {
+		close(log.purgeDone)
+		log.purgeDone = nil
+	}
+
+	var err error
+	for _, seg := range log.segments {
+		if cerr := seg.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// activeSegment returns the segment new entries are appended to, rolling to a new one when needed
+func (log *Log) activeSegment() (*segment, error) {
+	if len(log.segments) == 0 {
+		return log.newSegment(0)
+	}
+
+	active := log.segments[len(log.segments)-1]
+
+	if !active.archived && !log.mustRotate(active, time.Now()) {
+		return active, nil
+	}
+
+	return log.rotate()
+}
+
+// rotate starts a new segment after the active one, which is archived when configured
+func (log *Log) rotate() (*segment, error) {
+	active := log.segments[len(log.segments)-1]
+
+	seg, err := log.newSegment(active.end())
+	if err != nil {
+		return nil, err
+	}
+
+	if log.archiveDir != "" && !active.archived {
+		if err := log.archive(active); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := log.purgeExpired(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+// mustRotate returns true if a non-empty segment exceeded its size or was created in a previous rotation period
+func (log *Log) mustRotate(seg *segment, now time.Time) bool {
+	if seg.app.size == 0 {
+		return false
+	}
+
+	if log.maxSegmentSize > 0 && seg.app.size >= log.maxSegmentSize {
+		return true
+	}
+
+	return log.rotationPeriod > 0 && seg.created.Truncate(log.rotationPeriod).Before(now.Truncate(log.rotationPeriod))
+}
+
+func (log *Log) untilNextRotation() time.Duration {
+	now := time.Now()
+	return now.Truncate(log.rotationPeriod).Add(log.rotationPeriod).Sub(now)
+}
+
+// rotateOnSchedule closes the active segment at the end of every rotation period, so closed
+// segments can be picked up even if no further entries are appended
+func (log *Log) rotateOnSchedule() {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return
+	}
+
+	if _, err := log.activeSegment(); err == nil {
+		log.rotationTimer.Reset(log.untilNextRotation())
+	}
+}
+
+// segmentAt returns the segment holding logical offset off
+func (log *Log) segmentAt(off int64) *segment {
+	i := sort.Search(len(log.segments), func(i int) bool { return log.segments[i].start > off })
+	if i == 0 {
+		return nil
+	}
+	return log.segments[i-1]
+}
+
+func (log *Log) Append(bs []byte) (off int64, err error) {
+	offs, err := log.AppendBulk([][]byte{bs})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// AppendBulk appends every entry in bss to the same segment
+func (log *Log) AppendBulk(bss [][]byte) (offs []int64, err error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	seg, err := log.segmentFor(bss)
+	if err != nil {
+		return nil, err
+	}
+
+	offs, err = seg.app.AppendBulk(bss)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range offs {
+		offs[i] += seg.start
+	}
+
+	return offs, nil
+}
+
+func (log *Log) Read(off int64) (e *Entry, err error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if off < log.head() {
+		return nil, ErrOffsetPurged
+	}
+
+	seg := log.segmentAt(off)
+	if seg == nil {
+		return nil, ErrInvalidArguments
+	}
+
+	app, err := log.appenderOf(seg)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err = app.Read(off - seg.start)
+	if e != nil {
+		e.off += seg.start
+	}
+
+	return e, err
+}
+
+// Size returns the logical offset at which the next entry will be appended
+func (log *Log) Size() int64 {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if len(log.segments) == 0 {
+		return 0
+	}
+
+	return log.segments[len(log.segments)-1].end()
+}
+
+// AppendSeq appends an entry returning its sequence number along with its offset, see Appender.AppendSeq
+func (log *Log) AppendSeq(bs []byte) (off int64, seq uint64, err error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return 0, 0, ErrAppenderClosed
+	}
+
+	seg, err := log.segmentFor([][]byte{bs})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	off, seq, err = seg.app.AppendSeq(bs)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return seg.start + off, seq, nil
+}
+
+// AppendTyped appends an entry tagged with the given type, see Appender.AppendTyped
+func (log *Log) AppendTyped(tag uint8, bs []byte) (off int64, err error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return 0, ErrAppenderClosed
+	}
+
+	seg, err := log.segmentFor([][]byte{bs})
+	if err != nil {
+		return 0, err
+	}
+
+	off, err = seg.app.AppendTyped(tag, bs)
+	if err != nil {
+		return 0, err
+	}
+
+	return seg.start + off, nil
+}
+
+// Sync commits the content of the active segment to stable storage. Previous segments are synced when they are closed
+func (log *Log) Sync() error {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return ErrAppenderClosed
+	}
+
+	if len(log.segments) == 0 {
+		return nil
+	}
+
+	return log.segments[len(log.segments)-1].app.Sync()
+}
+
+// SegmentInfo describes a segment of a Log
+type SegmentInfo struct {
+	// Path is the location of the segment file, within the archive directory for archived segments
+	Path string
+	// Start is the logical offset of the first entry in the segment
+	Start int64
+	// Size is the number of bytes of entries in the segment
+	Size     int64
+	Archived bool
+}
+
+func (seg *segment) info() SegmentInfo {
+	return SegmentInfo{
+		Path:     seg.path,
+		Start:    seg.start,
+		Size:     seg.end() - seg.start,
+		Archived: seg.archived,
+	}
+}
+
+// Segments returns the current segments ordered by offset
+func (log *Log) Segments() []SegmentInfo {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	infos := make([]SegmentInfo, len(log.segments))
+	for i, seg := range log.segments {
+		infos[i] = seg.info()
+	}
+
+	return infos
+}
+
+// Locate translates logical offset off into the segment holding it and the offset within that segment
+func (log *Log) Locate(off int64) (seg SegmentInfo, segOff int64, err error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return seg, 0, ErrAppenderClosed
+	}
+
+	if off < log.head() {
+		return seg, 0, ErrOffsetPurged
+	}
+
+	s := log.segmentAt(off)
+	if s == nil || off > s.end() {
+		return seg, 0, ErrInvalidArguments
+	}
+
+	return s.info(), off - s.start, nil
+}
+
+func (log *Log) ForEach(f ForEachFn) error {
+	return log.FoldWithHandler(&forEachHandler{f: f})
+}
+
+func (log *Log) Map(f MapFn) (ls []interface{}, err error) {
+	handler := &mapHandler{f: f, ls: nil}
+	err = log.FoldWithHandler(handler)
+	return handler.Values(), err
+}
+
+func (log *Log) FilteredMap(f FilterFn, m MapFn) (ls []interface{}, err error) {
+	handler := &filteredMapHandler{f: f, m: m, ls: nil}
+	err = log.FoldWithHandler(handler)
+	return handler.Values(), err
+}
+
+func (log *Log) Fold(f FoldFn, v interface{}) (ret interface{}, err error) {
+	handler := &gFoldHandler{f: f, v: v}
+	err = log.FoldWithHandler(handler)
+	return handler.Value(), err
+}
+
+// FoldWithHandler runs handler over the entries of every segment in order. The log isn't locked while segments are
+// folded, so appends continue meanwhile. Segments removed by retention before being reached are skipped
+func (log *Log) FoldWithHandler(handler FoldHandler) error {
+	log.mux.Lock()
+
+	if log.closed {
+		log.mux.Unlock()
+		return ErrAppenderClosed
+	}
+
+	segments := slices.Clone(log.segments)
+	log.mux.Unlock()
+
+	for _, seg := range segments {
+		h := &segmentFoldHandler{handler: handler, start: seg.start}
+
+		app, err := log.foldedAppenderOf(seg)
+		if err != nil {
+			return err
+		}
+		if app == nil {
+			continue
+		}
+
+		err = app.FoldWithHandler(h)
+		if err == ErrAppenderClosed && log.removed(seg) {
+			continue
+		}
+		if err != nil || h.cutoff {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// foldedAppenderOf returns the appender of seg, nil if seg was removed
+func (log *Log) foldedAppenderOf(seg *segment) (*Appender, error) {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if log.removedLocked(seg) {
+		return nil, nil
+	}
+
+	return log.appenderOf(seg)
+}
+
+// removed reports whether seg was removed from the log while it was open
+func (log *Log) removed(seg *segment) bool {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	return !log.closed && log.removedLocked(seg)
+}
+
+func (log *Log) removedLocked(seg *segment) bool {
+	return len(log.segments) == 0 || seg.start < log.segments[0].start
+}
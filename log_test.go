@@ -0,0 +1,520 @@
+package aof
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLogRotation(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+
+	var offs []int64
+	var bss [][]byte
+
+	for i := 0; i < 20; i++ {
+		b := randomBytes(20)
+		off, err := log.Append(b)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+		bss = append(bss, b)
+	}
+
+	if len(log.segments) != 4 {
+		t.Errorf("Expected 4 segments but %d were created", len(log.segments))
+	}
+
+	log.Close()
+
+	log, err = OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer log.Close()
+
+	for i, off := range offs {
+		if i > 0 && off != offs[i-1]+23 {
+			t.Errorf("Expected continuous offsets but %d follows %d", off, offs[i-1])
+		}
+
+		e, err := log.Read(off)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !bytes.Equal(e.Bytes(), bss[i]) || e.Offset() != off {
+			t.Errorf("Unexpected entry read at offset %d", off)
+		}
+	}
+
+	i := 0
+	err = log.ForEach(func(e *Entry) (bool, error) {
+		if e.Offset() != offs[i] {
+			t.Errorf("Expected offset %d but %d was found", offs[i], e.Offset())
+		}
+		i++
+		return false, nil
+	})
+	if err != nil || i != len(offs) {
+		t.Errorf("Unexpected error %v after %d entries", err, i)
+	}
+}
+
+func TestLogTimeRotation(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		RotationPeriod: 100 * time.Millisecond,
+		NameTemplate:   "segment-{time}-{offset}.log",
+		TimeLayout:     "150405.000",
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+
+	off0, err := log.Append(randomBytes(10))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	off1, err := log.Append(randomBytes(10))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	log.Close()
+
+	matches, _ := filepath.Glob("test_log/segment-*-*.log")
+	if len(matches) < 2 {
+		t.Errorf("Expected segments to be rotated but found %v", matches)
+	}
+
+	log, err = OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer log.Close()
+
+	if len(log.segments) != len(matches) {
+		t.Errorf("Expected %d segments but %d were opened", len(matches), len(log.segments))
+	}
+
+	for _, off := range []int64{off0, off1} {
+		if _, err := log.Read(off); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	cfg.NameTemplate = "segment-{time}.log"
+	if _, err := OpenLogWithConfig("test_log", cfg); err != ErrInvalidArguments {
+		t.Errorf("Expected ErrInvalidArguments but %v was returned instead", err)
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize:    100,
+		NameTemplate:      DefaultNameTemplate,
+		TimeLayout:        DefaultTimeLayout,
+		RetentionSegments: 2,
+		PurgeInterval:     10 * time.Millisecond,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+	defer log.Close()
+
+	var offs []int64
+	for i := 0; i < 20; i++ {
+		off, err := log.Append(randomBytes(20))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	matches, _ := filepath.Glob("test_log/*.aof")
+	if len(matches) != 2 {
+		t.Errorf("Expected 2 segments after purging but found %d", len(matches))
+	}
+
+	if log.Head() != offs[10] {
+		t.Errorf("Expected head to be at offset %d but it is at %d", offs[10], log.Head())
+	}
+
+	if _, err := log.Read(offs[0]); err != ErrOffsetPurged {
+		t.Errorf("Expected ErrOffsetPurged but %v was returned instead", err)
+	}
+
+	if _, err := log.Read(offs[10]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestLogTruncateHead(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+	defer log.Close()
+
+	var offs []int64
+	for i := 0; i < 20; i++ {
+		off, err := log.Append(randomBytes(20))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	if err := log.TruncateHead(offs[7]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(log.segments) != 3 || log.Head() != offs[7] {
+		t.Errorf("Expected 3 segments and head at %d but found %d segments and head at %d", offs[7], len(log.segments), log.Head())
+	}
+
+	if _, err := log.Read(offs[6]); err != ErrOffsetPurged {
+		t.Errorf("Expected ErrOffsetPurged but %v was returned instead", err)
+	}
+
+	if _, err := log.Read(offs[7]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestLogFoldWhileAppending(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+	defer log.Close()
+
+	var offs []int64
+	for i := 0; i < 20; i++ {
+		off, err := log.Append(randomBytes(20))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	// The log isn't locked while folding, so entries can be appended and read from the handler
+	var folded []int64
+	err = log.ForEach(func(e *Entry) (bool, error) {
+		folded = append(folded, e.Offset())
+
+		if len(folded) == 1 {
+			if _, err := log.Append(randomBytes(20)); err != nil {
+				return true, err
+			}
+		}
+
+		_, err := log.Read(e.Offset())
+		return false, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(folded) < len(offs) || !slices.Equal(folded[:len(offs)], offs) {
+		t.Errorf("Unexpected folded offsets %v", folded)
+	}
+}
+
+func TestLogArchive(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize:    100,
+		NameTemplate:      DefaultNameTemplate,
+		TimeLayout:        DefaultTimeLayout,
+		ArchiveDir:        "test_log/archive",
+		ArchiveCompressor: GzipCompressor,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+
+	var offs []int64
+	var bss [][]byte
+	for i := 0; i < 20; i++ {
+		b := randomBytes(20)
+		off, err := log.Append(b)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+		bss = append(bss, b)
+	}
+
+	log.Close()
+
+	archived, _ := filepath.Glob("test_log/archive/*.aof.gz")
+	hot, _ := filepath.Glob("test_log/*.aof")
+	if len(archived) != 3 || len(hot) != 1 {
+		t.Errorf("Expected 3 archived and 1 hot segments but found %v and %v", archived, hot)
+	}
+
+	log, err = OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer log.Close()
+
+	for i, off := range offs {
+		e, err := log.Read(off)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !bytes.Equal(e.Bytes(), bss[i]) {
+			t.Errorf("Unexpected entry read at offset %d", off)
+		}
+	}
+
+	off, err := log.Append(randomBytes(20))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if off != offs[19]+23 {
+		t.Errorf("Expected entry to be appended at offset %d but it was at %d", offs[19]+23, off)
+	}
+}
+
+func TestLogLocate(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+	defer log.Close()
+
+	var offs []int64
+	for i := 0; i < 12; i++ {
+		off, err := log.Append(randomBytes(20))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		offs = append(offs, off)
+	}
+
+	segs := log.Segments()
+	if len(segs) != 3 || segs[1].Start != offs[5] || segs[1].Size != 5*23 {
+		t.Errorf("Unexpected segments %v", segs)
+	}
+
+	seg, segOff, err := log.Locate(offs[7])
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if seg.Path != segs[1].Path || segOff != offs[7]-offs[5] {
+		t.Errorf("Unexpected location %v at offset %d", seg, segOff)
+	}
+
+	sum, err := log.Fold(func(e *Entry, pred interface{}) (interface{}, bool, error) {
+		return pred.(int) + e.Size(), false, nil
+	}, 0)
+	if err != nil || sum.(int) != 12*20 {
+		t.Errorf("Unexpected fold result %v, err: %v", sum, err)
+	}
+}
+
+func TestLogQuota(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize: DefaultMaxEntrySize,
+			BaseOffset:   DefaultBaseOffset,
+			Perm:         DefaultPerm,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+		MaxLogSize:     230,
+		QuotaPolicy:    QuotaFail,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+
+	for i := 0; i < 10; i++ {
+		if _, err := log.Append(randomBytes(20)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := log.Append(randomBytes(20)); err != ErrQuotaExceeded {
+		t.Errorf("Expected error %v but %v was returned", ErrQuotaExceeded, err)
+	}
+
+	log.Close()
+
+	cfg.QuotaPolicy = QuotaPurge
+
+	log, err = OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer log.Close()
+
+	var last int64
+
+	for i := 0; i < 10; i++ {
+		if last, err = log.Append(randomBytes(20)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if size := log.Size() - log.Head(); size > 230 {
+		t.Errorf("Expected at most 230 bytes but %d are kept", size)
+	}
+
+	if log.Head() == 0 {
+		t.Errorf("Expected oldest segments to be purged")
+	}
+
+	if _, err := log.Read(last); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := log.Append(randomBytes(300)); err != ErrQuotaExceeded {
+		t.Errorf("Expected error %v but %v was returned", ErrQuotaExceeded, err)
+	}
+}
+
+func TestLogForEachBetween(t *testing.T) {
+	cfg := &LogConfig{
+		Segment: &Config{
+			MaxEntrySize:  DefaultMaxEntrySize,
+			BaseOffset:    DefaultBaseOffset,
+			Perm:          DefaultPerm,
+			Timestamps:    true,
+			IndexInterval: 2,
+		},
+		MaxSegmentSize: 100,
+		NameTemplate:   DefaultNameTemplate,
+		TimeLayout:     DefaultTimeLayout,
+	}
+
+	log, err := OpenLogWithConfig("test_log", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll("test_log")
+	defer log.Close()
+
+	var ts []time.Time
+	for i := 0; i < 20; i++ {
+		off, err := log.Append([]byte(fmt.Sprintf("entry%02d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		e, err := log.Read(off)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		ts = append(ts, e.Timestamp())
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(log.Segments()) < 3 {
+		t.Fatalf("Expected several segments but %d were found", len(log.Segments()))
+	}
+
+	var read []string
+	err = log.ForEachBetween(ts[5], ts[15], func(e *Entry) (bool, error) {
+		read = append(read, string(e.Bytes()))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(read) != 10 || read[0] != "entry05" || read[9] != "entry14" {
+		t.Errorf("Unexpected entries %v", read)
+	}
+}
@@ -0,0 +1,55 @@
+package aof
+
+import "io"
+
+// OpenMemory opens an appender over a new in-memory file. The file uses the same format as files on disk
+// and is discarded when the appender is closed, see OpenRW
+func OpenMemory(cfg *Config) (app *Appender, err error) {
+	return OpenRW(&memFile{}, cfg)
+}
+
+// memFile is an in-memory io.ReadWriteSeeker supporting Truncate
+type memFile struct {
+	b   []byte
+	pos int64
+}
+
+func (m *memFile) Read(b []byte) (int, error) {
+	if m.pos >= int64(len(m.b)) {
+		return 0, io.EOF
+	}
+	n := copy(b, m.b[m.pos:])
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memFile) Write(b []byte) (int, error) {
+	if end := m.pos + int64(len(b)); end > int64(len(m.b)) {
+		m.b = append(m.b, make([]byte, end-int64(len(m.b)))...)
+	}
+	n := copy(m.b[m.pos:], b)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memFile) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		off += m.pos
+	case io.SeekEnd:
+		off += int64(len(m.b))
+	}
+	if off < 0 {
+		return 0, ErrInvalidArguments
+	}
+	m.pos = off
+	return off, nil
+}
+
+func (m *memFile) Truncate(size int64) error {
+	if size < 0 || size > int64(len(m.b)) {
+		return ErrInvalidArguments
+	}
+	m.b = m.b[:size]
+	return nil
+}
@@ -0,0 +1,194 @@
+package aof
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash/crc32"
+)
+
+// metaLayout describes the optional fields stored between the size and the content of every entry.
+// Field offsets are -1 when the field is not enabled in the file header. The checksum, when enabled,
+// is always the first field and covers the rest of the metadata and the stored content. The signature,
+// an HMAC-SHA256 of the metadata following it and the stored content, comes next, followed by the hash
+// of the previous entry in chained files
+type metaLayout struct {
+	len       int
+	checksum  int
+	signature int
+	prev      int
+	timestamp int
+	tag       int
+	seq       int
+	kind      int
+	version   int
+	// signingKey is the key of the signatures
+	signingKey []byte
+}
+
+// entryMeta holds the values of the optional metadata fields of an entry
+type entryMeta struct {
+	checksum  uint32
+	timestamp int64
+	tag       uint8
+	seq       uint64
+	version   uint16
+	// prev is the hash of the previous entry in chained files, see VerifyChain
+	prev []byte
+	// tombstone marks an entry deleting an earlier one, see Delete
+	tombstone bool
+	// reference marks an entry storing the offset of an earlier entry with the same content, see Config.Dedup
+	reference bool
+	// checkpoint marks an entry holding a snapshot of the state, see Checkpoint
+	checkpoint bool
+	// key is not part of the metadata layout, it is stored in front of the payload
+	key []byte
+	// batch flags every entry but the last one as pending, see Tx
+	batch bool
+}
+
+func newMetaLayout(flags uint16) *metaLayout {
+	l := &metaLayout{checksum: -1, signature: -1, prev: -1, timestamp: -1, tag: -1, seq: -1, kind: -1, version: -1}
+
+	if flags&hChecksum != 0 {
+		l.checksum = l.len
+		l.len += crc32.Size
+	}
+
+	if flags&hSigned != 0 {
+		l.signature = l.len
+		l.len += sha256.Size
+	}
+
+	if flags&hChained != 0 {
+		l.prev = l.len
+		l.len += sha256.Size
+	}
+
+	if flags&hTimestamp != 0 {
+		l.timestamp = l.len
+		l.len += 8
+	}
+
+	if flags&hType != 0 {
+		l.tag = l.len
+		l.len++
+	}
+
+	if flags&hSequence != 0 {
+		l.seq = l.len
+		l.len += 8
+	}
+
+	if flags&(hTombstones|hDedup|hCheckpoints) != 0 {
+		l.kind = l.len
+		l.len++
+	}
+
+	if flags&hVersions != 0 {
+		l.version = l.len
+		l.len += 2
+	}
+
+	return l
+}
+
+// encode fills b with the metadata values in m of an entry with stored content bs
+func (l *metaLayout) encode(b []byte, bs []byte, m *entryMeta) {
+	if l.prev >= 0 {
+		copy(b[l.prev:l.prev+sha256.Size], m.prev)
+	}
+
+	if l.timestamp >= 0 {
+		byteOrder.PutUint64(b[l.timestamp:], uint64(m.timestamp))
+	}
+
+	if l.tag >= 0 {
+		b[l.tag] = m.tag
+	}
+
+	if l.seq >= 0 {
+		byteOrder.PutUint64(b[l.seq:], m.seq)
+	}
+
+	if l.kind >= 0 {
+		b[l.kind] = 0
+		if m.tombstone {
+			b[l.kind] = kindTombstone
+		} else if m.reference {
+			b[l.kind] = kindReference
+		} else if m.checkpoint {
+			b[l.kind] = kindCheckpoint
+		}
+	}
+
+	if l.version >= 0 {
+		byteOrder.PutUint16(b[l.version:], m.version)
+	}
+
+	if l.signature >= 0 {
+		l.sign(b[l.signature:l.signature], b, bs)
+	}
+
+	if l.checksum >= 0 {
+		byteOrder.PutUint32(b[l.checksum:], l.sum(b, bs))
+	}
+}
+
+// decode sets the metadata fields of e from b
+func (l *metaLayout) decode(e *Entry, b []byte) {
+	e.rawMeta = append(e.rawMeta[:0], b...)
+
+	if l.checksum >= 0 {
+		e.checksum = byteOrder.Uint32(b[l.checksum:])
+	}
+
+	if l.timestamp >= 0 {
+		e.timestamp = int64(byteOrder.Uint64(b[l.timestamp:]))
+	}
+
+	if l.tag >= 0 {
+		e.tag = b[l.tag]
+	}
+
+	if l.seq >= 0 {
+		e.seq = byteOrder.Uint64(b[l.seq:])
+	}
+
+	if l.kind >= 0 {
+		e.tombstone = b[l.kind] == kindTombstone
+		e.reference = b[l.kind] == kindReference
+		e.checkpoint = b[l.kind] == kindCheckpoint
+	}
+
+	if l.version >= 0 {
+		e.version = byteOrder.Uint16(b[l.version:])
+	}
+}
+
+// sum computes the checksum of an entry given its metadata and stored content
+func (l *metaLayout) sum(meta []byte, bs []byte) uint32 {
+	crc := crc32.Checksum(meta[l.checksum+crc32.Size:], crc32cTable)
+	return crc32.Update(crc, crc32cTable, bs)
+}
+
+// sign appends to dst the signature of an entry given its metadata and stored content
+func (l *metaLayout) sign(dst []byte, meta []byte, bs []byte) []byte {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write(meta[l.signature+sha256.Size:])
+	mac.Write(bs)
+	return mac.Sum(dst)
+}
+
+// chainHash returns the hash of an entry given its metadata and stored content, which is stored
+// in the next entry. It covers every metadata field from the hash of the previous entry on
+func (l *metaLayout) chainHash(meta []byte, bs []byte) []byte {
+	h := sha256.New()
+	h.Write(meta[l.prev:])
+	h.Write(bs)
+	return h.Sum(nil)
+}
+
+// validSignature reports whether the signature stored in meta matches the metadata and stored content
+func (l *metaLayout) validSignature(meta []byte, bs []byte) bool {
+	return hmac.Equal(meta[l.signature:l.signature+sha256.Size], l.sign(nil, meta, bs))
+}
@@ -0,0 +1,104 @@
+package aof
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives events from appenders, see Config.Metrics. Implementations must be safe for concurrent use
+// and should not block. Counters keeps running totals which can be exported to monitoring systems
+type Metrics interface {
+	// Appended is called after entries holding bytes payload bytes were written
+	Appended(entries int, bytes int64)
+	// Flushed is called after buffered writes were flushed to the OS
+	Flushed()
+	// Synced is called after the file was fsynced
+	Synced()
+	// Scanned is called after entries were scanned by Open or FoldWithHandler
+	Scanned(entries int64, d time.Duration)
+	// Repaired is called after an incomplete entry or transaction was padded or removed
+	Repaired()
+}
+
+type noMetrics struct{}
+
+func (noMetrics) Appended(entries int, bytes int64)      {}
+func (noMetrics) Flushed()                               {}
+func (noMetrics) Synced()                                {}
+func (noMetrics) Scanned(entries int64, d time.Duration) {}
+func (noMetrics) Repaired()                              {}
+
+// Counters is a Metrics implementation keeping running totals. A single Counters may be shared by many appenders
+type Counters struct {
+	appends  atomic.Int64
+	entries  atomic.Int64
+	bytes    atomic.Int64
+	flushes  atomic.Int64
+	syncs    atomic.Int64
+	scans    atomic.Int64
+	scanned  atomic.Int64
+	scanTime atomic.Int64
+	repairs  atomic.Int64
+}
+
+// CountersSnapshot holds the values of Counters at a point in time
+type CountersSnapshot struct {
+	Appends  int64
+	Entries  int64
+	Bytes    int64
+	Flushes  int64
+	Syncs    int64
+	Scans    int64
+	Scanned  int64
+	ScanTime time.Duration
+	Repairs  int64
+}
+
+func (c *Counters) Appended(entries int, bytes int64) {
+	c.appends.Add(1)
+	c.entries.Add(int64(entries))
+	c.bytes.Add(bytes)
+}
+
+func (c *Counters) Flushed() {
+	c.flushes.Add(1)
+}
+
+func (c *Counters) Synced() {
+	c.syncs.Add(1)
+}
+
+func (c *Counters) Scanned(entries int64, d time.Duration) {
+	c.scans.Add(1)
+	c.scanned.Add(entries)
+	c.scanTime.Add(int64(d))
+}
+
+func (c *Counters) Repaired() {
+	c.repairs.Add(1)
+}
+
+func (c *Counters) Snapshot() CountersSnapshot {
+	return CountersSnapshot{
+		Appends:  c.appends.Load(),
+		Entries:  c.entries.Load(),
+		Bytes:    c.bytes.Load(),
+		Flushes:  c.flushes.Load(),
+		Syncs:    c.syncs.Load(),
+		Scans:    c.scans.Load(),
+		Scanned:  c.scanned.Load(),
+		ScanTime: time.Duration(c.scanTime.Load()),
+		Repairs:  c.repairs.Load(),
+	}
+}
+
+// countingHandler counts the entries passed to handler
+type countingHandler struct {
+	FoldHandler
+	n int64
+}
+
+func (h *countingHandler) Fold(e *Entry) (bool, error) {
+	h.n++
+	return h.FoldHandler.Fold(e)
+}
@@ -0,0 +1,82 @@
+package aof
+
+import "os"
+
+const migrateExt = ".migrate"
+
+// Migrate rewrites the file src into the new file dst using the format settings of dstCfg, such as MaxEntrySize,
+// VarintSize, Checksum, a Dictionary or an EncryptionKey. src is opened with srcCfg and read using the format recorded in its
+// header, version 0 and 1 files are migrated to the current format version. Every entry is decoded and verified while
+// copied, keeping its timestamp, type tag, sequence number, version and key. Incomplete and deleted entries, as
+// well as tombstones, are dropped. dst is verified before being moved into place and existing files are never
+// overwritten. Offsets change, the returned map translates offsets of src into offsets of dst
+func Migrate(src string, dst string, srcCfg *Config, dstCfg *Config) (offsets map[int64]int64, err error) {
+	if _, err := os.Stat(dst); err == nil {
+		return nil, os.ErrExist
+	}
+
+	scfg := *srcCfg
+	scfg.ReadOnly = true
+	scfg.PersistIndex = false
+	scfg.Mmap = false
+	scfg.Recovery = RecoverFail
+	scfg.ReadHooks = nil
+
+	app, err := OpenWithConfig(src, &scfg)
+	if err != nil {
+		return nil, err
+	}
+	defer app.Close()
+
+	tmpFilename := dst + migrateExt
+
+	os.Remove(tmpFilename)
+
+	offsets, err = app.migrateInto(tmpFilename, dstCfg)
+	if err == nil {
+		err = verifyFile(tmpFilename, dstCfg)
+	}
+	if err == nil {
+		err = os.Rename(tmpFilename, dst)
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+		return nil, err
+	}
+
+	return offsets, nil
+}
+
+// migrateInto appends every complete entry not deleted into the new file filename, created using cfg
+func (app *Appender) migrateInto(filename string, cfg *Config) (map[int64]int64, error) {
+	dcfg := *cfg
+	dcfg.ReadOnly = false
+	dcfg.PersistIndex = false
+	dcfg.AppendHooks = nil
+	dcfg.FlushInterval = 0
+
+	dst, err := OpenWithConfig(filename, &dcfg)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	handler := &compactHandler{
+		f: func(e *Entry) (bool, []byte, error) {
+			return !e.tombstone && !app.deleted.has(e.off), nil, nil
+		},
+		dst:     dst,
+		offsets: make(map[int64]int64),
+	}
+
+	if err := app.fold(handler, true); err != nil {
+		return nil, err
+	}
+
+	if err := dst.Sync(); err != nil {
+		return nil, err
+	}
+
+	return handler.offsets, nil
+}
@@ -0,0 +1,353 @@
+package aof
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const mirrorExt = ".mirror"
+
+var ErrMirrorLagging = errors.New("aof: Mirror fell too far behind")
+
+// mirrorQueueSize is the number of appends a mirror may fall behind the quorum before failing with ErrMirrorLagging
+const mirrorQueueSize = 64
+
+// MirroredAppender appends every entry to several files, usually on different disks, and acknowledges
+// appends once a quorum of them succeeded. A mirror failing an append is no longer written to. Only appends
+// are mirrored, the files must not be modified by other means while they are open
+type MirroredAppender struct {
+	mux     sync.Mutex
+	mirrors []*mirror
+	quorum  int
+	closed  bool
+}
+
+// mirror appends the queued entries in order to one of the files from a dedicated goroutine
+type mirror struct {
+	app   *Appender
+	queue chan *mirrorAppend
+	done  chan struct{}
+
+	// err is set once an append failed on the mirror
+	mux sync.Mutex
+	err error
+}
+
+// mirrorAppend holds entries waiting to be appended by every mirror with the same metadata
+type mirrorAppend struct {
+	bss  [][]byte
+	m    entryMeta
+	done chan mirrorResult
+}
+
+type mirrorResult struct {
+	offs []int64
+	err  error
+	// failed is set when the mirror can no longer be written to
+	failed bool
+}
+
+// OpenMirrored opens an appender mirroring entries into every file of filenames, all using cfg. Appends are
+// acknowledged once quorum files stored them. Files left behind by a failure are replaced with a copy of the
+// most advanced one on Open. Files which can't be opened are left out, as long as quorum of them can
+func OpenMirrored(filenames []string, quorum int, cfg *Config) (*MirroredAppender, error) {
+	if quorum < 1 || quorum > len(filenames) {
+		return nil, ErrInvalidArguments
+	}
+
+	if cfg.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	ma := &MirroredAppender{quorum: quorum}
+
+	apps := make([]*Appender, len(filenames))
+	errs := make([]error, len(filenames))
+
+	for i, filename := range filenames {
+		app, err := OpenWithConfig(filename, cfg)
+		if err != nil {
+			if app != nil {
+				app.Close()
+			}
+			errs[i] = err
+			continue
+		}
+		apps[i] = app
+	}
+
+	syncMirrors(filenames, apps, errs, cfg)
+
+	healthy := 0
+	for _, app := range apps {
+		if app != nil {
+			healthy++
+		}
+	}
+
+	if healthy < quorum {
+		for _, app := range apps {
+			if app != nil {
+				app.Close()
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	for i, app := range apps {
+		mr := &mirror{app: app, err: errs[i]}
+		if app != nil {
+			mr.queue = make(chan *mirrorAppend, mirrorQueueSize)
+			mr.done = make(chan struct{})
+			go mr.run()
+		}
+		ma.mirrors = append(ma.mirrors, mr)
+	}
+
+	return ma, nil
+}
+
+// syncMirrors replaces every file holding less data than the most advanced one with a copy of it.
+// Mirrors which can't be synced are left out, with their error recorded in errs
+func syncMirrors(filenames []string, apps []*Appender, errs []error, cfg *Config) {
+	var leader *Appender
+	for _, app := range apps {
+		if app != nil && (leader == nil || app.Size() > leader.Size()) {
+			leader = app
+		}
+	}
+
+	for i, app := range apps {
+		if app == nil || app.Size() == leader.Size() {
+			continue
+		}
+
+		app.Close()
+		apps[i] = nil
+
+		if errs[i] = copyMirror(leader, filenames[i], cfg); errs[i] != nil {
+			continue
+		}
+
+		if apps[i], errs[i] = OpenWithConfig(filenames[i], cfg); errs[i] != nil {
+			apps[i] = nil
+		}
+	}
+}
+
+// copyMirror replaces filename with a copy of the file of app
+func copyMirror(app *Appender, filename string, cfg *Config) error {
+	tmpFilename := filename + mirrorExt
+
+	f, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, cfg.Perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		os.Remove(indexFilename(filename))
+		err = os.Rename(tmpFilename, filename)
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+	}
+
+	return err
+}
+
+func (mr *mirror) run() {
+	defer close(mr.done)
+
+	for req := range mr.queue {
+		if err := mr.failure(); err != nil {
+			req.done <- mirrorResult{err: err, failed: true}
+			continue
+		}
+
+		offs, failed, err := mr.app.appendMirrored(req.bss, req.m)
+		if failed {
+			mr.fail(err)
+		}
+
+		req.done <- mirrorResult{offs: offs, err: err, failed: failed}
+	}
+}
+
+func (mr *mirror) failure() error {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+
+	return mr.err
+}
+
+func (mr *mirror) fail(err error) {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+
+	if mr.err == nil {
+		mr.err = err
+	}
+}
+
+// appendMirrored appends bss with the metadata values in m. failed is set when the appender can no longer be
+// written to, as opposed to invalid entries, which every mirror rejects alike
+func (app *Appender) appendMirrored(bss [][]byte, m entryMeta) (offs []int64, failed bool, err error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	offs, err = app.appendBulk(bss, &m)
+
+	return offs, app.closed, err
+}
+
+func (ma *MirroredAppender) Append(bs []byte) (off int64, err error) {
+	offs, err := ma.AppendBulk([][]byte{bs})
+	if err != nil {
+		return 0, err
+	}
+	return offs[0], nil
+}
+
+// AppendBulk appends every entry of bss to every mirror and returns once quorum mirrors stored them.
+// ErrQuorumNotReached is returned when too many mirrors failed
+func (ma *MirroredAppender) AppendBulk(bss [][]byte) (offs []int64, err error) {
+	// Every mirror records the same metadata
+	req := &mirrorAppend{
+		bss:  bss,
+		m:    entryMeta{timestamp: time.Now().UnixNano()},
+		done: make(chan mirrorResult, len(ma.mirrors)),
+	}
+
+	ma.mux.Lock()
+
+	if ma.closed {
+		ma.mux.Unlock()
+		return nil, ErrAppenderClosed
+	}
+
+	// Requests are queued with the lock held so every mirror appends them in the same order. A mirror too far
+	// behind fails instead of blocking every append
+	queued := 0
+	for _, mr := range ma.mirrors {
+		if mr.failure() != nil {
+			continue
+		}
+
+		select {
+		case mr.queue <- req:
+			queued++
+		default:
+			mr.fail(ErrMirrorLagging)
+		}
+	}
+
+	ma.mux.Unlock()
+
+	if queued < ma.quorum {
+		return nil, ErrQuorumNotReached
+	}
+
+	stored, failed := 0, 0
+
+	for range queued {
+		res := <-req.done
+
+		switch {
+		case res.err == nil:
+			stored++
+			if offs == nil {
+				offs = res.offs
+			}
+		case res.failed:
+			failed++
+		default:
+			return nil, res.err
+		}
+
+		if stored == ma.quorum {
+			return offs, nil
+		}
+
+		if queued-failed < ma.quorum {
+			return nil, ErrQuorumNotReached
+		}
+	}
+
+	return nil, ErrQuorumNotReached
+}
+
+// Read reads the entry located at offset off from the first mirror holding it
+func (ma *MirroredAppender) Read(off int64) (e *Entry, err error) {
+	err = ErrQuorumNotReached
+
+	for _, mr := range ma.mirrors {
+		if mr.failure() != nil {
+			continue
+		}
+
+		if e, err = mr.app.Read(off); err == nil {
+			return e, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Failures returns the error which made every mirror fail, in the order of the files given to OpenMirrored.
+// It is nil for healthy mirrors
+func (ma *MirroredAppender) Failures() []error {
+	errs := make([]error, len(ma.mirrors))
+	for i, mr := range ma.mirrors {
+		errs[i] = mr.failure()
+	}
+	return errs
+}
+
+// Close waits until every mirror appended the queued entries and closes them
+func (ma *MirroredAppender) Close() error {
+	ma.mux.Lock()
+
+	if ma.closed {
+		ma.mux.Unlock()
+		return ErrAppenderClosed
+	}
+
+	ma.closed = true
+
+	ma.mux.Unlock()
+
+	var err error
+
+	for _, mr := range ma.mirrors {
+		if mr.app == nil {
+			continue
+		}
+
+		close(mr.queue)
+		<-mr.done
+
+		cerr := mr.app.Close()
+
+		// Mirrors failing an append were already closed, lagging ones are closed once they caught up
+		if mr.failure() != nil {
+			continue
+		}
+
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package aof
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+// minMmapSize is the smallest mapping created, larger mappings are created as the file grows
+const minMmapSize = 1 << 20
+
+// mapping returns a read-only memory mapping covering the entries of v, or nil if Mmap is not enabled
+// or the file can't be mapped. It must be called with mux held
+func (app *Appender) mapping(v view) []byte {
+	if !app.cfg.Mmap {
+		return nil
+	}
+
+	need := v.dataOffset + v.size
+
+	if int64(len(app.mmap)) < need {
+		f, ok := app.f.(*os.File)
+		if !ok {
+			return nil
+		}
+
+		n := max(need, 2*int64(len(app.mmap)), minMmapSize)
+		if n > math.MaxInt {
+			return nil
+		}
+
+		// Mappings are only released on Close as entries may still point into them
+		b, err := mmapFile(f, int(n))
+		if err != nil {
+			return nil
+		}
+
+		app.mmaps = append(app.mmaps, b)
+		app.mmap = b
+	}
+
+	// The mapping may extend beyond the end of the file, which must not be accessed
+	return app.mmap[:need]
+}
+
+// unmapAll releases every mapping created by the appender
+func (app *Appender) unmapAll() {
+	for _, b := range app.mmaps {
+		munmapFile(b)
+	}
+	app.mmaps = nil
+	app.mmap = nil
+}
+
+// readMapped fills up e with the complete entry located at pos of the mapping m, without copying its content.
+// It returns false if the entry is incomplete or invalid, in which case it must be read from the file
+func (e *Entry) readMapped(app *Appender, m []byte, pos int64) bool {
+	if pos >= int64(len(m)) {
+		return false
+	}
+
+	b := m[pos:]
+
+	var size, sizeLen int
+
+	if app.varintSize {
+		s, n := binary.Uvarint(b[:min(len(b), len(app.sharedMem.bufRWEntrySize))])
+		if n <= 0 || s > uint64(app.maxStoredSize) {
+			return false
+		}
+		size, sizeLen = int(s), n
+	} else {
+		sizeLen = len(app.sharedMem.bufRWEntrySize)
+		if len(b) < sizeLen {
+			return false
+		}
+		size = readInt(b[:sizeLen])
+		if size < 0 || size > app.maxStoredSize {
+			return false
+		}
+	}
+
+	start := sizeLen + app.meta.len
+	end := start + size
+
+	if len(b) <= end || (b[end] != fCompleteEntry && b[end] != fPendingEntry) {
+		return false
+	}
+
+	app.meta.decode(e, b[sizeLen:start])
+
+	e.size = size
+	e.sizeLen = sizeLen
+	e.bytes = b[start:end:end]
+	e.payload = e.bytes
+	e.key = nil
+	e.pending = b[end] == fPendingEntry
+	e.incomplete = false
+
+	return true
+}
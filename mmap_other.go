@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package aof
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile always fails on platforms without memory mapping support, reads go through the file
+func mmapFile(f *os.File, n int) ([]byte, error) {
+	return nil, errors.New("aof: Memory mapping not supported")
+}
+
+func munmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package aof
+
+import "os"
+
+// Option sets a field of the Config used by OpenWithOptions
+type Option func(cfg *Config)
+
+// OpenWithOptions opens filename with the configuration used by Open modified by opts, in order.
+// Options only cover the most common settings, any other can be set with WithConfig
+func OpenWithOptions(filename string, opts ...Option) (app *Appender, err error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return OpenWithConfig(filename, cfg)
+}
+
+func WithMaxEntrySize(size int) Option {
+	return func(cfg *Config) {
+		cfg.MaxEntrySize = size
+	}
+}
+
+// WithBaseOffset sets the offset at which the file header starts, see Config.BaseOffset
+func WithBaseOffset(off int64) Option {
+	return func(cfg *Config) {
+		cfg.BaseOffset = off
+	}
+}
+
+func WithPerm(perm os.FileMode) Option {
+	return func(cfg *Config) {
+		cfg.Perm = perm
+	}
+}
+
+func WithReadOnly() Option {
+	return func(cfg *Config) {
+		cfg.ReadOnly = true
+	}
+}
+
+func WithChecksum() Option {
+	return func(cfg *Config) {
+		cfg.Checksum = true
+	}
+}
+
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(cfg *Config) {
+		cfg.SyncPolicy = policy
+	}
+}
+
+func WithSyncWrites(s SyncWrites) Option {
+	return func(cfg *Config) {
+		cfg.SyncWrites = s
+	}
+}
+
+// WithConfig lets f modify any setting of the configuration
+func WithConfig(f func(cfg *Config)) Option {
+	return Option(f)
+}
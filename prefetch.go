@@ -0,0 +1,134 @@
+package aof
+
+import (
+	"bufio"
+	"io"
+)
+
+// prefetchChunkSize is the size of every buffer of the read-ahead ring
+const prefetchChunkSize = 64 << 10
+
+type prefetchChunk struct {
+	b   []byte
+	err error
+}
+
+// prefetcher reads a range of a file ahead of its consumer from a background goroutine into a ring of
+// buffers, so decoding entries overlaps with disk I/O. Seeking restarts reading at the new position
+type prefetcher struct {
+	r    io.ReaderAt
+	end  int64
+	bufs [][]byte
+	free chan []byte
+	full chan prefetchChunk
+	stop chan struct{}
+	done chan struct{}
+	// cur holds the unread part of the chunk being consumed, whose buffer is buf
+	cur []byte
+	buf []byte
+}
+
+// newPrefetcher reads r up to the position end using buffers of readAhead bytes in total
+func newPrefetcher(r io.ReaderAt, end int64, readAhead int) *prefetcher {
+	n := max(2, (readAhead+prefetchChunkSize-1)/prefetchChunkSize)
+
+	pf := &prefetcher{r: r, end: end, bufs: make([][]byte, n)}
+	for i := range pf.bufs {
+		pf.bufs[i] = make([]byte, prefetchChunkSize)
+	}
+
+	return pf
+}
+
+// start stops any read in progress and starts reading at position pos
+func (pf *prefetcher) start(pos int64) {
+	pf.close()
+
+	pf.free = make(chan []byte, len(pf.bufs))
+	pf.full = make(chan prefetchChunk, len(pf.bufs))
+	pf.stop = make(chan struct{})
+	pf.done = make(chan struct{})
+	pf.cur, pf.buf = nil, nil
+
+	for _, b := range pf.bufs {
+		pf.free <- b
+	}
+
+	go pf.run(pos, pf.free, pf.full, pf.stop, pf.done)
+}
+
+func (pf *prefetcher) run(pos int64, free chan []byte, full chan prefetchChunk, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	defer close(full)
+
+	for pos < pf.end {
+		var b []byte
+
+		select {
+		case b = <-free:
+		case <-stop:
+			return
+		}
+
+		n, err := pf.r.ReadAt(b[:min(int64(len(b)), pf.end-pos)], pos)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+
+		full <- prefetchChunk{b: b[:n], err: err}
+
+		if err != nil {
+			return
+		}
+
+		pos += int64(n)
+	}
+}
+
+func (pf *prefetcher) Read(p []byte) (int, error) {
+	if len(pf.cur) == 0 {
+		if pf.buf != nil {
+			pf.free <- pf.buf[:cap(pf.buf)]
+			pf.buf = nil
+		}
+
+		c, ok := <-pf.full
+		if !ok {
+			return 0, io.EOF
+		}
+		if len(c.b) == 0 {
+			pf.free <- c.b[:cap(c.b)]
+			return 0, c.err
+		}
+
+		pf.cur, pf.buf = c.b, c.b
+	}
+
+	n := copy(p, pf.cur)
+	pf.cur = pf.cur[n:]
+
+	return n, nil
+}
+
+// close stops the background goroutine, if running
+func (pf *prefetcher) close() {
+	if pf.stop == nil {
+		return
+	}
+
+	close(pf.stop)
+	for range pf.full {
+	}
+	<-pf.done
+
+	pf.stop = nil
+}
+
+// prefetchReader returns a file reader sharing the buffers of rd which reads ahead of the entries
+// being read, up to the end of view v
+func (app *Appender) prefetchReader(rd *fileReader, v view) *fileReader {
+	prd := *rd
+	prd.ahead = newPrefetcher(rd.f, v.dataOffset+v.size, app.cfg.ReadAhead)
+	prd.r = bufio.NewReader(prd.ahead)
+	return &prd
+}
@@ -0,0 +1,80 @@
+package aof
+
+// QuotaPolicy determines what happens when appending to a Log would exceed LogConfig.MaxLogSize
+type QuotaPolicy int
+
+const (
+	// QuotaFail fails the append with ErrQuotaExceeded
+	QuotaFail QuotaPolicy = iota
+	// QuotaPurge deletes the oldest segments, rotating the active one if needed, until the entries fit
+	QuotaPurge
+)
+
+const DefaultQuotaPolicy = QuotaFail
+
+// storedLen returns the number of bytes needed to store bss without hooks, the size of the frames
+// written by AppendBulk
+func (app *Appender) storedLen(bss [][]byte) int64 {
+	var n int64
+	for _, bs := range bss {
+		size := len(bs)
+		if app.aead != nil {
+			size += app.aead.NonceSize() + app.aead.Overhead()
+		}
+		n += app.frameLen(size)
+	}
+	return n
+}
+
+// size returns the number of bytes held by every segment
+func (log *Log) size() int64 {
+	var size int64
+	for _, seg := range log.segments {
+		size += seg.end() - seg.start
+	}
+	return size
+}
+
+// segmentFor returns the segment bss has to be appended to, enforcing the quota
+func (log *Log) segmentFor(bss [][]byte) (*segment, error) {
+	seg, err := log.activeSegment()
+	if err != nil {
+		return nil, err
+	}
+	return log.makeRoom(seg, seg.app.storedLen(bss))
+}
+
+// makeRoom enforces the quota before appending need bytes, returning the segment to append to
+func (log *Log) makeRoom(seg *segment, need int64) (*segment, error) {
+	if log.maxLogSize == 0 || log.size()+need <= log.maxLogSize {
+		return seg, nil
+	}
+
+	if log.quotaPolicy == QuotaFail {
+		return nil, ErrQuotaExceeded
+	}
+
+	for len(log.segments) > 1 && log.size()+need > log.maxLogSize {
+		if err := log.removeOldestSegment(); err != nil {
+			return nil, err
+		}
+	}
+
+	if log.size()+need > log.maxLogSize && seg.app.size > 0 {
+		var err error
+
+		if seg, err = log.rotate(); err != nil {
+			return nil, err
+		}
+
+		if err := log.removeOldestSegment(); err != nil {
+			return nil, err
+		}
+	}
+
+	if need > log.maxLogSize {
+		return nil, ErrQuotaExceeded
+	}
+
+	return seg, nil
+}
@@ -0,0 +1,121 @@
+package aof
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter bounds the entries and bytes appended per second with token buckets allowing bursts of up to
+// one second worth of appends. Appends larger than a burst wait until enough tokens are refilled
+type rateLimiter struct {
+	mux   sync.Mutex
+	ops   bucket
+	bytes bucket
+}
+
+// bucket holds the tokens available at time last, refilled at rate tokens per second. A zero rate disables it
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(ops int, bytes int64) *rateLimiter {
+	if ops == 0 && bytes == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &rateLimiter{
+		ops:   bucket{rate: float64(ops), tokens: float64(ops), last: now},
+		bytes: bucket{rate: float64(bytes), tokens: float64(bytes), last: now},
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.rate == 0 {
+		return
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// available returns true if n tokens can be taken without waiting. Requests larger than a burst need a full bucket
+func (b *bucket) available(n float64) bool {
+	return b.rate == 0 || b.tokens >= min(n, b.rate)
+}
+
+// take removes n tokens, returning the time until the bucket is no longer in debt
+func (b *bucket) take(n float64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// reserve takes the tokens needed to append n entries holding size bytes, returning how long the caller
+// has to wait. ErrRateLimited is returned without taking tokens if they are not available and fail is set
+func (l *rateLimiter) reserve(n int, size int64, fail bool) (time.Duration, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := time.Now()
+
+	l.ops.refill(now)
+	l.bytes.refill(now)
+
+	if fail && (!l.ops.available(float64(n)) || !l.bytes.available(float64(size))) {
+		return 0, ErrRateLimited
+	}
+
+	return max(l.ops.take(float64(n)), l.bytes.take(float64(size))), nil
+}
+
+// throttle waits until bss may be appended without exceeding the rate limits, or fails with ErrRateLimited
+// when using BackpressureFail. It must be called without holding the appender lock
+func (app *Appender) throttle(ctx context.Context, bss [][]byte) error {
+	if app.limiter == nil {
+		return nil
+	}
+
+	var size int64
+	for _, bs := range bss {
+		size += int64(len(bs))
+	}
+
+	return app.throttleN(ctx, len(bss), size)
+}
+
+// throttleN is like throttle for n entries holding size bytes
+func (app *Appender) throttleN(ctx context.Context, n int, size int64) error {
+	if app.limiter == nil {
+		return nil
+	}
+
+	wait, err := app.limiter.reserve(n, size, app.cfg.Backpressure == BackpressureFail)
+	if err != nil || wait == 0 {
+		return err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,332 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+)
+
+var ErrReaderClosed = errors.New("aof: Reader closed")
+
+// fileReader holds the state used to read entries from a file: a buffered reader and the buffers
+// for the size, metadata and flag fields. The appender uses its own one, every Reader gets another
+type fileReader struct {
+	f       file
+	r       *bufio.Reader
+	bufSize []byte
+	bufMeta []byte
+	bufFlag []byte
+	entry   *Entry
+	err     error
+	// ahead reads the file in background when set, see Config.ReadAhead
+	ahead *prefetcher
+}
+
+func newFileReader(f file, bufSize []byte, bufMeta []byte, bufFlag []byte, entry *Entry) *fileReader {
+	return &fileReader{
+		f:       f,
+		r:       bufio.NewReader(f),
+		bufSize: bufSize,
+		bufMeta: bufMeta,
+		bufFlag: bufFlag,
+		entry:   entry,
+	}
+}
+
+func (rd *fileReader) reset(f file) {
+	rd.f = f
+	rd.r.Reset(f)
+}
+
+// seek positions the reader at the absolute file position pos
+func (rd *fileReader) seek(pos int64) error {
+	if rd.ahead != nil {
+		rd.ahead.start(pos)
+		rd.r.Reset(rd.ahead)
+		return nil
+	}
+
+	_, err := rd.f.Seek(pos, io.SeekStart)
+	if err != nil {
+		return ErrUnexpectedReadError
+	}
+	rd.r.Reset(rd.f)
+	return nil
+}
+
+func (rd *fileReader) readFully(b []byte) (int, error) {
+	if b == nil {
+		return 0, ErrInvalidArguments
+	}
+
+	r := 0
+	for r < len(b) {
+		i, err := rd.r.Read(b[r:])
+		r += i
+
+		if err != nil {
+			if err == io.EOF {
+				return r, err
+			}
+
+			rd.err = err
+			return r, ErrUnexpectedReadError
+		}
+	}
+	return r, nil
+}
+
+// Reader reads entries through its own file descriptor and buffers. Readers don't block each other and
+// only lock the appender to learn the current size of the file, so appends continue while they scan
+type Reader struct {
+	app        *Appender
+	rd         *fileReader
+	generation uint64
+	mux        sync.Mutex
+	closed     bool
+}
+
+// view holds the part of the appender state a reader needs, taken under the appender lock
+type view struct {
+	head       int64
+	size       int64
+	dataOffset int64
+	generation uint64
+}
+
+func (app *Appender) view() view {
+	return view{head: app.head, size: app.size, dataOffset: app.dataOffset, generation: app.hdr.generation}
+}
+
+// NewReader returns a Reader with its own file descriptor. Readers must be closed
+func (app *Appender) NewReader() (*Reader, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	rd, err := app.newFileReader()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{app: app, rd: rd, generation: app.hdr.generation}, nil
+}
+
+func (app *Appender) newFileReader() (*fileReader, error) {
+	f, err := app.openFile()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{bytes: make([]byte, len(app.rd.entry.bytes))}
+
+	return newFileReader(f, make([]byte, len(app.rd.bufSize)), make([]byte, len(app.rd.bufMeta)), make([]byte, 1), entry), nil
+}
+
+// maxIdleReaders is the number of file readers kept open for reads running without the appender lock
+const maxIdleReaders = 4
+
+// acquireReader returns an idle file reader or opens a new one. It must be called with mux held
+func (app *Appender) acquireReader() (*fileReader, error) {
+	if n := len(app.readers); n > 0 {
+		rd := app.readers[n-1]
+		app.readers = app.readers[:n-1]
+		return rd, nil
+	}
+	return app.newFileReader()
+}
+
+// releaseReader keeps rd for later reads, closing it if enough readers are idle or the appender was closed
+func (app *Appender) releaseReader(rd *fileReader) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed || len(app.readers) == maxIdleReaders {
+		rd.f.Close()
+		return
+	}
+
+	app.readers = append(app.readers, rd)
+}
+
+// closeReaders closes every idle file reader. It must be called with mux held
+func (app *Appender) closeReaders() {
+	for _, rd := range app.readers {
+		rd.f.Close()
+	}
+	app.readers = nil
+}
+
+// current returns the state of the appender, reopening the file if it was replaced by Compact
+func (r *Reader) current() (view, error) {
+	app := r.app
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return view{}, ErrAppenderClosed
+	}
+
+	v := app.view()
+
+	if v.generation != r.generation {
+		f, err := app.openFile()
+		if err != nil {
+			return view{}, err
+		}
+
+		r.rd.f.Close()
+		r.rd.reset(f)
+		r.generation = v.generation
+	}
+
+	return v, nil
+}
+
+func (r *Reader) Read(off int64) (*Entry, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
+
+	r.app.rw.RLock()
+	defer r.app.rw.RUnlock()
+
+	v, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.read(v, off)
+}
+
+func (r *Reader) read(v view, off int64) (*Entry, error) {
+	if off < 0 || off >= v.size {
+		return nil, ErrInvalidArguments
+	}
+
+	if off < v.head {
+		return nil, ErrOffsetPurged
+	}
+
+	if err := r.app.checkViewBoundary(r.rd, v, off); err != nil {
+		return nil, err
+	}
+
+	return r.app.readEntryWith(r.rd, v.dataOffset, off)
+}
+
+func (r *Reader) ForEach(f ForEachFn) error {
+	return r.FoldWithHandler(&forEachHandler{f: f})
+}
+
+func (r *Reader) Map(f MapFn) (ls []interface{}, err error) {
+	handler := &mapHandler{f: f, ls: nil}
+	err = r.FoldWithHandler(handler)
+	return handler.Values(), err
+}
+
+func (r *Reader) Fold(f FoldFn, v interface{}) (ret interface{}, err error) {
+	handler := &gFoldHandler{f: f, v: v}
+	err = r.FoldWithHandler(handler)
+	return handler.Value(), err
+}
+
+// FoldWithHandler runs handler over the entries present when it is called
+func (r *Reader) FoldWithHandler(handler FoldHandler) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.closed {
+		return ErrReaderClosed
+	}
+
+	r.app.rw.RLock()
+	defer r.app.rw.RUnlock()
+
+	v, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	return r.app.foldView(r.rd, nil, v, handler)
+}
+
+// foldView runs handler over the entries located between the head and the size of v using rd.
+// Complete entries are read from the mapping m when it is set. Unlike fold, incomplete entries are never repaired
+func (app *Appender) foldView(rd *fileReader, m []byte, v view, handler FoldHandler) error {
+	var me *Entry
+	if m != nil {
+		me = &Entry{}
+	}
+
+	off := v.head
+	seek := true
+
+	for off < v.size {
+		e := rd.entry
+
+		if me != nil {
+			me.off = off
+			if me.readMapped(app, m, v.dataOffset+off) {
+				e = me
+			}
+		}
+
+		if e == rd.entry {
+			if seek {
+				if err := rd.seek(v.dataOffset + off); err != nil {
+					return err
+				}
+			}
+
+			e.off = off
+
+			mb, err := e.read(app, rd)
+			if err != nil && err != io.EOF {
+				return err
+			}
+
+			// Entries may only be missing if they were removed while reading
+			if mb > 0 {
+				return ErrUnexpectedReadError
+			}
+		}
+
+		// The file reader is only positioned after entries it has read
+		seek = e == me
+
+		if err := e.decode(app); err != nil {
+			return err
+		}
+
+		cutoff, err := handler.Fold(e)
+		if err != nil || cutoff {
+			return err
+		}
+
+		off += app.entryFrameLen(e)
+	}
+
+	return nil
+}
+
+func (r *Reader) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+
+	return r.rd.f.Close()
+}
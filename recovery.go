@@ -0,0 +1,172 @@
+package aof
+
+import "fmt"
+
+// RecoveryStrategy determines how an incomplete last entry, usually caused by a crash while appending, is handled
+type RecoveryStrategy int
+
+const (
+	// RecoverPad completes the last entry with zeroes and flags it as incomplete
+	RecoverPad RecoveryStrategy = iota
+	// RecoverTruncate shrinks the file back to the end of the last complete entry
+	RecoverTruncate
+	// RecoverFail returns a RecoveryError without modifying the file. It suits deployments where any
+	// modification of the file on startup must be reviewed by an operator
+	RecoverFail
+)
+
+// RecoveryAction is the action taken on an incomplete last entry or uncommitted transaction
+type RecoveryAction int
+
+const (
+	// RecoveryPadded means the entry was completed with zeroes and flagged as incomplete
+	RecoveryPadded RecoveryAction = iota
+	// RecoveryTruncated means the entry or transaction was removed from the file
+	RecoveryTruncated
+	// RecoveryFailed means the file was left untouched and Open failed
+	RecoveryFailed
+	// RecoveryIgnored means the file was left untouched by a read-only appender and the entries were skipped
+	RecoveryIgnored
+)
+
+func (a RecoveryAction) String() string {
+	switch a {
+	case RecoveryPadded:
+		return "padded"
+	case RecoveryTruncated:
+		return "truncated"
+	case RecoveryFailed:
+		return "failed"
+	case RecoveryIgnored:
+		return "ignored"
+	}
+	return fmt.Sprintf("RecoveryAction(%d)", int(a))
+}
+
+// RecoveryReport describes the incomplete last entry or uncommitted transaction found on Open, or on Refresh
+// for read-only appenders
+type RecoveryReport struct {
+	// Offset is the offset of the incomplete entry or of the first entry of the transaction
+	Offset int64
+	// Transaction is true if an uncommitted transaction was found instead of an incomplete entry
+	Transaction bool
+	Action      RecoveryAction
+	// Bytes is the number of bytes written to complete the entry or removed from the file.
+	// For RecoveryFailed it is the number of bytes which would have been removed
+	Bytes int64
+}
+
+// RecoveryError is returned by Open when the RecoverFail strategy finds an incomplete last entry or
+// uncommitted transaction. It matches ErrLastEntryIncomplete when used with errors.Is
+type RecoveryError struct {
+	Report RecoveryReport
+}
+
+func (err *RecoveryError) Error() string {
+	what := "Last Entry was incomplete"
+	if err.Report.Transaction {
+		what = "Uncommitted transaction"
+	}
+	return fmt.Sprintf("aof: %s at offset %d, %d trailing bytes were left unmodified", what, err.Report.Offset, err.Report.Bytes)
+}
+
+func (err *RecoveryError) Is(target error) bool {
+	return target == ErrLastEntryIncomplete
+}
+
+// RecoveryReport returns the report of the recovery performed on Open or the last Refresh, nil if the file was intact
+func (app *Appender) RecoveryReport() *RecoveryReport {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.report == nil {
+		return nil
+	}
+
+	report := *app.report
+
+	return &report
+}
+
+// tailLen returns the number of bytes stored from offset off to the end of the file
+func (app *Appender) tailLen(off int64) int64 {
+	fi, err := app.f.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size() - app.dataOffset - off
+}
+
+// recoverLastEntry handles an incomplete entry at offset off which is missing mb bytes.
+// It returns true if the entry was removed from the file. Read-only appenders leave the file untouched
+// and ignore the entry, which may still be being written by another process
+func (app *Appender) recoverLastEntry(off int64, mb int) (bool, error) {
+	if app.cfg.ReadOnly && app.recovery != RecoverFail {
+		app.report = &RecoveryReport{Offset: off, Action: RecoveryIgnored, Bytes: app.tailLen(off)}
+		return true, nil
+	}
+
+	switch app.recovery {
+	case RecoverTruncate:
+		app.report = &RecoveryReport{Offset: off, Action: RecoveryTruncated, Bytes: app.tailLen(off)}
+
+		if err := app.f.Truncate(app.dataOffset + off); err != nil {
+			app.close(err)
+			return false, ErrTruncatingLastEntry
+		}
+		app.repaired()
+		app.logger.Warn("aof: incomplete last entry truncated", "file", app.filename, "offset", off)
+		return true, nil
+	case RecoverFail:
+		app.report = &RecoveryReport{Offset: off, Action: RecoveryFailed, Bytes: app.tailLen(off)}
+		app.logger.Error("aof: incomplete last entry", "file", app.filename, "offset", off)
+		return false, &RecoveryError{Report: *app.report}
+	}
+
+	bs := make([]byte, mb)
+	bs[mb-1] = fIncompleteEntry
+
+	n, err := app.w.Write(bs)
+	if n != mb || err != nil {
+		app.close(err)
+		return false, ErrCompletingLastEntry
+	}
+
+	if err = app.w.Flush(); err != nil {
+		app.close(err)
+		return false, ErrCompletingLastEntry
+	}
+
+	app.report = &RecoveryReport{Offset: off, Action: RecoveryPadded, Bytes: int64(mb)}
+	app.repaired()
+	app.logger.Warn("aof: incomplete last entry padded", "file", app.filename, "offset", off, "padding", mb)
+
+	return false, nil
+}
+
+// recoverBatch removes the uncommitted transaction starting at offset off. Read-only appenders leave
+// the file untouched and ignore the transaction, which may still be being written by another process
+func (app *Appender) recoverBatch(off int64) error {
+	if app.cfg.ReadOnly && app.recovery != RecoverFail {
+		app.report = &RecoveryReport{Offset: off, Transaction: true, Action: RecoveryIgnored, Bytes: app.tailLen(off)}
+		return nil
+	}
+
+	if app.recovery == RecoverFail {
+		app.report = &RecoveryReport{Offset: off, Transaction: true, Action: RecoveryFailed, Bytes: app.tailLen(off)}
+		app.logger.Error("aof: uncommitted transaction", "file", app.filename, "offset", off)
+		return &RecoveryError{Report: *app.report}
+	}
+
+	app.report = &RecoveryReport{Offset: off, Transaction: true, Action: RecoveryTruncated, Bytes: app.tailLen(off)}
+
+	if err := app.f.Truncate(app.dataOffset + off); err != nil {
+		app.close(err)
+		return ErrTruncatingLastEntry
+	}
+
+	app.repaired()
+	app.logger.Warn("aof: uncommitted transaction truncated", "file", app.filename, "offset", off)
+
+	return nil
+}
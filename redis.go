@@ -0,0 +1,191 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var ErrInvalidRESP = errors.New("aof: Invalid RESP command")
+
+// maxRESPArgs and maxRESPBulkLen bound the commands accepted when parsing, as Redis does by default
+const (
+	maxRESPArgs    = 1024 * 1024
+	maxRESPBulkLen = 512 * 1024 * 1024
+)
+
+// RedisReader parses Redis append only files, a stream of commands encoded as RESP arrays of bulk strings.
+// Timestamp annotations are skipped. Files with an RDB preamble or multi part manifests are not supported
+type RedisReader struct {
+	r *bufio.Reader
+}
+
+func NewRedisReader(r io.Reader) *RedisReader {
+	return &RedisReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the arguments of the next command. io.EOF is returned at the end of the stream
+func (rr *RedisReader) Next() (args [][]byte, err error) {
+	var line []byte
+
+	for {
+		line, err = rr.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		// Annotations such as #TS:<unix time> are not commands
+		if len(line) > 0 && line[0] != '#' {
+			break
+		}
+	}
+
+	n, err := parseRESPLen(line, '*', maxRESPArgs)
+	if err != nil || n == 0 {
+		return nil, ErrInvalidRESP
+	}
+
+	args = make([][]byte, n)
+
+	for i := range args {
+		line, err := rr.readLine()
+		if err != nil {
+			return nil, ErrInvalidRESP
+		}
+
+		l, err := parseRESPLen(line, '$', maxRESPBulkLen)
+		if err != nil {
+			return nil, err
+		}
+
+		arg := make([]byte, l+2)
+		if _, err := io.ReadFull(rr.r, arg); err != nil || arg[l] != '\r' || arg[l+1] != '\n' {
+			return nil, ErrInvalidRESP
+		}
+
+		args[i] = arg[:l]
+	}
+
+	return args, nil
+}
+
+// readLine returns the next line without its CRLF terminator
+func (rr *RedisReader) readLine() ([]byte, error) {
+	line, err := rr.r.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, ErrInvalidRESP
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrInvalidRESP
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func parseRESPLen(line []byte, prefix byte, max int) (int, error) {
+	if len(line) < 2 || line[0] != prefix {
+		return 0, ErrInvalidRESP
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > max {
+		return 0, ErrInvalidRESP
+	}
+
+	return n, nil
+}
+
+// EncodeRESP encodes a command as a RESP array of bulk strings, as written to Redis append only files
+func EncodeRESP(args [][]byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte('*')
+	buf.WriteString(strconv.Itoa(len(args)))
+	buf.WriteString("\r\n")
+
+	for _, arg := range args {
+		buf.WriteByte('$')
+		buf.WriteString(strconv.Itoa(len(arg)))
+		buf.WriteString("\r\n")
+		buf.Write(arg)
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+}
+
+// DecodeRESP decodes a single command encoded with EncodeRESP
+func DecodeRESP(b []byte) (args [][]byte, err error) {
+	rr := NewRedisReader(bytes.NewReader(b))
+
+	args, err = rr.Next()
+	if err == io.EOF {
+		return nil, ErrInvalidRESP
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := rr.r.ReadByte(); err != io.EOF {
+		return nil, ErrInvalidRESP
+	}
+
+	return args, nil
+}
+
+// RedisCommand decodes the arguments of an entry holding a Redis command
+func (e *Entry) RedisCommand() (args [][]byte, err error) {
+	return DecodeRESP(e.payload)
+}
+
+// ImportRedis appends every command of the Redis append only file read from r as a RESP encoded entry.
+// The number of imported commands is returned
+func (app *Appender) ImportRedis(r io.Reader) (n int, err error) {
+	rr := NewRedisReader(r)
+
+	for {
+		args, err := rr.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if _, err := app.Append(EncodeRESP(args)); err != nil {
+			return n, err
+		}
+
+		n++
+	}
+}
+
+// ExportRedis writes every entry to w as a Redis append only file. Entries must hold RESP encoded commands,
+// as appended by ImportRedis, and incomplete entries are skipped
+func (app *Appender) ExportRedis(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	err := app.ForEach(func(e *Entry) (bool, error) {
+		if e.Incomplete() {
+			return false, nil
+		}
+
+		if _, err := e.RedisCommand(); err != nil {
+			return false, err
+		}
+
+		_, err := bw.Write(e.Bytes())
+		return false, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
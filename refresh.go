@@ -0,0 +1,110 @@
+package aof
+
+// Refresh picks up the entries appended by another process since a read-only appender was opened or last refreshed.
+// Entries still being written are left for a later refresh. Iterators created with Follow are woken up when new
+// entries are found. As writers hold an exclusive lock, following a file requires NoLock
+func (app *Appender) Refresh() error {
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if !app.cfg.ReadOnly {
+		return ErrInvalidArguments
+	}
+
+	size := app.size
+	app.report = nil
+
+	rescan, err := app.reload()
+	if err != nil {
+		return err
+	}
+
+	if rescan {
+		app.index.reset()
+		app.resetStats()
+		if app.keys != nil {
+			app.keys = make(map[string]int64)
+		}
+		app.deleted.reset()
+		if app.contents != nil {
+			app.contents = make(contentSet)
+		}
+		app.checkpoint = -1
+		size = app.head
+	}
+
+	handler := &sizeFoldHandler{app: app, size: size}
+	if err := app.foldFrom(size, handler, false); err != nil {
+		return err
+	}
+
+	app.size = handler.size
+
+	if err := app.loadChain(); err != nil {
+		return err
+	}
+
+	if app.size != size || rescan {
+		close(app.appended)
+		app.appended = make(chan struct{})
+	}
+
+	return nil
+}
+
+// reload reopens the file if it was replaced and reads its header again. It returns true if
+// offsets known so far are no longer valid and every entry must be scanned again
+func (app *Appender) reload() (bool, error) {
+	fi, err := app.statFile()
+	if err != nil {
+		return false, err
+	}
+
+	cur, err := app.f.Stat()
+	if err != nil {
+		return false, ErrUnexpectedReadError
+	}
+
+	replaced := !app.sameFile(fi, cur)
+
+	if replaced {
+		f, err := app.openFile()
+		if err != nil {
+			return false, err
+		}
+
+		if osf, ok := osFile(f); ok && !app.cfg.NoLock {
+			if err := lockFile(osf, false); err != nil {
+				f.Close()
+				return false, err
+			}
+		}
+
+		app.closeReaders()
+		app.f.Close()
+		app.f = f
+		app.mmap = nil
+		app.rd.reset(f)
+	}
+
+	hdr, err := openHeader(app.f, app.cfg)
+	if err != nil {
+		return false, err
+	}
+
+	rescan := replaced || hdr.generation != app.hdr.generation || hdr.head != app.head ||
+		fi.Size()-app.dataOffset < app.size
+
+	app.hdr = hdr
+	app.head = hdr.head
+	app.dataOffset = app.baseOffset + int64(hdr.len())
+
+	return rescan, nil
+}
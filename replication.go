@@ -0,0 +1,362 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrReplicationRejected = errors.New("aof: Replication rejected by leader")
+
+// Replication handshake sent by followers:
+//
+//	magic (4 bytes) | version (1 byte) | flags (2 bytes) | maxEntrySize (4 bytes) | generation (8 bytes) | offset (8 bytes) | dictionary (4 bytes)
+//
+// dictionary is a checksum of the compressor and dictionary of the file, as frames are only readable with the one
+// they were compressed with. The leader answers with a status byte. On success it is followed by its generation (8 bytes) and the offset
+// replication starts at (8 bytes), then frames are streamed exactly as stored. On failure it is followed by an
+// uvarint length and an error message
+const replicationHandshakeLen = 31
+
+const replicationResponseLen = 16
+
+var replicationMagic = []byte("GREP")
+
+const replicationVersion = 2
+
+const (
+	replicationOK uint8 = iota
+	replicationRejected
+)
+
+// maxReplicationBatch is the number of bytes a follower buffers before appending received frames
+const maxReplicationBatch = 1 << 20
+
+// ServeReplica streams entries to the follower connected through conn, starting at the offset it requests and
+// waiting for new entries once it caught up. It returns when ctx is done or the connection fails. Once entries
+// are removed by Truncate, TruncateHead or Compact, the offsets known to the follower are no longer valid and
+// ServeReplica stops with ErrStaleCursor, later handshakes of the follower are then rejected until it is resynced
+func (app *Appender) ServeReplica(ctx context.Context, conn io.ReadWriter) error {
+	b := make([]byte, replicationHandshakeLen)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return err
+	}
+
+	it, err := app.acceptReplica(ctx, b)
+	if err != nil {
+		msg := []byte(err.Error())
+		resp := append([]byte{replicationRejected}, binary.AppendUvarint(nil, uint64(len(msg)))...)
+		conn.Write(append(resp, msg...))
+		return err
+	}
+	defer it.Close()
+
+	resp := make([]byte, 1+replicationResponseLen)
+	resp[0] = replicationOK
+	byteOrder.PutUint64(resp[1:], it.generation)
+	byteOrder.PutUint64(resp[9:], uint64(it.off))
+
+	bw := bufio.NewWriter(conn)
+
+	if _, err := bw.Write(resp); err != nil {
+		return err
+	}
+
+	for {
+		e, appended, err := it.next()
+
+		if err == io.EOF {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+
+			select {
+			case <-appended:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := bw.Write(app.rawFrame(e)); err != nil {
+			return err
+		}
+	}
+}
+
+// acceptReplica validates a follower handshake and returns an iterator positioned where replication starts
+func (app *Appender) acceptReplica(ctx context.Context, b []byte) (*Iterator, error) {
+	if !bytes.Equal(b[:4], replicationMagic) || b[4] != replicationVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	flags := byteOrder.Uint16(b[5:])
+	maxEntrySize := int(byteOrder.Uint32(b[7:]))
+	generation := byteOrder.Uint64(b[11:])
+	off := int64(byteOrder.Uint64(b[19:]))
+	dictionary := byteOrder.Uint32(b[27:])
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return nil, ErrAppenderClosed
+	}
+
+	if flags != app.hdr.flags || maxEntrySize != int(uint32(app.maxEntrySize)) || dictionary != app.hdr.dictionarySum() {
+		app.mux.Unlock()
+		return nil, ErrInvalidArguments
+	}
+
+	// Empty followers start at the head, whatever their generation
+	if off == 0 {
+		off = app.head
+	} else if generation != app.hdr.generation {
+		app.mux.Unlock()
+		return nil, ErrStaleCursor
+	}
+
+	app.mux.Unlock()
+
+	return app.FollowFrom(ctx, off)
+}
+
+// rawFrame returns the entry e encoded exactly as it is stored
+func (app *Appender) rawFrame(e *Entry) []byte {
+	b := make([]byte, 0, app.entryFrameLen(e))
+
+	if app.varintSize {
+		b = binary.AppendUvarint(b, uint64(e.size))
+	} else {
+		b = b[:len(app.sharedMem.bufRWEntrySize)]
+		writeInt(b, e.size)
+	}
+
+	b = append(b, e.rawMeta...)
+	b = append(b, e.bytes[:e.size]...)
+
+	flag := fCompleteEntry
+	if e.pending {
+		flag = fPendingEntry
+	} else if e.incomplete {
+		flag = fIncompleteEntry
+	}
+
+	return append(b, flag)
+}
+
+// Replicate makes the appender a follower of the leader connected through conn. Frames are verified and appended
+// as received until ctx is done, which closes conn if it implements io.Closer, or the connection fails.
+// Followers must be opened with the same format as the leader and must not be appended to by other means
+func (app *Appender) Replicate(ctx context.Context, conn io.ReadWriter) error {
+	if c, ok := conn.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer stop()
+	}
+
+	err := app.replicate(conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (app *Appender) replicate(conn io.ReadWriter) error {
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		app.mux.Unlock()
+		return ErrReadOnly
+	}
+
+	b := make([]byte, replicationHandshakeLen)
+	copy(b, replicationMagic)
+	b[4] = replicationVersion
+	byteOrder.PutUint16(b[5:], app.hdr.flags)
+	byteOrder.PutUint32(b[7:], uint32(app.maxEntrySize))
+	byteOrder.PutUint64(b[11:], app.hdr.generation)
+	byteOrder.PutUint64(b[19:], uint64(app.size))
+	byteOrder.PutUint32(b[27:], app.hdr.dictionarySum())
+
+	app.mux.Unlock()
+
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+
+	status, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if status != replicationOK {
+		l, err := binary.ReadUvarint(br)
+		if err != nil || l > 1024 {
+			return ErrReplicationRejected
+		}
+		msg := make([]byte, l)
+		io.ReadFull(br, msg)
+		return fmt.Errorf("%w: %s", ErrReplicationRejected, msg)
+	}
+
+	resp := make([]byte, replicationResponseLen)
+	if _, err := io.ReadFull(br, resp); err != nil {
+		return err
+	}
+
+	if err := app.adopt(byteOrder.Uint64(resp), int64(byteOrder.Uint64(resp[8:]))); err != nil {
+		return err
+	}
+
+	rd := &fileReader{
+		r:       br,
+		bufSize: make([]byte, len(app.sharedMem.bufRWEntrySize)),
+		bufMeta: make([]byte, app.meta.len),
+		bufFlag: make([]byte, 1),
+	}
+
+	var entries []*Entry
+	var frames [][]byte
+	var batch int
+
+	for {
+		e := &Entry{}
+
+		mb, err := e.read(app, rd)
+		if err == io.EOF && mb == 0 {
+			return io.EOF
+		}
+		if mb > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := e.verify(app); err != nil {
+			return err
+		}
+
+		frame := app.rawFrame(e)
+
+		entries = append(entries, e)
+		frames = append(frames, frame)
+		batch += len(frame)
+
+		// Transactions are only appended once their commit marker arrives
+		if e.pending || (br.Buffered() > 0 && batch < maxReplicationBatch) {
+			continue
+		}
+
+		if err := app.appendFrames(entries, frames); err != nil {
+			return err
+		}
+
+		entries, frames, batch = entries[:0], frames[:0], 0
+	}
+}
+
+// adopt makes an empty follower start at offset head of a leader with the given generation
+func (app *Appender) adopt(generation uint64, head int64) error {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if err := app.flushPending(); err != nil {
+		return err
+	}
+
+	if app.size != 0 || (head == 0 && generation == app.hdr.generation) {
+		return nil
+	}
+
+	if app.hdr.version < 2 {
+		return ErrUnsupportedVersion
+	}
+
+	if err := app.writeHeader(headerGenerationPos, generation); err != nil {
+		return err
+	}
+	app.hdr.generation = generation
+
+	if head > 0 {
+		if err := app.f.Truncate(app.dataOffset + head); err != nil {
+			app.close(err)
+			return ErrUnexpectedWriteErr
+		}
+
+		if err := app.writeHeader(headerHeadPos, uint64(head)); err != nil {
+			return err
+		}
+
+		app.hdr.head = head
+		app.head = head
+		app.size = head
+	}
+
+	return nil
+}
+
+// appendFrames appends frames received from a leader as they are, entries holds their decoded form
+func (app *Appender) appendFrames(entries []*Entry, frames [][]byte) error {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if err := app.flushPending(); err != nil {
+		return err
+	}
+
+	off := app.size
+
+	for _, frame := range frames {
+		if _, err := app.w.Write(frame); err != nil {
+			app.close(err)
+			return ErrUnexpectedWriteErr
+		}
+	}
+
+	if err := app.w.Flush(); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	app.metrics.Flushed()
+
+	for i, e := range entries {
+		e.off = off
+		off += int64(len(frames[i]))
+
+		if err := app.track(e); err != nil {
+			return err
+		}
+
+		if app.meta.prev >= 0 {
+			app.chain = app.meta.chainHash(e.rawMeta, e.bytes[:e.size])
+		}
+	}
+
+	app.size = off
+
+	close(app.appended)
+	app.appended = make(chan struct{})
+
+	return app.syncAppended(len(frames))
+}
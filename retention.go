@@ -0,0 +1,165 @@
+package aof
+
+import (
+	"os"
+	"time"
+)
+
+// retention holds the limits after which the oldest segments of a Log are deleted.
+// The active segment is never deleted
+type retention struct {
+	bytes    int64
+	age      time.Duration
+	segments int
+}
+
+func (r retention) enabled() bool {
+	return r.bytes > 0 || r.age > 0 || r.segments > 0
+}
+
+// Head returns the logical offset of the first entry which has not been purged
+func (log *Log) Head() int64 {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	return log.head()
+}
+
+func (log *Log) head() int64 {
+	if len(log.segments) == 0 {
+		return 0
+	}
+	seg := log.segments[0]
+	if seg.app == nil {
+		return seg.start
+	}
+	return seg.start + seg.app.head
+}
+
+// Purge deletes the oldest segments exceeding the retention limits
+func (log *Log) Purge() error {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return ErrAppenderClosed
+	}
+
+	return log.purge(time.Now())
+}
+
+// TruncateHead removes every entry located before logical offset off, which must be an entry boundary.
+// Segments located entirely before off are deleted
+func (log *Log) TruncateHead(off int64) error {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return ErrAppenderClosed
+	}
+
+	seg := log.segmentAt(off)
+	if seg == nil || off < log.head() || off > seg.end() {
+		return ErrInvalidArguments
+	}
+
+	app, err := log.appenderOf(seg)
+	if err != nil {
+		return err
+	}
+
+	if err := app.TruncateHead(off - seg.start); err != nil {
+		return err
+	}
+
+	for log.segments[0] != seg {
+		if err := log.removeOldestSegment(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeOldestSegment closes and deletes the first segment
+func (log *Log) removeOldestSegment() error {
+	seg := log.segments[0]
+
+	if err := seg.close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(seg.path); err != nil {
+		return err
+	}
+
+	os.Remove(indexFilename(seg.path))
+
+	log.segments = log.segments[1:]
+
+	return nil
+}
+
+func (log *Log) purge(now time.Time) error {
+	size := log.size()
+
+	for len(log.segments) > 1 {
+		seg := log.segments[0]
+
+		expired, err := log.retention.expired(seg, len(log.segments), size, now)
+		if err != nil {
+			return err
+		}
+
+		if !expired {
+			return nil
+		}
+
+		if err := log.removeOldestSegment(); err != nil {
+			return err
+		}
+
+		size -= seg.end() - seg.start
+	}
+
+	return nil
+}
+
+// expired returns true if seg, the oldest of count segments holding size bytes, must be deleted
+func (r retention) expired(seg *segment, count int, size int64, now time.Time) (bool, error) {
+	if r.segments > 0 && count > r.segments {
+		return true, nil
+	}
+
+	if r.bytes > 0 && size > r.bytes {
+		return true, nil
+	}
+
+	if r.age > 0 {
+		fi, err := os.Stat(seg.path)
+		if err != nil {
+			return false, err
+		}
+		return now.Sub(fi.ModTime()) > r.age, nil
+	}
+
+	return false, nil
+}
+
+func (log *Log) purgeLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.mux.Lock()
+			if !log.closed {
+				log.purge(time.Now())
+			}
+			log.mux.Unlock()
+		}
+	}
+}
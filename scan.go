@@ -0,0 +1,109 @@
+package aof
+
+import (
+	"io"
+	"time"
+)
+
+// ScanMeta runs f over every entry reading only its size, metadata and flag, seeking past the content.
+// Entries passed to f hold no content, Bytes returns nil and Size the stored size, and they are neither verified
+// nor decrypted. Counting or sizing entries, or locating them by their metadata, avoids reading every payload
+func (app *Appender) ScanMeta(f ForEachFn) error {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return ErrAppenderClosed
+	}
+
+	v := app.view()
+
+	rd, err := app.acquireReader()
+	app.mux.Unlock()
+
+	if err != nil {
+		return err
+	}
+	defer app.releaseReader(rd)
+
+	if err := rd.seek(v.dataOffset + v.head); err != nil {
+		return err
+	}
+
+	e := &Entry{metaOnly: true}
+	now := time.Now()
+
+	for off := v.head; off < v.size; off += app.entryFrameLen(e) {
+		e.off = off
+
+		if err := e.readMeta(app, rd); err != nil {
+			return err
+		}
+
+		if app.hidden(e, now) {
+			continue
+		}
+
+		cutoff, err := f(e)
+		if err != nil || cutoff {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMeta fills up entry using rd like read, skipping its content. Entries must be complete
+func (e *Entry) readMeta(app *Appender, rd *fileReader) error {
+	e.payload = nil
+	e.key = nil
+
+	n, ms, err := e.readEntrySize(app, rd)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// Entries may only be missing if they were removed while reading
+	if n == 0 || ms > 0 {
+		return ErrUnexpectedReadError
+	}
+
+	if _, err := rd.readFully(rd.bufMeta); err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	app.meta.decode(e, rd.bufMeta)
+
+	if err := rd.skip(e.size); err != nil {
+		return err
+	}
+
+	if _, err := rd.readFully(rd.bufFlag); err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	e.pending = rd.bufFlag[0] == fPendingEntry
+	e.incomplete = rd.bufFlag[0] != fCompleteEntry && !e.pending
+
+	return nil
+}
+
+// skip advances the reader n bytes. Bytes not yet buffered are skipped by seeking the file instead of reading them
+func (rd *fileReader) skip(n int) error {
+	if b := rd.r.Buffered(); n > b && rd.ahead == nil {
+		pos, err := rd.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return ErrUnexpectedReadError
+		}
+		return rd.seek(pos - int64(b) + int64(n))
+	}
+
+	if _, err := rd.r.Discard(n); err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package aof
+
+import (
+	"io"
+	"iter"
+)
+
+// Entries returns an iterator over every entry, starting at the head. Iteration stops after the first error
+func (app *Appender) Entries() iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		it, err := app.headIterator()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer it.Close()
+
+		for {
+			e, err := it.Next()
+			if err == io.EOF {
+				return
+			}
+
+			if !yield(e, err) || err != nil {
+				return
+			}
+		}
+	}
+}
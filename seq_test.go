@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package aof
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEntries(t *testing.T) {
+	app, err := Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	for i := 1; i <= 5; i++ {
+		if _, err := app.Append(randomBytes(i)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	size := 1
+	for e, err := range app.Entries() {
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if e.Size() != size {
+			t.Errorf("Expected entry of size %d but size %d was read", size, e.Size())
+		}
+		if size == 3 {
+			break
+		}
+		size++
+	}
+
+	if size != 3 {
+		t.Errorf("Expected iteration to stop at the third entry")
+	}
+}
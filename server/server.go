@@ -0,0 +1,195 @@
+// Package server exposes an appender over HTTP so it can be used by remote processes and non-Go clients.
+//
+// Endpoints:
+//
+//	POST /entries            appends the request body as an entry and responds with {"offset": n}
+//	GET  /entries/{offset}   responds with the payload of the entry located at offset
+//	GET  /tail?from=offset   streams entries as newline delimited JSON {"offset": n, "data": base64}, waiting
+//	                         for new entries until the client disconnects. Entries are streamed from the first one
+//	                         when from is omitted
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jeroiraz/go-aof"
+)
+
+const DefaultMaxBodySize = 1 << 20
+
+// Server is an http.Handler serving an appender
+type Server struct {
+	app *aof.Appender
+
+	// MaxBodySize bounds the size of appended entries read from request bodies
+	MaxBodySize int64
+}
+
+// New returns a server for app. Closing app is left to the caller
+func New(app *aof.Appender) *Server {
+	return &Server{app: app, MaxBodySize: DefaultMaxBodySize}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == "/entries":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.append(w, r)
+	case strings.HasPrefix(path, "/entries/"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.read(w, r, strings.TrimPrefix(path, "/entries/"))
+	case path == "/tail":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.tail(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+type appendResponse struct {
+	Offset int64 `json:"offset"`
+}
+
+type tailEntry struct {
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+func (s *Server) append(w http.ResponseWriter, r *http.Request) {
+	bs, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.MaxBodySize))
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	off, err := s.app.Append(bs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(appendResponse{Offset: off})
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, offset string) {
+	off, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil {
+		writeError(w, aof.ErrInvalidArguments)
+		return
+	}
+
+	e, err := s.app.Read(off)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if e.Incomplete() {
+		writeError(w, aof.ErrLastEntryIncomplete)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(e.Bytes())
+}
+
+func (s *Server) tail(w http.ResponseWriter, r *http.Request) {
+	var it *aof.Iterator
+	var err error
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		off, perr := strconv.ParseInt(from, 10, 64)
+		if perr != nil {
+			writeError(w, aof.ErrInvalidArguments)
+			return
+		}
+		it, err = s.app.FollowFrom(r.Context(), off)
+	} else {
+		it, err = s.app.Follow(r.Context())
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer it.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for {
+		e, err := it.Next()
+		if err != nil {
+			// The client went away or the appender was closed, the stream just ends
+			return
+		}
+
+		if e.Incomplete() {
+			continue
+		}
+
+		if err := enc.Encode(tailEntry{Offset: e.Offset(), Data: e.Bytes()}); err != nil {
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), statusOf(err))
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, aof.ErrInvalidArguments), errors.Is(err, aof.ErrNotEntryBoundary):
+		return http.StatusBadRequest
+	case errors.Is(err, aof.ErrOffsetPurged), errors.Is(err, aof.ErrEntryExpired), errors.Is(err, aof.ErrEntryDeleted):
+		return http.StatusGone
+	case errors.Is(err, aof.ErrLastEntryIncomplete), errors.Is(err, io.EOF):
+		return http.StatusNotFound
+	case errors.Is(err, aof.ErrEntryExceedsMaxSize):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, aof.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, aof.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, aof.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, aof.ErrAppenderClosed), errors.Is(err, aof.ErrQueueFull):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jeroiraz/go-aof"
+)
+
+func TestServer(t *testing.T) {
+	app, err := aof.Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+	defer app.Close()
+
+	ts := httptest.NewServer(New(app))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/entries", "application/octet-stream", strings.NewReader("first"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var ar appendResponse
+	json.NewDecoder(resp.Body).Decode(&ar)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || ar.Offset != 0 {
+		t.Fatalf("Unexpected response %d %v", resp.StatusCode, ar)
+	}
+
+	resp, err = http.Get(ts.URL + "/entries/0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	bs, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(bs) != "first" {
+		t.Errorf("Unexpected payload %q", bs)
+	}
+
+	resp, err = http.Get(ts.URL + "/entries/1000")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/tail")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := app.Append([]byte("second")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+
+	for _, expected := range []string{"first", "second"} {
+		if !sc.Scan() {
+			t.Fatalf("Unexpected error %v", sc.Err())
+		}
+
+		var te tailEntry
+		if err := json.Unmarshal(sc.Bytes(), &te); err != nil || string(te.Data) != expected {
+			t.Errorf("Unexpected entry %v, err: %v", te, err)
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestServerErrors(t *testing.T) {
+	app, err := aof.Open("test_file.aof")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove("test_file.aof")
+
+	if _, err := app.Append([]byte("first")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	app.Close()
+
+	cfg := &aof.Config{
+		MaxEntrySize: aof.DefaultMaxEntrySize,
+		Perm:         aof.DefaultPerm,
+		ReadOnly:     true,
+	}
+
+	ro, err := aof.OpenWithConfig("test_file.aof", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer ro.Close()
+
+	s := New(ro)
+	s.MaxBodySize = 4
+
+	cases := []struct {
+		method string
+		path   string
+		body   io.Reader
+		status int
+	}{
+		// Offset right after the last entry
+		{http.MethodGet, "/entries/8", nil, http.StatusNotFound},
+		{http.MethodPost, "/entries", strings.NewReader("too large"), http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/entries", failingReader{}, http.StatusBadRequest},
+		{http.MethodPost, "/entries", strings.NewReader("ok"), http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(c.method, c.path, c.body))
+
+		if w.Code != c.status {
+			t.Errorf("Expected status %d for %s %s but %d was returned", c.status, c.method, c.path, w.Code)
+		}
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{aof.ErrInvalidArguments, http.StatusBadRequest},
+		{aof.ErrOffsetPurged, http.StatusGone},
+		{aof.ErrEntryExpired, http.StatusGone},
+		{aof.ErrEntryDeleted, http.StatusGone},
+		{io.EOF, http.StatusNotFound},
+		{aof.ErrEntryExceedsMaxSize, http.StatusRequestEntityTooLarge},
+		{aof.ErrReadOnly, http.StatusForbidden},
+		{aof.ErrRateLimited, http.StatusTooManyRequests},
+		{fmt.Errorf("wrapped: %w", aof.ErrRateLimited), http.StatusTooManyRequests},
+		{aof.ErrQuotaExceeded, http.StatusInsufficientStorage},
+		{aof.ErrQueueFull, http.StatusServiceUnavailable},
+		{aof.ErrAppenderClosed, http.StatusServiceUnavailable},
+		{aof.ErrUnexpectedWriteErr, http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		if status := statusOf(c.err); status != c.status {
+			t.Errorf("Expected status %d for %v but %d was returned", c.status, c.err, status)
+		}
+	}
+}
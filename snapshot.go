@@ -0,0 +1,146 @@
+package aof
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrSnapshotStale = errors.New("aof: Snapshot invalidated by Truncate or TruncateHead")
+
+// Snapshot is a read-only view of the entries present when it was taken. Entries appended afterwards are never
+// observed. A snapshot keeps its own file descriptor, so it remains readable after the file is replaced by Compact
+type Snapshot struct {
+	app    *Appender
+	rd     *fileReader
+	v      view
+	mux    sync.Mutex
+	closed bool
+}
+
+// Snapshot returns a view of the current entries. Snapshots must be closed
+func (app *Appender) Snapshot() (*Snapshot, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	rd, err := app.newFileReader()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{app: app, rd: rd, v: app.view()}, nil
+}
+
+// Size returns the size of the file when the snapshot was taken
+func (s *Snapshot) Size() int64 {
+	return s.v.size
+}
+
+// check returns ErrSnapshotStale if entries of the snapshot were removed from its file
+func (s *Snapshot) check() error {
+	app := s.app
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	fi, err := app.f.Stat()
+	if err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	sfi, err := s.rd.f.Stat()
+	if err != nil {
+		return ErrUnexpectedReadError
+	}
+
+	if app.sameFile(fi, sfi) && (app.hdr.generation != s.v.generation || app.head > s.v.head) {
+		return ErrSnapshotStale
+	}
+
+	return nil
+}
+
+func (s *Snapshot) Read(off int64) (*Entry, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return nil, ErrReaderClosed
+	}
+
+	s.app.rw.RLock()
+	defer s.app.rw.RUnlock()
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	if off < 0 || off >= s.v.size {
+		return nil, ErrInvalidArguments
+	}
+
+	if off < s.v.head {
+		return nil, ErrOffsetPurged
+	}
+
+	if err := s.app.checkViewBoundary(s.rd, s.v, off); err != nil {
+		return nil, err
+	}
+
+	return s.app.readEntryWith(s.rd, s.v.dataOffset, off)
+}
+
+func (s *Snapshot) ForEach(f ForEachFn) error {
+	return s.FoldWithHandler(&forEachHandler{f: f})
+}
+
+func (s *Snapshot) Map(f MapFn) (ls []interface{}, err error) {
+	handler := &mapHandler{f: f, ls: nil}
+	err = s.FoldWithHandler(handler)
+	return handler.Values(), err
+}
+
+func (s *Snapshot) Fold(f FoldFn, v interface{}) (ret interface{}, err error) {
+	handler := &gFoldHandler{f: f, v: v}
+	err = s.FoldWithHandler(handler)
+	return handler.Value(), err
+}
+
+// FoldWithHandler runs handler over the entries of the snapshot
+func (s *Snapshot) FoldWithHandler(handler FoldHandler) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return ErrReaderClosed
+	}
+
+	s.app.rw.RLock()
+	defer s.app.rw.RUnlock()
+
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.app.foldView(s.rd, nil, s.v, handler)
+}
+
+func (s *Snapshot) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	return s.rd.f.Close()
+}
@@ -0,0 +1,75 @@
+package aof
+
+import "expvar"
+
+// Stats holds runtime statistics of an appender
+type Stats struct {
+	// Entries is the number of entries located after the head
+	Entries int64
+	// Bytes is the size of the entries located after the head, including framing
+	Bytes int64
+	// PayloadBytes is the part of Bytes used by the stored content of entries, the rest is framing overhead
+	// such as sizes, metadata and flags
+	PayloadBytes int64
+	FramingBytes int64
+	// LastOffset is the offset of the last entry, -1 when there are no entries
+	LastOffset int64
+	// Incomplete is the number of incomplete entries located after the head, IncompleteOffsets holds their offsets
+	Incomplete        int64
+	IncompleteOffsets []int64
+	// Repairs is the number of incomplete entries or transactions padded or removed since Open
+	Repairs int64
+	// BufferUsed is the number of bytes held in the write buffer out of BufferSize
+	BufferUsed int
+	BufferSize int
+}
+
+// Stats returns the current statistics of the appender
+func (app *Appender) Stats() (Stats, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return Stats{}, ErrAppenderClosed
+	}
+
+	stats := Stats{
+		Entries:           app.index.count,
+		LastOffset:        app.last,
+		Bytes:             app.size - app.head,
+		PayloadBytes:      app.payloadBytes,
+		FramingBytes:      app.size - app.head - app.payloadBytes,
+		Incomplete:        int64(len(app.incomplete)),
+		IncompleteOffsets: append([]int64(nil), app.incomplete...),
+		Repairs:           app.repairs,
+		BufferUsed:        app.w.Buffered(),
+		BufferSize:        app.w.Size(),
+	}
+
+	return stats, nil
+}
+
+// PublishExpvar publishes the statistics of the appender as the expvar variable name, so they are served
+// by the /debug/vars handler. As with expvar.Publish, it panics if the name is already in use
+func (app *Appender) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats, err := app.Stats()
+		if err != nil {
+			return err.Error()
+		}
+		return stats
+	}))
+}
+
+// resetStats clears the statistics tracked for every entry before indexing them again
+func (app *Appender) resetStats() {
+	app.last = -1
+	app.payloadBytes = 0
+	app.incomplete = nil
+}
+
+// repaired records the repair of an incomplete entry or transaction
+func (app *Appender) repaired() {
+	app.repairs++
+	app.metrics.Repaired()
+}
@@ -0,0 +1,119 @@
+package aof
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// AppendFrom appends an entry holding the next n bytes read from r, copying them into the file without holding
+// the whole entry in memory. Files using checksums, signatures, hash chains, deduplication, encryption or keys, and appenders with append hooks, need the
+// whole content to frame the entry so it is read into memory first. If r fails before n bytes are read, the rest
+// of the entry is padded and stored as incomplete, and the read error is returned
+func (app *Appender) AppendFrom(r io.Reader, n int) (off int64, err error) {
+	if n < 0 {
+		return 0, ErrInvalidArguments
+	}
+
+	if !app.streamable() {
+		bs := make([]byte, n)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return 0, err
+		}
+		return app.Append(bs)
+	}
+
+	if err := app.throttleN(context.Background(), 1, int64(n)); err != nil {
+		return 0, err
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return 0, ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		return 0, ErrReadOnly
+	}
+
+	if n == 0 && !app.cfg.EmptyEntries {
+		return 0, ErrInvalidArguments
+	}
+
+	if n > app.maxEntrySize {
+		return 0, ErrEntryExceedsMaxSize
+	}
+
+	if err := app.flushPending(); err != nil {
+		return 0, err
+	}
+
+	frameLen := app.frameLen(n)
+
+	if app.cfg.MaxSize > 0 && app.size+frameLen > app.cfg.MaxSize {
+		return 0, ErrQuotaExceeded
+	}
+
+	m := &entryMeta{timestamp: time.Now().UnixNano(), seq: app.nextSeq}
+
+	off = app.size
+
+	if _, err := app.w.Write(app.encodeEntrySize(n)); err != nil {
+		app.close(err)
+		return 0, ErrUnexpectedWriteErr
+	}
+
+	if len(app.sharedMem.bufRWEntryMeta) > 0 {
+		app.meta.encode(app.sharedMem.bufRWEntryMeta, nil, m)
+
+		if _, err := app.w.Write(app.sharedMem.bufRWEntryMeta); err != nil {
+			app.close(err)
+			return 0, ErrUnexpectedWriteErr
+		}
+	}
+
+	copied, readErr := io.CopyN(app.w, r, int64(n))
+
+	flag := fCompleteEntry
+
+	if readErr != nil {
+		// Frames can't be taken back, the entry is completed as an incomplete one as done on recovery
+		if _, err := app.w.Write(make([]byte, int64(n)-copied)); err != nil {
+			app.close(err)
+			return 0, ErrUnexpectedWriteErr
+		}
+
+		flag = fIncompleteEntry
+	}
+
+	if err := app.w.WriteByte(flag); err != nil {
+		app.close(err)
+		return 0, ErrUnexpectedWriteErr
+	}
+
+	if err := app.w.Flush(); err != nil {
+		app.close(err)
+		return 0, ErrUnexpectedWriteErr
+	}
+
+	if readErr != nil {
+		app.incomplete = append(app.incomplete, off)
+	}
+
+	if err := app.flushed([]int64{off}, frameLen, int64(n), m); err != nil {
+		return 0, err
+	}
+
+	if readErr == io.EOF {
+		readErr = io.ErrUnexpectedEOF
+	}
+
+	return off, readErr
+}
+
+// streamable returns true if entries can be framed before their content is known
+func (app *Appender) streamable() bool {
+	return app.meta.checksum < 0 && app.meta.signature < 0 && app.meta.prev < 0 && app.aead == nil && app.keys == nil && app.contents == nil && len(app.cfg.AppendHooks) == 0
+}
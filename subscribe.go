@@ -0,0 +1,69 @@
+package aof
+
+import (
+	"context"
+)
+
+// Subscription delivers the entries appended to an appender to a function, see Subscribe
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Subscribe calls fn from a dedicated goroutine with every entry appended after Subscribe returns, in order,
+// once it was flushed. Appends are not blocked by fn, entries appended while fn runs are delivered afterwards.
+// Delivery stops when the subscription or the appender are closed. The entry must not be retained by fn, use Entry.Clone
+func (app *Appender) Subscribe(fn func(e *Entry)) (*Subscription, error) {
+	if fn == nil {
+		return nil, ErrInvalidArguments
+	}
+
+	app.mux.Lock()
+	size := app.size
+	app.mux.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	it, err := app.FollowFrom(ctx, size)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Subscription{cancel: cancel, done: make(chan struct{})}
+
+	go s.run(it, fn)
+
+	return s, nil
+}
+
+func (s *Subscription) run(it *Iterator, fn func(e *Entry)) {
+	defer close(s.done)
+	defer it.Close()
+
+	for {
+		e, err := it.Next()
+		if err != nil {
+			if err != context.Canceled && err != ErrAppenderClosed {
+				s.err = err
+			}
+			return
+		}
+
+		fn(e)
+	}
+}
+
+// Done returns a channel closed once no more entries will be delivered
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops delivering entries, waiting for a running call to fn to return. The error which stopped
+// delivery, if any, is returned. Close must not be called from fn
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,120 @@
+package aof
+
+import (
+	"os"
+	"time"
+)
+
+// SyncPolicy determines when appended entries are fsynced to stable storage.
+// Entries are flushed to the OS before Append returns unless Config.FlushInterval is set
+type SyncPolicy int
+
+const (
+	// SyncNever leaves durability to the OS page cache
+	SyncNever SyncPolicy = iota
+	// SyncAlways fsyncs after every Append/AppendBulk call
+	SyncAlways
+	// SyncEveryN fsyncs once Config.SyncEvery entries have been appended since the last fsync
+	SyncEveryN
+	// SyncInterval fsyncs in background every Config.SyncPeriod if there are unsynced entries
+	SyncInterval
+)
+
+// SyncWrites determines whether the file is opened for synchronous writes, so every write is durable once it
+// returns without fsync calls
+type SyncWrites int
+
+const (
+	// SyncWritesOff leaves writes asynchronous
+	SyncWritesOff SyncWrites = iota
+	// SyncWritesData opens the file with O_DSYNC, syncing written data and only the metadata needed to read it.
+	// O_SYNC is used where O_DSYNC is not available
+	SyncWritesData
+	// SyncWritesAll opens the file with O_SYNC, syncing written data and all metadata
+	SyncWritesAll
+)
+
+// flag returns the open flag selecting the synchronous writes
+func (s SyncWrites) flag() int {
+	switch s {
+	case SyncWritesData:
+		return oDSYNC
+	case SyncWritesAll:
+		return os.O_SYNC
+	}
+	return 0
+}
+
+// Sync flushes any buffered data and commits the file content to stable storage.
+// Read-only appenders never write, so there is nothing to sync
+func (app *Appender) Sync() error {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		return nil
+	}
+
+	return app.sync()
+}
+
+func (app *Appender) sync() error {
+	if err := app.flushPending(); err != nil {
+		return err
+	}
+
+	if err := app.w.Flush(); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := app.f.Sync(); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	app.unsynced = 0
+
+	app.metrics.Flushed()
+	app.metrics.Synced()
+
+	return nil
+}
+
+// syncAppended applies the sync policy after n entries were written
+func (app *Appender) syncAppended(n int) error {
+	app.unsynced += n
+
+	switch app.syncPolicy {
+	case SyncAlways:
+		return app.sync()
+	case SyncEveryN:
+		if app.unsynced >= app.syncEvery {
+			return app.sync()
+		}
+	}
+
+	return nil
+}
+
+func (app *Appender) syncLoop(period time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			app.mux.Lock()
+			if !app.closed && app.unsynced > 0 {
+				app.sync()
+			}
+			app.mux.Unlock()
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package aof
+
+// syncDir is a no-op on platforms where directories can't be synced
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package aof
+
+import "os"
+
+// syncDir syncs directory dir, so files renamed into it are found after a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
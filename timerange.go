@@ -0,0 +1,169 @@
+package aof
+
+import (
+	"sort"
+	"time"
+)
+
+// ReadSince returns an iterator over the entries appended at or after t. Time-range queries expect timestamps
+// to increase with offsets, as they do unless the clock goes backwards. ErrInvalidArguments is returned for
+// files without Timestamps
+func (app *Appender) ReadSince(t time.Time) (*Iterator, error) {
+	from, _, err := app.timeRange(t, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return app.Iterator(from)
+}
+
+// ForEachBetween runs f over the entries appended at or after t1 and before t2
+func (app *Appender) ForEachBetween(t1 time.Time, t2 time.Time, f ForEachFn) error {
+	if t2.Before(t1) {
+		return ErrInvalidArguments
+	}
+
+	from, to, err := app.timeRange(t1, t2)
+	if err != nil {
+		return err
+	}
+
+	return app.ForEachRange(from, to, f)
+}
+
+// timeRange returns the offsets of the first entries appended at or after t1 and t2. A zero t2 is not searched
+func (app *Appender) timeRange(t1 time.Time, t2 time.Time) (from int64, to int64, err error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return 0, 0, ErrAppenderClosed
+	}
+
+	if app.hdr.flags&hTimestamp == 0 {
+		return 0, 0, ErrInvalidArguments
+	}
+
+	from, err = app.timeOffset(t1)
+	if err != nil || t2.IsZero() {
+		return from, app.size, err
+	}
+
+	to, err = app.timeOffset(t2)
+
+	return from, to, err
+}
+
+// timeOffset returns the offset of the first entry appended at or after t, or the file size if there is none.
+// Index blocks are binary searched by the timestamp of their first entry, so a single block is scanned
+func (app *Appender) timeOffset(t time.Time) (int64, error) {
+	ts := t.UnixNano()
+	offs := app.index.offs
+
+	var err error
+
+	i := sort.Search(len(offs), func(i int) bool {
+		if err != nil {
+			return true
+		}
+
+		var ets int64
+		ets, err = app.timestampAt(offs[i])
+
+		return ets >= ts
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if i == 0 {
+		if len(offs) == 0 {
+			return app.size, nil
+		}
+		return offs[0], nil
+	}
+
+	handler := &sinceHandler{ts: ts, off: app.size}
+
+	if err := app.foldFrom(offs[i-1], handler, false); err != nil {
+		return 0, err
+	}
+
+	return handler.off, nil
+}
+
+// timestampAt reads the timestamp of the entry located at offset off without decoding it
+func (app *Appender) timestampAt(off int64) (int64, error) {
+	if err := app.seek(off); err != nil {
+		return 0, ErrUnexpectedReadError
+	}
+
+	e := &Entry{off: off}
+	if _, err := e.read(app, app.rd); err != nil {
+		return 0, err
+	}
+
+	return e.timestamp, nil
+}
+
+// ForEachBetween runs f over the entries appended at or after t1 and before t2. Segments are binary searched
+// by the timestamp of their first entry, only the segments holding such entries are read
+func (log *Log) ForEachBetween(t1 time.Time, t2 time.Time, f ForEachFn) error {
+	if t2.Before(t1) {
+		return ErrInvalidArguments
+	}
+
+	log.mux.Lock()
+	defer log.mux.Unlock()
+
+	if log.closed {
+		return ErrAppenderClosed
+	}
+
+	var err error
+
+	i := sort.Search(len(log.segments), func(i int) bool {
+		if err != nil {
+			return true
+		}
+
+		var from int64
+		from, _, err = log.segmentTimeRange(log.segments[i], t1, time.Time{})
+
+		return from == log.segments[i].app.FirstOffset()
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range log.segments[max(i-1, 0):] {
+		from, to, err := log.segmentTimeRange(seg, t1, t2)
+		if err != nil {
+			return err
+		}
+
+		h := &segmentFoldHandler{handler: &forEachHandler{f: f}, start: seg.start}
+
+		err = seg.app.ForEachRange(from, to, func(e *Entry) (bool, error) {
+			return h.Fold(e)
+		})
+		if err != nil || h.cutoff {
+			return err
+		}
+
+		// Later segments only hold entries appended after t2
+		if to < seg.app.Size() {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// segmentTimeRange opens seg if needed and returns the offsets of its first entries appended at or after t1 and t2
+func (log *Log) segmentTimeRange(seg *segment, t1 time.Time, t2 time.Time) (from int64, to int64, err error) {
+	app, err := log.appenderOf(seg)
+	if err != nil {
+		return 0, 0, err
+	}
+	return app.timeRange(t1, t2)
+}
@@ -0,0 +1,132 @@
+package aof
+
+import (
+	"sync"
+)
+
+// kindTombstone is the value of the kind metadata field of tombstones
+const kindTombstone uint8 = 1
+
+// tombstoneLen is the length of the payload of a tombstone, the offset of the deleted entry
+const tombstoneLen = 8
+
+// deletedSet holds the offsets of the entries deleted by a tombstone. It is nil when tombstones are not
+// enabled in the file format. It has its own lock since folds check it without holding the appender lock
+type deletedSet struct {
+	mux  sync.RWMutex
+	offs map[int64]struct{}
+}
+
+func newDeletedSet(flags uint16) *deletedSet {
+	if flags&hTombstones == 0 {
+		return nil
+	}
+	return &deletedSet{offs: make(map[int64]struct{})}
+}
+
+func (s *deletedSet) has(off int64) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	_, ok := s.offs[off]
+	return ok
+}
+
+func (s *deletedSet) add(off int64) {
+	s.mux.Lock()
+	s.offs[off] = struct{}{}
+	s.mux.Unlock()
+}
+
+func (s *deletedSet) reset() {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	s.offs = make(map[int64]struct{})
+	s.mux.Unlock()
+}
+
+// Tombstone returns the offset of the entry deleted by e if it is a tombstone, see Appender.Delete
+func (e *Entry) Tombstone() (off int64, ok bool) {
+	if !e.tombstone || len(e.payload) != tombstoneLen {
+		return 0, false
+	}
+	return int64(byteOrder.Uint64(e.payload)), true
+}
+
+// Delete appends a tombstone deleting the entry located at offset off and returns the offset of the tombstone.
+// The entry remains in the file until it is removed by Compact, see Config.SkipDeleted to hide it from reads.
+// Tombstones must be enabled in the file format
+func (app *Appender) Delete(off int64) (tomb int64, err error) {
+	if app.deleted == nil {
+		return 0, ErrInvalidArguments
+	}
+
+	app.mux.Lock()
+	generation := app.hdr.generation
+	app.mux.Unlock()
+
+	e, err := app.Read(off)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.tombstone || e.incomplete {
+		return 0, ErrInvalidArguments
+	}
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	// The entry may have been truncated or compacted since it was read, off then refers to another entry
+	if app.hdr.generation != generation || off >= app.size {
+		return 0, ErrInvalidArguments
+	}
+
+	if app.deleted.has(off) {
+		return 0, ErrEntryDeleted
+	}
+
+	bs := make([]byte, tombstoneLen)
+	byteOrder.PutUint64(bs, uint64(off))
+
+	offs, err := app.appendBulk([][]byte{bs}, &entryMeta{tombstone: true})
+	if err != nil {
+		return 0, err
+	}
+
+	app.deleted.add(off)
+
+	return offs[0], nil
+}
+
+// Deleted returns true if the entry located at offset off was deleted
+func (app *Appender) Deleted(off int64) bool {
+	return app.deleted.has(off)
+}
+
+// trackTombstone registers the entry deleted by an existing tombstone
+func (app *Appender) trackTombstone(e *Entry) error {
+	if app.deleted == nil || !e.tombstone || e.incomplete || e.pending {
+		return nil
+	}
+
+	if err := e.decrypt(app); err != nil {
+		return err
+	}
+
+	off, ok := e.Tombstone()
+	if !ok {
+		return &CorruptedEntryError{Offset: e.off}
+	}
+
+	app.deleted.add(off)
+
+	return nil
+}
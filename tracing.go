@@ -0,0 +1,55 @@
+package aof
+
+import "context"
+
+// Tracer creates spans around appender operations, see Config.Tracer. It can be implemented on top of
+// OpenTelemetry, see package aofotel
+type Tracer interface {
+	// Start creates a span named name as a child of the span in ctx, if any
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span records the attributes and outcome of an operation
+type Span interface {
+	SetAttribute(key string, value int64)
+	// End finishes the span, err is the error returned by the operation
+	End(err error)
+}
+
+type noSpan struct{}
+
+func (noSpan) SetAttribute(key string, value int64) {}
+func (noSpan) End(err error)                        {}
+
+func (app *Appender) startSpan(ctx context.Context, name string) Span {
+	if app.cfg.Tracer == nil {
+		return noSpan{}
+	}
+	_, span := app.cfg.Tracer.Start(ctx, name)
+	return span
+}
+
+// traceAppend runs append within a span recording the number of entries, their size and the first offset
+func (app *Appender) traceAppend(ctx context.Context, name string, bss [][]byte, append func() ([]int64, error)) ([]int64, error) {
+	if app.cfg.Tracer == nil {
+		return append()
+	}
+
+	span := app.startSpan(ctx, name)
+
+	offs, err := append()
+
+	var size int64
+	for _, bs := range bss {
+		size += int64(len(bs))
+	}
+
+	span.SetAttribute("aof.entries", int64(len(bss)))
+	span.SetAttribute("aof.bytes", size)
+	if len(offs) > 0 {
+		span.SetAttribute("aof.offset", offs[0])
+	}
+	span.End(err)
+
+	return offs, err
+}
@@ -0,0 +1,198 @@
+package aof
+
+import "os"
+
+// Truncate removes every entry located at or after offset off, which must be an entry boundary
+func (app *Appender) Truncate(off int64) error {
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if off < app.head || off > app.size {
+		return ErrInvalidArguments
+	}
+
+	if off == app.size {
+		return nil
+	}
+
+	boundary, err := app.isEntryBoundary(off)
+	if err != nil {
+		return err
+	}
+
+	if !boundary {
+		return ErrNotEntryBoundary
+	}
+
+	if err := app.flushPending(); err != nil {
+		return err
+	}
+
+	if err := app.nextGeneration(); err != nil {
+		return err
+	}
+
+	if err := app.w.Flush(); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := app.f.Truncate(app.dataOffset + off); err != nil {
+		app.close(err)
+		return ErrUnexpectedWriteErr
+	}
+
+	app.size = off
+
+	app.wakeFollowers()
+
+	// Version 0 and 1 files have no generation to invalidate cached entries
+	if app.cache != nil {
+		app.cache.evictFrom(off)
+	}
+
+	if err := app.rebuildIndex(); err != nil {
+		return err
+	}
+
+	if app.syncPolicy != SyncNever {
+		return app.sync()
+	}
+
+	return nil
+}
+
+// isEntryBoundary returns true if an entry starts at offset off
+func (app *Appender) isEntryBoundary(off int64) (bool, error) {
+	if off == app.head || off == app.size {
+		return true, nil
+	}
+
+	handler := &boundaryHandler{off: off}
+
+	_, start := app.index.nearestOffset(off)
+
+	if err := app.foldFrom(start, handler, false); err != nil {
+		return false, err
+	}
+
+	return handler.found, nil
+}
+
+// TruncateHead removes every entry located before offset off, which must be an entry boundary.
+// ErrEntryReferenced is returned if deduplicated entries after off reference removed entries, see Config.Dedup.
+// Offsets of the remaining entries are preserved. The space used by removed entries is released
+// when supported by the filesystem
+func (app *Appender) TruncateHead(off int64) error {
+	app.rw.Lock()
+	defer app.rw.Unlock()
+
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return ErrAppenderClosed
+	}
+
+	if app.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if off < app.head || off > app.size {
+		return ErrInvalidArguments
+	}
+
+	if off == app.head {
+		return nil
+	}
+
+	boundary, err := app.isEntryBoundary(off)
+	if err != nil {
+		return err
+	}
+
+	if !boundary {
+		return ErrNotEntryBoundary
+	}
+
+	// Version 0 files have no header to record the head
+	if app.hdr.version == 0 {
+		return ErrUnsupportedVersion
+	}
+
+	if err := app.checkReferences(off); err != nil {
+		return err
+	}
+
+	if err := app.writeHeader(headerHeadPos, uint64(off)); err != nil {
+		return err
+	}
+
+	prev := app.head
+	app.head = off
+	app.hdr.head = off
+
+	if f, ok := osFile(app.f); ok {
+		punchHole(f, app.dataOffset+prev, off-prev)
+	}
+
+	return app.rebuildIndex()
+}
+
+// nextGeneration durably increases the generation stored in the file header. Version 0 and 1 files have no generation
+func (app *Appender) nextGeneration() error {
+	if app.hdr.version < 2 {
+		return nil
+	}
+
+	if err := app.writeHeader(headerGenerationPos, app.hdr.generation+1); err != nil {
+		return err
+	}
+
+	app.hdr.generation++
+
+	return nil
+}
+
+// writeHeader durably updates the header field located at pos
+func (app *Appender) writeHeader(pos int64, v uint64) error {
+	b := make([]byte, 8)
+	byteOrder.PutUint64(b, v)
+
+	if app.handle != nil {
+		if _, err := app.handle.writeAt(b, app.baseOffset+pos); err != nil {
+			return ErrUnexpectedWriteErr
+		}
+		if err := app.f.Sync(); err != nil {
+			return ErrUnexpectedWriteErr
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(app.filename, os.O_WRONLY, 0)
+	if err != nil {
+		return ErrUnexpectedWriteErr
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(b, app.baseOffset+pos); err != nil {
+		return ErrUnexpectedWriteErr
+	}
+
+	if err := f.Sync(); err != nil {
+		return ErrUnexpectedWriteErr
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package aof
+
+import (
+	"os"
+	"time"
+)
+
+// Expired returns true if e outlived its time to live, as given by Config.EntryTTL or Config.TTL.
+// Entries without timestamps never expire
+func (app *Appender) Expired(e *Entry) bool {
+	return app.expiredAt(e, time.Now())
+}
+
+func (app *Appender) expiredAt(e *Entry, now time.Time) bool {
+	if e.timestamp == 0 || e.incomplete {
+		return false
+	}
+
+	ttl := app.cfg.TTL
+	if app.cfg.EntryTTL != nil {
+		ttl = app.cfg.EntryTTL(e)
+	}
+
+	return ttl > 0 && now.UnixNano()-e.timestamp >= int64(ttl)
+}
+
+// skipExpired returns true if e has to be hidden from reads
+func (app *Appender) skipExpired(e *Entry) bool {
+	return app.cfg.SkipExpired && app.Expired(e)
+}
+
+// hidden returns true if e has to be hidden from folds and iterators at time now
+func (app *Appender) hidden(e *Entry, now time.Time) bool {
+	if app.cfg.SkipExpired && app.expiredAt(e, now) {
+		return true
+	}
+	return app.cfg.SkipDeleted && (e.tombstone || app.deleted.has(e.off))
+}
+
+// PurgeExpired compacts the file dropping every expired entry, see Compact
+func (app *Appender) PurgeExpired() (offsets map[int64]int64, err error) {
+	if !app.expires() {
+		return nil, ErrInvalidArguments
+	}
+
+	return app.Compact(func(e *Entry) (bool, []byte, error) {
+		return true, nil, nil
+	})
+}
+
+// expires returns true if entries of the file may expire
+func (app *Appender) expires() bool {
+	return app.hdr.flags&hTimestamp != 0 && (app.cfg.TTL > 0 || app.cfg.EntryTTL != nil)
+}
+
+// hiddenFilter hides expired and deleted entries from the wrapped handler
+type hiddenFilter struct {
+	FoldHandler
+	app *Appender
+	now time.Time
+}
+
+func (h *hiddenFilter) Fold(e *Entry) (bool, error) {
+	if h.app.hidden(e, h.now) {
+		return false, nil
+	}
+	return h.FoldHandler.Fold(e)
+}
+
+// purgeExpired deletes the oldest segments last written before the TTL of their entries, so every entry
+// they hold is expired. It runs on rotation and only applies to a uniform TTL
+func (log *Log) purgeExpired(now time.Time) error {
+	if !log.segCfg.Timestamps || log.segCfg.TTL <= 0 || log.segCfg.EntryTTL != nil {
+		return nil
+	}
+
+	for len(log.segments) > 1 {
+		fi, err := os.Stat(log.segments[0].path)
+		if err != nil {
+			return err
+		}
+
+		if now.Sub(fi.ModTime()) < log.segCfg.TTL {
+			return nil
+		}
+
+		if err := log.removeOldestSegment(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
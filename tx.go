@@ -0,0 +1,121 @@
+package aof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrTxDone = errors.New("aof: Transaction already committed or rolled back")
+
+// Tx groups entries which become visible together when committed. Every entry but the last one of a
+// committed transaction is flagged as pending, the last one acts as the commit marker. Pending entries not
+// followed by a commit marker, left by a crash while committing, are ignored by read-only appenders and
+// otherwise removed when the file is opened, unless RecoverFail is used
+type Tx struct {
+	app  *Appender
+	bss  [][]byte
+	done bool
+}
+
+// Begin starts a transaction. Transactions must be enabled in the file format
+func (app *Appender) Begin() (*Tx, error) {
+	app.mux.Lock()
+	defer app.mux.Unlock()
+
+	if app.closed {
+		return nil, ErrAppenderClosed
+	}
+
+	if app.hdr.flags&hTransactions == 0 || app.keys != nil {
+		return nil, ErrInvalidArguments
+	}
+
+	if app.cfg.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	return &Tx{app: app}, nil
+}
+
+// Append adds a copy of bs to the transaction, nothing is written until Commit
+func (tx *Tx) Append(bs []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	if len(bs) == 0 && !tx.app.cfg.EmptyEntries {
+		return ErrInvalidArguments
+	}
+
+	if len(bs) > tx.app.maxEntrySize {
+		return ErrEntryExceedsMaxSize
+	}
+
+	tx.bss = append(tx.bss, bytes.Clone(bs))
+
+	return nil
+}
+
+// Commit appends every entry of the transaction, returning their offsets
+func (tx *Tx) Commit() (offs []int64, err error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	tx.done = true
+
+	if len(tx.bss) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.app.throttle(context.Background(), tx.bss); err != nil {
+		return nil, err
+	}
+
+	tx.app.mux.Lock()
+	defer tx.app.mux.Unlock()
+
+	return tx.app.appendBulk(tx.bss, &entryMeta{batch: true})
+}
+
+// Rollback discards the entries of the transaction
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+	tx.bss = nil
+
+	return nil
+}
+
+// batchCommitted reports whether the pending entry located at offset off is followed by a commit marker
+func (app *Appender) batchCommitted(off int64) (bool, error) {
+	e := app.rd.entry
+
+	if err := app.seek(off); err != nil {
+		return false, err
+	}
+
+	for {
+		e.off = off
+
+		mb, err := e.read(app, app.rd)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+
+		if mb > 0 || err == io.EOF {
+			return false, nil
+		}
+
+		if !e.pending {
+			return true, nil
+		}
+
+		off += app.entryFrameLen(e)
+	}
+}
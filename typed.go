@@ -0,0 +1,92 @@
+package aof
+
+// Typed appends and reads values of type T encoded with a codec
+type Typed[T any] struct {
+	app   *Appender
+	codec Codec
+}
+
+// NewTyped returns a Typed using app to store values encoded with codec. A nil codec uses the codec
+// configured for app
+func NewTyped[T any](app *Appender, codec Codec) *Typed[T] {
+	if codec == nil {
+		codec = app.codec()
+	}
+	return &Typed[T]{app: app, codec: codec}
+}
+
+// Appender returns the underlying appender
+func (t *Typed[T]) Appender() *Appender {
+	return t.app
+}
+
+func (t *Typed[T]) Append(v T) (off int64, err error) {
+	bs, err := t.codec.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return t.app.Append(bs)
+}
+
+func (t *Typed[T]) AppendBulk(vs []T) (offs []int64, err error) {
+	bss := make([][]byte, len(vs))
+	for i, v := range vs {
+		bss[i], err = t.codec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.app.AppendBulk(bss)
+}
+
+func (t *Typed[T]) Read(off int64) (v T, err error) {
+	e, err := t.app.Read(off)
+	if err != nil {
+		return v, err
+	}
+	err = t.codec.Unmarshal(e.Bytes(), &v)
+	return v, err
+}
+
+// ForEach runs f over the decoded value of every complete entry
+func (t *Typed[T]) ForEach(f func(off int64, v T) (cutoff bool, err error)) error {
+	return t.app.ForEach(func(e *Entry) (bool, error) {
+		if e.Incomplete() {
+			return false, nil
+		}
+
+		var v T
+		if err := t.codec.Unmarshal(e.Bytes(), &v); err != nil {
+			return false, err
+		}
+
+		return f(e.Offset(), v)
+	})
+}
+
+func (t *Typed[T]) Map(f func(v T) (r interface{}, cutoff bool, err error)) (ls []interface{}, err error) {
+	err = t.ForEach(func(off int64, v T) (bool, error) {
+		r, cutoff, err := f(v)
+		if err != nil {
+			return false, err
+		}
+		ls = append(ls, r)
+		return cutoff, nil
+	})
+	return ls, err
+}
+
+// Filter returns every value accepted by f
+func (t *Typed[T]) Filter(f func(v T) (include bool, cutoff bool, err error)) (vs []T, err error) {
+	err = t.ForEach(func(off int64, v T) (bool, error) {
+		include, cutoff, err := f(v)
+		if err != nil {
+			return false, err
+		}
+		if include {
+			vs = append(vs, v)
+		}
+		return cutoff, nil
+	})
+	return vs, err
+}
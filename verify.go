@@ -0,0 +1,117 @@
+package aof
+
+import "io"
+
+// DamagedEntry describes an entry found to be corrupted or incomplete by Verify
+type DamagedEntry struct {
+	Offset int64
+	// Err is a *CorruptedEntryError for entries failing checksum or authentication, or with an invalid frame,
+	// ErrIncompleteEntry for entries completed on recovery and ErrLastEntryIncomplete for a partially written
+	// last entry or an uncommitted transaction
+	Err error
+}
+
+// Verify reads every entry validating its frame, and its checksum or authentication tag when enabled.
+// The file is never modified. A frame with an invalid size ends the scan, as no further entries can be located.
+// Writable appenders only verify the entries appended so far, read-only appenders verify up to the end of the file
+func (app *Appender) Verify() ([]DamagedEntry, error) {
+	app.rw.RLock()
+	defer app.rw.RUnlock()
+
+	app.mux.Lock()
+
+	if app.closed {
+		app.mux.Unlock()
+		return nil, ErrAppenderClosed
+	}
+
+	v := app.view()
+
+	rd, err := app.newFileReader()
+	app.mux.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	defer rd.f.Close()
+
+	end := v.size
+	if app.cfg.ReadOnly {
+		end = -1
+	}
+
+	return app.verifyFrom(rd, v, end)
+}
+
+// verifyFrom verifies the entries read with rd starting at the head of view v and ending at offset end,
+// or at the end of the file when end is negative
+func (app *Appender) verifyFrom(rd *fileReader, v view, end int64) ([]DamagedEntry, error) {
+	var damaged []DamagedEntry
+
+	if err := rd.seek(v.dataOffset + v.head); err != nil {
+		return nil, ErrUnexpectedReadError
+	}
+
+	e := rd.entry
+	maxStoredSize := app.maxStoredSize
+
+	off := v.head
+	batch := int64(-1)
+
+	for end < 0 || off < end {
+		// Sizes are checked before reading so a corrupted size can't cause a huge read
+		if size, _, ok := app.sizeAt(peekSize(rd)); ok && (size < 0 || size > maxStoredSize) {
+			damaged = append(damaged, DamagedEntry{Offset: off, Err: &CorruptedEntryError{Offset: off}})
+			return damaged, nil
+		}
+
+		e.off = off
+		mb, err := e.read(app, rd)
+		if err == io.EOF && mb == 0 {
+			break
+		}
+		if _, ok := err.(*CorruptedEntryError); ok {
+			damaged = append(damaged, DamagedEntry{Offset: off, Err: err})
+			return damaged, nil
+		}
+		if err != nil && err != io.EOF {
+			return damaged, err
+		}
+
+		if mb > 0 {
+			damaged = append(damaged, DamagedEntry{Offset: off, Err: ErrLastEntryIncomplete})
+			return damaged, nil
+		}
+
+		switch flag := rd.bufFlag[0]; {
+		case flag == fIncompleteEntry:
+			damaged = append(damaged, DamagedEntry{Offset: off, Err: ErrIncompleteEntry})
+		case flag != fCompleteEntry && flag != fPendingEntry:
+			damaged = append(damaged, DamagedEntry{Offset: off, Err: &CorruptedEntryError{Offset: off}})
+		default:
+			if err := e.decode(app); err != nil {
+				damaged = append(damaged, DamagedEntry{Offset: off, Err: err})
+			}
+		}
+
+		if !e.pending {
+			batch = -1
+		} else if batch < 0 {
+			batch = off
+		}
+
+		off += app.entryFrameLen(e)
+	}
+
+	if batch >= 0 {
+		damaged = append(damaged, DamagedEntry{Offset: batch, Err: ErrLastEntryIncomplete})
+	}
+
+	return damaged, nil
+}
+
+// peekSize returns the bytes holding the size of the next entry without consuming them
+func peekSize(rd *fileReader) []byte {
+	b, _ := rd.r.Peek(len(rd.bufSize))
+	return b
+}
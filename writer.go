@@ -0,0 +1,99 @@
+package aof
+
+import (
+	"bufio"
+	"sync"
+)
+
+// Writer adapts an appender to io.Writer. Without a split function every Write call appends one entry,
+// otherwise written bytes are buffered and every token returned by the split function becomes an entry
+type Writer struct {
+	app   *Appender
+	split bufio.SplitFunc
+
+	mux sync.Mutex
+	buf []byte
+}
+
+// Writer returns an io.Writer appending one entry per Write call
+func (app *Appender) Writer() *Writer {
+	return &Writer{app: app}
+}
+
+// SplitWriter returns an io.Writer appending one entry per token returned by split,
+// e.g. bufio.ScanLines appends one entry per line. Close must be called to append buffered data
+func (app *Appender) SplitWriter(split bufio.SplitFunc) *Writer {
+	return &Writer{app: app, split: split}
+}
+
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if w.split == nil {
+		if _, err := w.app.Append(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	if err := w.drain(false); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// drain appends every complete token in the buffer, or every remaining token when atEOF is set
+func (w *Writer) drain(atEOF bool) error {
+	var bss [][]byte
+
+	for len(w.buf) > 0 {
+		adv, tok, err := w.split(w.buf, atEOF)
+		if err != nil {
+			return err
+		}
+		if adv == 0 && tok == nil {
+			break
+		}
+		if tok != nil {
+			bss = append(bss, tok)
+		}
+		w.buf = w.buf[adv:]
+	}
+
+	if len(bss) > 0 {
+		if _, err := w.app.AppendBulk(bss); err != nil {
+			return err
+		}
+	}
+
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+
+	return nil
+}
+
+// Flush appends any buffered data as if the end of the input was reached
+func (w *Writer) Flush() error {
+	if w.split == nil {
+		return nil
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	return w.drain(true)
+}
+
+// Close flushes buffered data, the underlying appender is not closed
+func (w *Writer) Close() error {
+	return w.Flush()
+}